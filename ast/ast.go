@@ -34,7 +34,10 @@ type Identifier struct {
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
-	Value Expression
+	// Pattern is set instead of Name when the statement destructures its
+	// value.
+	Pattern Expression
+	Value   Expression
 }
 
 type ReturnStatement struct {
@@ -73,6 +76,7 @@ type Boolean struct {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Position
 }
 
 type IfExpression struct {
@@ -85,8 +89,19 @@ type IfExpression struct {
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
-	Body       *BlockStatement
-	Name       string
+	// Defaults holds the default value of each parameter, nil for the
+	// parameters that have none. It is nil if no parameter has one.
+	Defaults []Expression
+	// Patterns holds the pattern that destructures each parameter, nil for
+	// plain parameters. It is nil if no parameter has one. A destructured
+	// parameter is named after its pattern, which no identifier can refer
+	// to.
+	Patterns []Expression
+	// Variadic is set when the last parameter collects the remaining
+	// arguments into an array.
+	Variadic bool
+	Body     *BlockStatement
+	Name     string
 }
 
 type CallExpression struct {
@@ -95,14 +110,31 @@ type CallExpression struct {
 	Arguments []Expression
 }
 
+// SpreadExpression passes the elements of an array as separate arguments
+// of a call.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
 }
 
+// TemplateLiteral is a string literal with interpolated values, such as
+// "Hello ${name}". Segments holds the text around the values, so it has
+// one more element than Values.
+type TemplateLiteral struct {
+	Token    token.Token
+	Segments []string
+	Values   []Expression
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Position
 }
 
 type IndexExpression struct {
@@ -111,9 +143,129 @@ type IndexExpression struct {
 	Index Expression
 }
 
+// SliceExpression is left[start:end:step], the part of a string or an
+// array from start up to but not including end, taking every step-th
+// element. Start, End and Step are nil when they are left out.
+type SliceExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Start Expression
+	End   Expression
+	Step  Expression
+}
+
 type HashLiteral struct {
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Rbrace token.Position
+}
+
+// ArrayPattern destructures an array, binding its elements in order to
+// the element patterns. Rest, if set, collects the remaining elements.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Expression
+	Rest     *Identifier
+}
+
+// HashPattern destructures a hash, binding the value of each pair's key
+// to the pair's pattern. {name} is short for {"name": name}.
+type HashPattern struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	Pairs []*PatternPair
+}
+
+type PatternPair struct {
+	Key     Expression
+	Pattern Expression
+}
+
+// MatchExpression evaluates to the body of the first arm whose pattern
+// matches Value and whose guard, if any, is truthy. Besides identifiers,
+// array and hash patterns, an arm's pattern may be an integer, string or
+// boolean literal, which matches values equal to it, and the identifier _,
+// which matches anything without binding it. Array patterns in an arm only
+// match arrays of their length, or at least their length if they have a
+// rest element, and hash patterns only hashes holding all of their keys.
+type MatchExpression struct {
+	Token  token.Token
+	Value  Expression
+	Arms   []*MatchArm
+	Rbrace token.Position
+}
+
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression
+	Body    Expression
+}
+
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (me *MatchExpression) expressionNode() {
+}
+
+func (me *MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Value.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+func (ml *MacroLiteral) expressionNode() {
+}
+
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
 }
 
 func (hl *HashLiteral) expressionNode() {
@@ -157,6 +309,35 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+func (se *SliceExpression) expressionNode() {
+}
+
+func (se *SliceExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	if se.Step != nil {
+		out.WriteString(":")
+		out.WriteString(se.Step.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 func (al *ArrayLiteral) expressionNode() {
 }
 
@@ -190,6 +371,28 @@ func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
 
+func (tl *TemplateLiteral) expressionNode() {
+}
+
+func (tl *TemplateLiteral) TokenLiteral() string {
+	return tl.Token.Literal
+}
+
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+
+	for i, segment := range tl.Segments {
+		out.WriteString(segment)
+		if i < len(tl.Values) {
+			out.WriteString("${")
+			out.WriteString(tl.Values[i].String())
+			out.WriteString("}")
+		}
+	}
+
+	return out.String()
+}
+
 func (ce *CallExpression) expressionNode() {
 }
 
@@ -216,6 +419,81 @@ func (ce *CallExpression) String() string {
 func (fl *FunctionLiteral) expressionNode() {
 }
 
+// Default returns the default value of parameter i, or nil.
+func (fl *FunctionLiteral) Default(i int) Expression {
+	if i < len(fl.Defaults) {
+		return fl.Defaults[i]
+	}
+	return nil
+}
+
+// Pattern returns the pattern that destructures parameter i, or nil.
+func (fl *FunctionLiteral) Pattern(i int) Expression {
+	if i < len(fl.Patterns) {
+		return fl.Patterns[i]
+	}
+	return nil
+}
+
+func (ap *ArrayPattern) expressionNode() {
+}
+
+func (ap *ArrayPattern) TokenLiteral() string {
+	return ap.Token.Literal
+}
+
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, e := range ap.Elements {
+		elements = append(elements, e.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+func (hp *HashPattern) expressionNode() {
+}
+
+func (hp *HashPattern) TokenLiteral() string {
+	return hp.Token.Literal
+}
+
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for _, pair := range hp.Pairs {
+		if pair.Shorthand() {
+			pairs = append(pairs, pair.Pattern.String())
+		} else {
+			pairs = append(pairs, pair.Key.String()+":"+pair.Pattern.String())
+		}
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Shorthand reports whether the pair was written as a bare identifier, as
+// in {name}.
+func (pp *PatternPair) Shorthand() bool {
+	key, ok := pp.Key.(*StringLiteral)
+	if !ok || key.Token.Type != token.IDENT {
+		return false
+	}
+	ident, ok := pp.Pattern.(*Identifier)
+	return ok && ident.Value == key.Value && ident.Token.Pos == key.Token.Pos
+}
+
+func (se *SpreadExpression) expressionNode() {
+}
+
+func (se *SpreadExpression) TokenLiteral() string {
+	return se.Token.Literal
+}
+
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
+}
+
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
@@ -224,8 +502,14 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		param := p.String()
+		if fl.Variadic && i == len(fl.Parameters)-1 {
+			param = "..." + param
+		} else if def := fl.Default(i); def != nil {
+			param += " = " + def.String()
+		}
+		params = append(params, param)
 	}
 
 	out.WriteString(fl.TokenLiteral())
@@ -384,7 +668,11 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
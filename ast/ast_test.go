@@ -25,3 +25,37 @@ func TestString(t *testing.T) {
 		t.Errorf("incorrect string, got %q", program.String())
 	}
 }
+
+func TestPos(t *testing.T) {
+	at := func(line, column int) token.Token {
+		return token.Token{Pos: token.Position{Line: line, Column: column}}
+	}
+
+	call := &CallExpression{
+		Token:    at(1, 4),
+		Function: &Identifier{Token: at(1, 1), Value: "add"},
+		Arguments: []Expression{
+			&InfixExpression{
+				Token:    at(2, 3),
+				Left:     &IntegerLiteral{Token: at(2, 1), Value: 1},
+				Operator: "+",
+				Right:    &IntegerLiteral{Token: at(3, 1), Value: 2},
+			},
+		},
+	}
+
+	if pos := Pos(call); pos != (token.Position{Line: 1, Column: 1}) {
+		t.Errorf("call position, expected 1:1 got %s", pos)
+	}
+	if pos := Pos(call.Arguments[0]); pos != (token.Position{Line: 2, Column: 1}) {
+		t.Errorf("infix position, expected 2:1 got %s", pos)
+	}
+	if line := EndLine(call); line != 3 {
+		t.Errorf("end line, expected 3 got %d", line)
+	}
+
+	block := &BlockStatement{Token: at(1, 1), Rbrace: token.Position{Line: 5, Column: 1}}
+	if line := EndLine(block); line != 5 {
+		t.Errorf("block end line, expected 5 got %d", line)
+	}
+}
@@ -0,0 +1,202 @@
+package ast
+
+// Copy returns a deep copy of node. Rewriting the copy with Modify leaves
+// the original tree untouched.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+	case *LetStatement:
+		return &LetStatement{
+			Token:   node.Token,
+			Name:    copyIdentifier(node.Name),
+			Pattern: copyExpression(node.Pattern),
+			Value:   copyExpression(node.Value),
+		}
+	case *ReturnStatement:
+		return &ReturnStatement{
+			Token:       node.Token,
+			ReturnValue: copyExpression(node.ReturnValue),
+		}
+	case *ExpressionStatement:
+		return &ExpressionStatement{
+			Token:      node.Token,
+			Expression: copyExpression(node.Expression),
+		}
+	case *BlockStatement:
+		return copyBlock(node)
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		return &IntegerLiteral{Token: node.Token, Value: node.Value}
+	case *Boolean:
+		return &Boolean{Token: node.Token, Value: node.Value}
+	case *StringLiteral:
+		return &StringLiteral{Token: node.Token, Value: node.Value}
+	case *PrefixExpression:
+		return &PrefixExpression{
+			Token:    node.Token,
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    node.Token,
+			Left:     copyExpression(node.Left),
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+	case *FunctionLiteral:
+		return &FunctionLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Defaults:   copyExpressions(node.Defaults),
+			Patterns:   copyExpressions(node.Patterns),
+			Variadic:   node.Variadic,
+			Body:       copyBlock(node.Body),
+			Name:       node.Name,
+		}
+	case *ArrayPattern:
+		return &ArrayPattern{
+			Token:    node.Token,
+			Elements: copyExpressions(node.Elements),
+			Rest:     copyIdentifier(node.Rest),
+		}
+	case *HashPattern:
+		pairs := make([]*PatternPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			pairs[i] = &PatternPair{Key: copyExpression(pair.Key), Pattern: copyExpression(pair.Pattern)}
+		}
+		return &HashPattern{Token: node.Token, Pairs: pairs}
+	case *MatchExpression:
+		arms := make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			arms[i] = &MatchArm{
+				Pattern: copyExpression(arm.Pattern),
+				Guard:   copyExpression(arm.Guard),
+				Body:    copyExpression(arm.Body),
+			}
+		}
+		return &MatchExpression{
+			Token:  node.Token,
+			Value:  copyExpression(node.Value),
+			Arms:   arms,
+			Rbrace: node.Rbrace,
+		}
+	case *MacroLiteral:
+		return &MacroLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Body:       copyBlock(node.Body),
+		}
+	case *CallExpression:
+		return &CallExpression{
+			Token:     node.Token,
+			Function:  copyExpression(node.Function),
+			Arguments: copyExpressions(node.Arguments),
+		}
+	case *SpreadExpression:
+		return &SpreadExpression{Token: node.Token, Value: copyExpression(node.Value)}
+	case *TemplateLiteral:
+		return &TemplateLiteral{
+			Token:    node.Token,
+			Segments: append([]string(nil), node.Segments...),
+			Values:   copyExpressions(node.Values),
+		}
+	case *ArrayLiteral:
+		return &ArrayLiteral{
+			Token:    node.Token,
+			Elements: copyExpressions(node.Elements),
+			Rbracket: node.Rbracket,
+		}
+	case *IndexExpression:
+		return &IndexExpression{
+			Token: node.Token,
+			Left:  copyExpression(node.Left),
+			Index: copyExpression(node.Index),
+		}
+	case *SliceExpression:
+		return &SliceExpression{
+			Token: node.Token,
+			Left:  copyExpression(node.Left),
+			Start: copyExpression(node.Start),
+			End:   copyExpression(node.End),
+			Step:  copyExpression(node.Step),
+		}
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression)
+		for key, value := range node.Pairs {
+			pairs[copyExpression(key)] = copyExpression(value)
+		}
+		return &HashLiteral{Token: node.Token, Pairs: pairs, Rbrace: node.Rbrace}
+	}
+
+	return node
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	copied := make([]Statement, len(statements))
+	for i, s := range statements {
+		if s != nil {
+			copied[i] = Copy(s).(Statement)
+		}
+	}
+	return copied
+}
+
+func copyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+	copied := make([]Expression, len(expressions))
+	for i, e := range expressions {
+		copied[i] = copyExpression(e)
+	}
+	return copied
+}
+
+func copyExpression(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	return Copy(e).(Expression)
+}
+
+func copyIdentifiers(identifiers []*Identifier) []*Identifier {
+	if identifiers == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(identifiers))
+	for i, ident := range identifiers {
+		copied[i] = copyIdentifier(ident)
+	}
+	return copied
+}
+
+func copyIdentifier(i *Identifier) *Identifier {
+	if i == nil {
+		return nil
+	}
+	return &Identifier{Token: i.Token, Value: i.Value}
+}
+
+func copyBlock(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	return &BlockStatement{
+		Token:      b.Token,
+		Statements: copyStatements(b.Statements),
+		Rbrace:     b.Rbrace,
+	}
+}
@@ -0,0 +1,141 @@
+package ast
+
+// ModifierFunc is called for every node by Modify, children first. The
+// node it returns replaces the original one.
+type ModifierFunc func(Node) Node
+
+// Modify rewrites an AST bottom-up. Children are replaced in place; if the
+// modifier returns a node of the wrong kind for a slot (for instance an
+// expression where a statement is required) the original child is kept.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		node.Statements = modifyStatements(node.Statements, modifier)
+	case *LetStatement:
+		node.Name = modifyIdentifier(node.Name, modifier)
+		node.Pattern = modifyExpression(node.Pattern, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+	case *ExpressionStatement:
+		node.Expression = modifyExpression(node.Expression, modifier)
+	case *BlockStatement:
+		node.Statements = modifyStatements(node.Statements, modifier)
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+	case *InfixExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Right = modifyExpression(node.Right, modifier)
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = modifyBlock(node.Consequence, modifier)
+		node.Alternative = modifyBlock(node.Alternative, modifier)
+	case *FunctionLiteral:
+		for i, p := range node.Parameters {
+			if node.Pattern(i) != nil {
+				node.Patterns[i] = modifyExpression(node.Patterns[i], modifier)
+			} else {
+				node.Parameters[i] = modifyIdentifier(p, modifier)
+			}
+			if node.Default(i) != nil {
+				node.Defaults[i] = modifyExpression(node.Defaults[i], modifier)
+			}
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+	case *ArrayPattern:
+		node.Elements = modifyExpressions(node.Elements, modifier)
+		node.Rest = modifyIdentifier(node.Rest, modifier)
+	case *HashPattern:
+		for _, pair := range node.Pairs {
+			pair.Key = modifyExpression(pair.Key, modifier)
+			pair.Pattern = modifyExpression(pair.Pattern, modifier)
+		}
+	case *MatchExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+		for _, arm := range node.Arms {
+			arm.Pattern = modifyExpression(arm.Pattern, modifier)
+			arm.Guard = modifyExpression(arm.Guard, modifier)
+			arm.Body = modifyExpression(arm.Body, modifier)
+		}
+	case *MacroLiteral:
+		for i, p := range node.Parameters {
+			node.Parameters[i] = modifyIdentifier(p, modifier)
+		}
+		node.Body = modifyBlock(node.Body, modifier)
+	case *CallExpression:
+		node.Function = modifyExpression(node.Function, modifier)
+		node.Arguments = modifyExpressions(node.Arguments, modifier)
+	case *SpreadExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *TemplateLiteral:
+		node.Values = modifyExpressions(node.Values, modifier)
+	case *ArrayLiteral:
+		node.Elements = modifyExpressions(node.Elements, modifier)
+	case *IndexExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+	case *SliceExpression:
+		node.Left = modifyExpression(node.Left, modifier)
+		node.Start = modifyExpression(node.Start, modifier)
+		node.End = modifyExpression(node.End, modifier)
+		node.Step = modifyExpression(node.Step, modifier)
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression)
+		for _, key := range SortedKeys(node) {
+			newKey := modifyExpression(key, modifier)
+			pairs[newKey] = modifyExpression(node.Pairs[key], modifier)
+		}
+		node.Pairs = pairs
+	}
+
+	return modifier(node)
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+	for i, s := range statements {
+		if s == nil {
+			continue
+		}
+		if modified, ok := Modify(s, modifier).(Statement); ok {
+			statements[i] = modified
+		}
+	}
+	return statements
+}
+
+func modifyExpressions(expressions []Expression, modifier ModifierFunc) []Expression {
+	for i, e := range expressions {
+		expressions[i] = modifyExpression(e, modifier)
+	}
+	return expressions
+}
+
+func modifyExpression(e Expression, modifier ModifierFunc) Expression {
+	if e == nil {
+		return nil
+	}
+	if modified, ok := Modify(e, modifier).(Expression); ok {
+		return modified
+	}
+	return e
+}
+
+func modifyIdentifier(i *Identifier, modifier ModifierFunc) *Identifier {
+	if i == nil {
+		return nil
+	}
+	if modified, ok := Modify(i, modifier).(*Identifier); ok {
+		return modified
+	}
+	return i
+}
+
+func modifyBlock(b *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	if modified, ok := Modify(b, modifier).(*BlockStatement); ok {
+		return modified
+	}
+	return b
+}
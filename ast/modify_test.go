@@ -0,0 +1,326 @@
+package ast
+
+import (
+	"interpreter/token"
+	"reflect"
+	"testing"
+)
+
+func tokenLiteral(literal string) token.Token {
+	return token.Token{Type: token.STRING, Literal: literal}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if integer.Value != 1 {
+			return node
+		}
+
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{
+			one(),
+			two(),
+		},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&SliceExpression{Left: one(), Start: one(), End: one(), Step: one()},
+			&SliceExpression{Left: two(), Start: two(), End: two(), Step: two()},
+		},
+		{
+			&SliceExpression{Left: one(), End: one()},
+			&SliceExpression{Left: two(), End: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+				Alternative: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: &Identifier{Value: "x"}, Value: one()},
+			&LetStatement{Name: &Identifier{Value: "x"}, Value: two()},
+		},
+		{
+			&LetStatement{
+				Pattern: &HashPattern{Pairs: []*PatternPair{
+					{Key: one(), Pattern: &ArrayPattern{Elements: []Expression{&Identifier{Value: "a"}}}},
+				}},
+				Value: one(),
+			},
+			&LetStatement{
+				Pattern: &HashPattern{Pairs: []*PatternPair{
+					{Key: two(), Pattern: &ArrayPattern{Elements: []Expression{&Identifier{Value: "a"}}}},
+				}},
+				Value: two(),
+			},
+		},
+		{
+			&MatchExpression{Value: one(), Arms: []*MatchArm{
+				{Pattern: one(), Guard: one(), Body: one()},
+			}},
+			&MatchExpression{Value: two(), Arms: []*MatchArm{
+				{Pattern: two(), Guard: two(), Body: two()},
+			}},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+				Defaults:   []Expression{nil, one()},
+				Body:       &BlockStatement{},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+				Defaults:   []Expression{nil, two()},
+				Body:       &BlockStatement{},
+			},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: one()},
+				}},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: two()},
+				}},
+			},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{two(), two()}},
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&SpreadExpression{Value: one()}}},
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&SpreadExpression{Value: two()}}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&TemplateLiteral{Segments: []string{"a", "b"}, Values: []Expression{one()}},
+			&TemplateLiteral{Segments: []string{"a", "b"}, Values: []Expression{two()}},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+
+	hashLiteral := &HashLiteral{
+		Pairs: map[Expression]Expression{
+			one(): one(),
+			one(): one(),
+		},
+	}
+
+	Modify(hashLiteral, turnOneIntoTwo)
+
+	for key, val := range hashLiteral.Pairs {
+		key, _ := key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("value is %d, want=%d", key.Value, 2)
+		}
+		val, _ := val.(*IntegerLiteral)
+		if val.Value != 2 {
+			t.Errorf("value is %d, want=%d", val.Value, 2)
+		}
+	}
+}
+
+func TestModifyReplacesNodes(t *testing.T) {
+	renameX := func(node Node) Node {
+		ident, ok := node.(*Identifier)
+		if !ok || ident.Value != "x" {
+			return node
+		}
+		return &Identifier{Value: "renamed"}
+	}
+
+	function := &FunctionLiteral{
+		Parameters: []*Identifier{{Value: "x"}, {Value: "y"}},
+		Body: &BlockStatement{Statements: []Statement{
+			&ExpressionStatement{Expression: &InfixExpression{
+				Left:     &Identifier{Value: "x"},
+				Operator: "+",
+				Right:    &Identifier{Value: "y"},
+			}},
+		}},
+	}
+
+	Modify(function, renameX)
+
+	if function.Parameters[0].Value != "renamed" {
+		t.Errorf("parameter not renamed, got %s", function.Parameters[0].Value)
+	}
+	infix := function.Body.Statements[0].(*ExpressionStatement).Expression.(*InfixExpression)
+	if infix.Left.String() != "renamed" {
+		t.Errorf("identifier not renamed, got %s", infix.Left.String())
+	}
+}
+
+func TestModifyKeepsMismatchedReplacements(t *testing.T) {
+	toExpression := func(node Node) Node {
+		if _, ok := node.(*ExpressionStatement); ok {
+			return &IntegerLiteral{Value: 3}
+		}
+		return node
+	}
+
+	statement := &ExpressionStatement{Expression: &IntegerLiteral{Value: 1}}
+	program := &Program{Statements: []Statement{statement}}
+
+	Modify(program, toExpression)
+
+	if program.Statements[0] != statement {
+		t.Errorf("statement replaced by non-statement %T", program.Statements[0])
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := &Program{Statements: []Statement{
+		&LetStatement{
+			Name: &Identifier{Value: "f"},
+			Value: &FunctionLiteral{
+				Parameters: []*Identifier{{Value: "x"}, {Value: "y"}, {Value: "z"}},
+				Defaults:   []Expression{nil, &IntegerLiteral{Value: 1}, nil},
+				Variadic:   true,
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &InfixExpression{
+						Left:     &Identifier{Value: "x"},
+						Operator: "+",
+						Right:    &IntegerLiteral{Value: 1},
+					}},
+				}},
+				Name: "f",
+			},
+		},
+		&LetStatement{
+			Pattern: &ArrayPattern{
+				Elements: []Expression{&HashPattern{Pairs: []*PatternPair{
+					{Key: &IntegerLiteral{Value: 1}, Pattern: &Identifier{Value: "a"}},
+				}}},
+				Rest: &Identifier{Value: "b"},
+			},
+			Value: &Identifier{Value: "f"},
+		},
+		&ExpressionStatement{Expression: &CallExpression{
+			Function:  &Identifier{Value: "f"},
+			Arguments: []Expression{&SpreadExpression{Value: &IntegerLiteral{Value: 1}}},
+		}},
+		&ExpressionStatement{Expression: &TemplateLiteral{
+			Segments: []string{"a", ""},
+			Values:   []Expression{&IntegerLiteral{Value: 1}},
+		}},
+		&ExpressionStatement{Expression: &MatchExpression{
+			Value: &Identifier{Value: "f"},
+			Arms: []*MatchArm{{
+				Pattern: &ArrayPattern{Elements: []Expression{&IntegerLiteral{Value: 1}}},
+				Guard:   &Boolean{Value: true},
+				Body:    &IntegerLiteral{Value: 1},
+			}},
+		}},
+		&ExpressionStatement{Expression: &HashLiteral{Pairs: map[Expression]Expression{
+			&StringLiteral{Value: "a"}: &ArrayLiteral{Elements: []Expression{
+				&IndexExpression{Left: &Identifier{Value: "b"}, Index: &IntegerLiteral{Value: 1}},
+				&SliceExpression{
+					Left:  &Identifier{Value: "b"},
+					Start: &IntegerLiteral{Value: 1},
+					End:   &Identifier{Value: "c"},
+				},
+			}},
+		}}},
+	}}
+
+	copied := Copy(original)
+	if copied == Node(original) || copied.String() != original.String() {
+		t.Fatalf("copy differs from original.\nwant=%q\ngot=%q", original, copied)
+	}
+
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 2
+		}
+		return node
+	})
+
+	Inspect(original, func(node Node) bool {
+		if integer, ok := node.(*IntegerLiteral); ok && integer.Value != 1 {
+			t.Errorf("original modified through copy")
+		}
+		return true
+	})
+}
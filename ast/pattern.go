@@ -0,0 +1,57 @@
+package ast
+
+// Bindings returns the identifiers a pattern binds, in the order they
+// appear. A plain identifier is a pattern that binds itself.
+func Bindings(pattern Expression) []*Identifier {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		return []*Identifier{pattern}
+	case *ArrayPattern:
+		idents := []*Identifier{}
+		for _, e := range pattern.Elements {
+			idents = append(idents, Bindings(e)...)
+		}
+		if pattern.Rest != nil {
+			idents = append(idents, pattern.Rest)
+		}
+		return idents
+	case *HashPattern:
+		idents := []*Identifier{}
+		for _, pair := range pattern.Pairs {
+			idents = append(idents, Bindings(pair.Pattern)...)
+		}
+		return idents
+	}
+	return nil
+}
+
+// Bindings returns the identifiers the statement binds: its name, or the
+// identifiers in its pattern.
+func (ls *LetStatement) Bindings() []*Identifier {
+	if ls.Pattern != nil {
+		return Bindings(ls.Pattern)
+	}
+	if ls.Name != nil {
+		return []*Identifier{ls.Name}
+	}
+	return nil
+}
+
+// IsWildcard reports whether pattern is the identifier _, which in a match
+// arm matches any value without binding it.
+func IsWildcard(pattern Expression) bool {
+	ident, ok := pattern.(*Identifier)
+	return ok && ident.Value == "_"
+}
+
+// Bindings returns the identifiers the arm's pattern binds, leaving out
+// wildcards.
+func (ma *MatchArm) Bindings() []*Identifier {
+	idents := []*Identifier{}
+	for _, ident := range Bindings(ma.Pattern) {
+		if !IsWildcard(ident) {
+			idents = append(idents, ident)
+		}
+	}
+	return idents
+}
@@ -0,0 +1,94 @@
+package ast
+
+import "interpreter/token"
+
+// Pos returns the position of the first token of node. Nodes built by hand
+// rather than by the parser have no position and report the zero value.
+func Pos(node Node) token.Position {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return Pos(node.Statements[0])
+		}
+	case *InfixExpression:
+		return Pos(node.Left)
+	case *CallExpression:
+		return Pos(node.Function)
+	case *IndexExpression:
+		return Pos(node.Left)
+	case *SliceExpression:
+		return Pos(node.Left)
+	case *LetStatement:
+		return node.Token.Pos
+	case *ReturnStatement:
+		return node.Token.Pos
+	case *ExpressionStatement:
+		return node.Token.Pos
+	case *BlockStatement:
+		return node.Token.Pos
+	case *Identifier:
+		return node.Token.Pos
+	case *IntegerLiteral:
+		return node.Token.Pos
+	case *Boolean:
+		return node.Token.Pos
+	case *StringLiteral:
+		return node.Token.Pos
+	case *TemplateLiteral:
+		return node.Token.Pos
+	case *PrefixExpression:
+		return node.Token.Pos
+	case *IfExpression:
+		return node.Token.Pos
+	case *FunctionLiteral:
+		return node.Token.Pos
+	case *SpreadExpression:
+		return node.Token.Pos
+	case *MacroLiteral:
+		return node.Token.Pos
+	case *ArrayLiteral:
+		return node.Token.Pos
+	case *HashLiteral:
+		return node.Token.Pos
+	case *ArrayPattern:
+		return node.Token.Pos
+	case *HashPattern:
+		return node.Token.Pos
+	case *MatchExpression:
+		return node.Token.Pos
+	}
+	return token.Position{}
+}
+
+// EndLine returns the last source line known to belong to node: the line
+// of its last token that is kept in the AST, or of a closing bracket.
+func EndLine(node Node) int {
+	line := Pos(node).Line
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+		if l := Pos(n).Line; l > line {
+			line = l
+		}
+		switch n := n.(type) {
+		case *BlockStatement:
+			line = maxLine(line, n.Rbrace)
+		case *ArrayLiteral:
+			line = maxLine(line, n.Rbracket)
+		case *HashLiteral:
+			line = maxLine(line, n.Rbrace)
+		case *MatchExpression:
+			line = maxLine(line, n.Rbrace)
+		}
+		return true
+	})
+	return line
+}
+
+func maxLine(line int, pos token.Position) int {
+	if pos.Line > line {
+		return pos.Line
+	}
+	return line
+}
@@ -0,0 +1,160 @@
+package ast
+
+import "sort"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of
+// node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order. Nil children, such as a
+// missing else branch, are skipped. Hash literal pairs are visited key
+// first, in the same order the compiler emits them.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *LetStatement:
+		walkIdentifier(v, n.Name)
+		walkExpression(v, n.Pattern)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		walkBlock(v, n.Consequence)
+		walkBlock(v, n.Alternative)
+	case *FunctionLiteral:
+		for i, p := range n.Parameters {
+			if pattern := n.Pattern(i); pattern != nil {
+				walkExpression(v, pattern)
+			} else {
+				walkIdentifier(v, p)
+			}
+			walkExpression(v, n.Default(i))
+		}
+		walkBlock(v, n.Body)
+	case *ArrayPattern:
+		walkExpressions(v, n.Elements)
+		walkIdentifier(v, n.Rest)
+	case *HashPattern:
+		for _, pair := range n.Pairs {
+			walkExpression(v, pair.Key)
+			walkExpression(v, pair.Pattern)
+		}
+	case *MatchExpression:
+		walkExpression(v, n.Value)
+		for _, arm := range n.Arms {
+			walkExpression(v, arm.Pattern)
+			walkExpression(v, arm.Guard)
+			walkExpression(v, arm.Body)
+		}
+	case *MacroLiteral:
+		for _, p := range n.Parameters {
+			walkIdentifier(v, p)
+		}
+		walkBlock(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *SpreadExpression:
+		walkExpression(v, n.Value)
+	case *TemplateLiteral:
+		walkExpressions(v, n.Values)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *SliceExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Start)
+		walkExpression(v, n.End)
+		walkExpression(v, n.Step)
+	case *HashLiteral:
+		for _, key := range SortedKeys(n) {
+			walkExpression(v, key)
+			walkExpression(v, n.Pairs[key])
+		}
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral:
+		// leaves
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order, calling f for each node.
+// If f returns true, Inspect invokes f for the children of node, followed
+// by a call of f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// SortedKeys returns the keys of a hash literal ordered by their source
+// representation, which gives a stable order for the unordered Pairs map.
+func SortedKeys(hl *HashLiteral) []Expression {
+	keys := []Expression{}
+	for k := range hl.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, s := range statements {
+		if s != nil {
+			Walk(v, s)
+		}
+	}
+}
+
+func walkExpressions(v Visitor, expressions []Expression) {
+	for _, e := range expressions {
+		walkExpression(v, e)
+	}
+}
+
+func walkExpression(v Visitor, e Expression) {
+	if e != nil {
+		Walk(v, e)
+	}
+}
+
+func walkIdentifier(v Visitor, i *Identifier) {
+	if i != nil {
+		Walk(v, i)
+	}
+}
+
+func walkBlock(v Visitor, b *BlockStatement) {
+	if b != nil {
+		Walk(v, b)
+	}
+}
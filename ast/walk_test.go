@@ -0,0 +1,235 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+
+	tests := []struct {
+		input    Node
+		expected []string
+	}{
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			[]string{"*ast.Program", "*ast.ExpressionStatement", "*ast.IntegerLiteral"},
+		},
+		{
+			&LetStatement{Name: ident("x"), Value: one()},
+			[]string{"*ast.LetStatement", "*ast.Identifier", "*ast.IntegerLiteral"},
+		},
+		{
+			&LetStatement{
+				Pattern: &ArrayPattern{Elements: []Expression{ident("a")}, Rest: ident("b")},
+				Value:   ident("x"),
+			},
+			[]string{"*ast.LetStatement", "*ast.ArrayPattern", "*ast.Identifier",
+				"*ast.Identifier", "*ast.Identifier"},
+		},
+		{
+			&HashPattern{Pairs: []*PatternPair{
+				{Key: &StringLiteral{Value: "a"}, Pattern: ident("a")},
+				{Key: one(), Pattern: &ArrayPattern{}},
+			}},
+			[]string{"*ast.HashPattern", "*ast.StringLiteral", "*ast.Identifier",
+				"*ast.IntegerLiteral", "*ast.ArrayPattern"},
+		},
+		{
+			&MatchExpression{Value: ident("x"), Arms: []*MatchArm{
+				{Pattern: one(), Body: ident("a")},
+				{Pattern: ident("n"), Guard: &Boolean{Value: true}, Body: ident("n")},
+			}},
+			[]string{"*ast.MatchExpression", "*ast.Identifier", "*ast.IntegerLiteral",
+				"*ast.Identifier", "*ast.Identifier", "*ast.Boolean", "*ast.Identifier"},
+		},
+		{
+			&ReturnStatement{ReturnValue: ident("x")},
+			[]string{"*ast.ReturnStatement", "*ast.Identifier"},
+		},
+		{
+			&BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &Boolean{Value: true}},
+			}},
+			[]string{"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Boolean"},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			[]string{"*ast.PrefixExpression", "*ast.IntegerLiteral"},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: &StringLiteral{Value: "a"}},
+			[]string{"*ast.InfixExpression", "*ast.IntegerLiteral", "*ast.StringLiteral"},
+		},
+		{
+			&TemplateLiteral{Segments: []string{"a", "", "b"}, Values: []Expression{one(), ident("x")}},
+			[]string{"*ast.TemplateLiteral", "*ast.IntegerLiteral", "*ast.Identifier"},
+		},
+		{
+			&IfExpression{
+				Condition:   &Boolean{Value: true},
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("y")}}},
+			},
+			[]string{"*ast.IfExpression", "*ast.Boolean",
+				"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.IntegerLiteral",
+				"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier"},
+		},
+		{
+			&IfExpression{
+				Condition:   &Boolean{Value: true},
+				Consequence: &BlockStatement{},
+			},
+			[]string{"*ast.IfExpression", "*ast.Boolean", "*ast.BlockStatement"},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("a"), ident("b")},
+				Body:       &BlockStatement{Statements: []Statement{&ReturnStatement{ReturnValue: ident("a")}}},
+			},
+			[]string{"*ast.FunctionLiteral", "*ast.Identifier", "*ast.Identifier",
+				"*ast.BlockStatement", "*ast.ReturnStatement", "*ast.Identifier"},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("a"), ident("b"), ident("c")},
+				Defaults:   []Expression{nil, ident("a"), nil},
+				Variadic:   true,
+				Body:       &BlockStatement{},
+			},
+			[]string{"*ast.FunctionLiteral", "*ast.Identifier", "*ast.Identifier",
+				"*ast.Identifier", "*ast.Identifier", "*ast.BlockStatement"},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{ident("a"), ident("[b]")},
+				Defaults:   []Expression{nil, &ArrayLiteral{}},
+				Patterns:   []Expression{nil, &ArrayPattern{Elements: []Expression{ident("b")}}},
+				Body:       &BlockStatement{},
+			},
+			[]string{"*ast.FunctionLiteral", "*ast.Identifier", "*ast.ArrayPattern",
+				"*ast.Identifier", "*ast.ArrayLiteral", "*ast.BlockStatement"},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{ident("a")},
+				Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("a")}}},
+			},
+			[]string{"*ast.MacroLiteral", "*ast.Identifier",
+				"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.Identifier"},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{one(), ident("x")}},
+			[]string{"*ast.CallExpression", "*ast.Identifier", "*ast.IntegerLiteral", "*ast.Identifier"},
+		},
+		{
+			&CallExpression{Function: ident("f"), Arguments: []Expression{&SpreadExpression{Value: ident("xs")}}},
+			[]string{"*ast.CallExpression", "*ast.Identifier", "*ast.SpreadExpression", "*ast.Identifier"},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), &StringLiteral{Value: "a"}}},
+			[]string{"*ast.ArrayLiteral", "*ast.IntegerLiteral", "*ast.StringLiteral"},
+		},
+		{
+			&IndexExpression{Left: ident("a"), Index: one()},
+			[]string{"*ast.IndexExpression", "*ast.Identifier", "*ast.IntegerLiteral"},
+		},
+		{
+			&SliceExpression{Left: ident("a"), Start: one(), End: ident("n")},
+			[]string{"*ast.SliceExpression", "*ast.Identifier", "*ast.IntegerLiteral", "*ast.Identifier"},
+		},
+		{
+			&SliceExpression{Left: ident("a"), Step: one()},
+			[]string{"*ast.SliceExpression", "*ast.Identifier", "*ast.IntegerLiteral"},
+		},
+		{
+			&HashLiteral{Pairs: map[Expression]Expression{
+				&StringLiteral{Token: tokenLiteral("b"), Value: "b"}: &Boolean{Value: true},
+				&StringLiteral{Token: tokenLiteral("a"), Value: "a"}: one(),
+			}},
+			[]string{"*ast.HashLiteral", "*ast.StringLiteral", "*ast.IntegerLiteral",
+				"*ast.StringLiteral", "*ast.Boolean"},
+		},
+	}
+
+	for _, tt := range tests {
+		visited := []string{}
+		Inspect(tt.input, func(node Node) bool {
+			if node != nil {
+				visited = append(visited, fmt.Sprintf("%T", node))
+			}
+			return true
+		})
+
+		if !reflect.DeepEqual(visited, tt.expected) {
+			t.Errorf("wrong visit order for %T.\nwant=%v\ngot=%v", tt.input,
+				tt.expected, visited)
+		}
+	}
+}
+
+type depthVisitor struct {
+	depth    int
+	maxDepth *int
+	exits    *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.exits++
+		return nil
+	}
+	if v.depth > *v.maxDepth {
+		*v.maxDepth = v.depth
+	}
+	return depthVisitor{depth: v.depth + 1, maxDepth: v.maxDepth, exits: v.exits}
+}
+
+func TestWalkVisitor(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &PrefixExpression{
+			Operator: "!",
+			Right:    &Boolean{Value: true},
+		}},
+	}}
+
+	maxDepth, exits := 0, 0
+	Walk(depthVisitor{maxDepth: &maxDepth, exits: &exits}, program)
+
+	if maxDepth != 3 {
+		t.Errorf("wrong max depth. want=3, got=%d", maxDepth)
+	}
+	if exits != 4 {
+		t.Errorf("wrong number of nil visits. want=4, got=%d", exits)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &FunctionLiteral{
+			Parameters: []*Identifier{{Value: "x"}},
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &Identifier{Value: "x"}},
+			}},
+		}},
+		&ExpressionStatement{Expression: &Identifier{Value: "y"}},
+	}}
+
+	identifiers := []string{}
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case *FunctionLiteral:
+			return false
+		case *Identifier:
+			identifiers = append(identifiers, node.Value)
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(identifiers, []string{"y"}) {
+		t.Errorf("wrong identifiers. want=[y], got=%v", identifiers)
+	}
+}
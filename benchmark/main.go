@@ -9,10 +9,13 @@ import (
 	"interpreter/object"
 	"interpreter/parser"
 	"interpreter/vm"
+	"os"
 	"time"
 )
 
 var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var noOptimize = flag.Bool("O0", false, "with the vm engine, disable compiler optimizations")
+var profile = flag.String("profile", "", "with the vm engine, print a script profile and write it for pprof to `file`")
 
 var input = `
 let fibonacci = fn(x) {
@@ -41,6 +44,7 @@ func main() {
 	fmt.Println(*engine)
 	if *engine == "vm" {
 		comp := compiler.New()
+		comp.SetOptimizations(!*noOptimize)
 		err := comp.Compile(program)
 		if err != nil {
 			fmt.Printf("Compilation failed:\n %s\n", err)
@@ -48,6 +52,13 @@ func main() {
 		}
 
 		machine := vm.New(comp.Bytecode())
+		var profiler *vm.Profiler
+		if *profile != "" {
+			profiler = vm.NewProfiler(vm.DefaultSampleInterval)
+			profiler.Filename = "fibonacci.monkey"
+			machine.SetProfiler(profiler)
+		}
+
 		start := time.Now()
 		err = machine.Run()
 		if err != nil {
@@ -57,6 +68,13 @@ func main() {
 
 		duration = time.Since(start)
 		result = machine.LastPoppedStackElem()
+
+		if profiler != nil {
+			profiler.WriteReport(os.Stdout)
+			if err := writeProfile(profiler, *profile); err != nil {
+				fmt.Printf("Writing profile failed:\n %s\n", err)
+			}
+		}
 	} else {
 		env := object.NewEnvironment()
 		start := time.Now()
@@ -66,3 +84,12 @@ func main() {
 
 	fmt.Printf("engine=%s, result=%s, duration=%s\n", *engine, result.Inspect(), duration)
 }
+
+func writeProfile(profiler *vm.Profiler, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return profiler.WritePprof(f)
+}
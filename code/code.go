@@ -45,6 +45,25 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpConstantWide
+	OpClosureWide
+	OpGetLocalWide
+	OpSetLocalWide
+	OpCallWide
+	OpGetBuiltinWide
+	OpGetFreeWide
+	OpJumpIfArgument
+	OpExtend
+	OpCallSpread
+	OpDestructureArray
+	OpDestructureHash
+	OpArrayRest
+	OpMatchArray
+	OpMatchHash
+	OpMatchValue
+	OpNoMatch
+	OpConcat
+	OpSlice
 )
 
 var definitions = map[Opcode]*Definition{
@@ -78,6 +97,53 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	// The wide variants take operands that do not fit the operands of
+	// the plain opcodes.
+	OpConstantWide:   {"OpConstantWide", []int{4}},
+	OpClosureWide:    {"OpClosureWide", []int{4, 2}},
+	OpGetLocalWide:   {"OpGetLocalWide", []int{2}},
+	OpSetLocalWide:   {"OpSetLocalWide", []int{2}},
+	OpCallWide:       {"OpCallWide", []int{2}},
+	OpGetBuiltinWide: {"OpGetBuiltinWide", []int{2}},
+	OpGetFreeWide:    {"OpGetFreeWide", []int{2}},
+
+	// OpJumpIfArgument jumps to its first operand if the call passed the
+	// parameter numbered by the second, skipping its default value.
+	OpJumpIfArgument: {"OpJumpIfArgument", []int{2, 2}},
+	// OpExtend appends the elements of the array on top of the stack to
+	// the array below it, building the arguments of OpCallSpread.
+	OpExtend:     {"OpExtend", []int{}},
+	OpCallSpread: {"OpCallSpread", []int{}},
+
+	// OpDestructureArray and OpDestructureHash fail unless the value on top
+	// of the stack is an array or a hash, and leave it there. OpArrayRest
+	// replaces the array on top of the stack with a new one holding its
+	// elements from the operand on.
+	OpDestructureArray: {"OpDestructureArray", []int{}},
+	OpDestructureHash:  {"OpDestructureHash", []int{}},
+	OpArrayRest:        {"OpArrayRest", []int{2}},
+
+	// The match opcodes test the value of a match expression. OpMatchArray
+	// replaces the value on top of the stack with whether it is an array of
+	// exactly as many elements as its first operand, or at least as many if
+	// its second operand is 1. OpMatchHash pops as many keys as its operand
+	// and the value below them, and pushes whether the value is a hash
+	// holding all of the keys. OpMatchValue replaces the two values on top
+	// of the stack with whether they are equal. OpNoMatch fails with the
+	// value on top of the stack when no arm matches it.
+	OpMatchArray: {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:  {"OpMatchHash", []int{2}},
+	OpMatchValue: {"OpMatchValue", []int{}},
+	OpNoMatch:    {"OpNoMatch", []int{}},
+
+	// OpConcat replaces as many values as its operand with a string that
+	// joins them, converted as by object.ToString.
+	OpConcat: {"OpConcat", []int{2}},
+	// OpSlice replaces a string or an array and the start, end and step
+	// above it with the part of it between start and end, taking every
+	// step-th element. A bound that was left out is null.
+	OpSlice: {"OpSlice", []int{}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -88,10 +154,31 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// Make encodes an instruction. It panics if the operands do not fit op's
+// definition; use MakeChecked when they come from user input.
 func Make(op Opcode, operands ...int) []byte {
+	instruction, err := MakeChecked(op, operands...)
+	if err != nil {
+		panic(err)
+	}
+	return instruction
+}
+
+// MakeChecked encodes an instruction like Make, but returns an error if op
+// is undefined, there are too many operands or an operand does not fit its
+// width. Missing operands are encoded as zero.
+func MakeChecked(op Opcode, operands ...int) ([]byte, error) {
 	def, ok := definitions[op]
 	if !ok {
-		return []byte{}
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	if len(operands) > len(def.OperandWidths) {
+		return nil, fmt.Errorf("%s takes %d operands, got %d", def.Name, len(def.OperandWidths), len(operands))
+	}
+	for i, o := range operands {
+		if max := maxOperand(def.OperandWidths[i]); o < 0 || o > max {
+			return nil, fmt.Errorf("operand %d of %s out of range: %d does not fit in [0, %d]", i, def.Name, o, max)
+		}
 	}
 
 	instructionLen := 1
@@ -106,6 +193,8 @@ func Make(op Opcode, operands ...int) []byte {
 	for i, o := range operands {
 		width := def.OperandWidths[i]
 		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
 		case 1:
@@ -114,7 +203,12 @@ func Make(op Opcode, operands ...int) []byte {
 		offset += width
 	}
 
-	return instruction
+	return instruction, nil
+}
+
+// maxOperand returns the largest operand that fits in width bytes.
+func maxOperand(width int) int {
+	return 1<<(8*width) - 1
 }
 
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
@@ -123,6 +217,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 
 	for i, width := range def.OperandWidths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -134,6 +230,10 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	return operands, offset
 }
 
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
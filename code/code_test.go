@@ -12,6 +12,11 @@ func TestMake(t *testing.T) {
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
 		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+		{OpConstantWide, []int{65536}, []byte{byte(OpConstantWide), 0, 1, 0, 0}},
+		{OpClosureWide, []int{70000, 256}, []byte{byte(OpClosureWide), 0, 1, 17, 112, 1, 0}},
+		{OpArrayRest, []int{2}, []byte{byte(OpArrayRest), 0, 2}},
+		{OpMatchArray, []int{258, 1}, []byte{byte(OpMatchArray), 1, 2, 1}},
+		{OpConcat, []int{3}, []byte{byte(OpConcat), 0, 3}},
 	}
 
 	for _, tt := range tests {
@@ -64,6 +69,10 @@ func TestReadOperands(t *testing.T) {
 		{OpConstant, []int{65535}, 2},
 		{OpGetLocal, []int{255}, 1},
 		{OpClosure, []int{65535, 255}, 3},
+		{OpConstantWide, []int{1 << 24}, 4},
+		{OpClosureWide, []int{65536, 65535}, 6},
+		{OpGetLocalWide, []int{65535}, 2},
+		{OpCallWide, []int{300}, 2},
 	}
 
 	for _, tt := range tests {
@@ -85,3 +94,36 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeChecked(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected string
+	}{
+		{OpGetLocal, []int{256}, "operand 0 of OpGetLocal out of range: 256 does not fit in [0, 255]"},
+		{OpCall, []int{-1}, "operand 0 of OpCall out of range: -1 does not fit in [0, 255]"},
+		{OpConstant, []int{65536}, "operand 0 of OpConstant out of range: 65536 does not fit in [0, 65535]"},
+		{OpClosure, []int{1, 300}, "operand 1 of OpClosure out of range: 300 does not fit in [0, 255]"},
+		{OpAdd, []int{1}, "OpAdd takes 0 operands, got 1"},
+		{Opcode(255), []int{}, "opcode 255 undefined"},
+	}
+
+	for _, tt := range tests {
+		_, err := MakeChecked(tt.op, tt.operands...)
+		if err == nil {
+			t.Errorf("expected an error for %d %v", tt.op, tt.operands)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Make did not panic on an operand that does not fit")
+		}
+	}()
+	Make(OpGetLocal, 256)
+}
@@ -0,0 +1,57 @@
+package code
+
+import "sort"
+
+// LineTable maps instruction offsets to the source lines they were compiled
+// from. Each entry covers the instructions from its offset up to the next
+// entry's offset.
+type LineTable []LineEntry
+
+type LineEntry struct {
+	Offset int
+	Line   int
+}
+
+// Add records that the instruction at offset, and those after it, come from
+// line. Offsets must be added in increasing order.
+func (t LineTable) Add(offset, line int) LineTable {
+	if n := len(t); n > 0 {
+		if t[n-1].Line == line {
+			return t
+		}
+		if t[n-1].Offset == offset {
+			t[n-1].Line = line
+			return t
+		}
+	}
+	return append(t, LineEntry{Offset: offset, Line: line})
+}
+
+// Truncate drops the entries for instructions at or after offset.
+func (t LineTable) Truncate(offset int) LineTable {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset >= offset })
+	return t[:i]
+}
+
+// Line returns the line of the instruction at offset, or 0 if unknown.
+func (t LineTable) Line(offset int) int {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return t[i-1].Line
+}
+
+// Lines returns the distinct lines in the table in increasing order.
+func (t LineTable) Lines() []int {
+	seen := make(map[int]bool)
+	lines := []int{}
+	for _, e := range t {
+		if !seen[e.Line] {
+			seen[e.Line] = true
+			lines = append(lines, e.Line)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
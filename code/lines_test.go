@@ -0,0 +1,41 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLineTable(t *testing.T) {
+	var table LineTable
+	table = table.Add(0, 1)
+	table = table.Add(3, 1)
+	table = table.Add(3, 2)
+	table = table.Add(5, 3)
+	table = table.Add(9, 2)
+
+	expected := LineTable{{0, 1}, {3, 2}, {5, 3}, {9, 2}}
+	if !reflect.DeepEqual(table, expected) {
+		t.Fatalf("wrong table. want=%v, got=%v", expected, table)
+	}
+
+	tests := []struct {
+		offset int
+		line   int
+	}{
+		{-1, 0}, {0, 1}, {2, 1}, {3, 2}, {4, 2}, {5, 3}, {8, 3}, {9, 2}, {100, 2},
+	}
+	for _, tt := range tests {
+		if got := table.Line(tt.offset); got != tt.line {
+			t.Errorf("wrong line for offset %d. want=%d, got=%d", tt.offset, tt.line, got)
+		}
+	}
+
+	if got := table.Lines(); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("wrong lines. want=%v, got=%v", []int{1, 2, 3}, got)
+	}
+
+	truncated := table.Truncate(5)
+	if !reflect.DeepEqual(truncated, LineTable{{0, 1}, {3, 2}}) {
+		t.Errorf("wrong truncated table: %v", truncated)
+	}
+}
@@ -0,0 +1,208 @@
+package code
+
+// peephole is an instruction decoded for Optimize. Jumps refer to their
+// target instruction rather than to an offset, so instructions can be
+// removed without breaking them.
+type peephole struct {
+	op       Opcode
+	operands []int
+	line     int
+	index    int
+	target   *peephole
+	dead     bool
+}
+
+// isJump reports whether op's first operand is the offset of an
+// instruction.
+func isJump(op Opcode) bool {
+	return op == OpJump || op == OpJumpNotTruthy || op == OpJumpIfArgument
+}
+
+// isPurePush reports whether op only pushes a value and cannot fail, so
+// it can be dropped together with an OpPop of its value.
+func isPurePush(op Opcode) bool {
+	switch op {
+	case OpConstant, OpConstantWide, OpTrue, OpFalse, OpNull, OpGetGlobal, OpGetLocal,
+		OpGetLocalWide, OpGetBuiltin, OpGetBuiltinWide, OpGetFree, OpGetFreeWide,
+		OpCurrentClosure:
+		return true
+	}
+	return false
+}
+
+// Optimize rewrites ins with a peephole pass and returns it with its line
+// table adjusted to match. It threads jumps to jumps, removes jumps to the
+// next instruction, conditional jumps on constant conditions, values that
+// are pushed only to be popped and code that cannot be reached. The last
+// instruction is kept, so the value a program pops last does not change.
+func Optimize(ins Instructions, lines LineTable) (Instructions, LineTable) {
+	code := decode(ins, lines)
+	if code == nil {
+		return ins, lines
+	}
+
+	for rewrite(code) {
+	}
+
+	return encode(code)
+}
+
+// rewrite makes one pass over the live instructions of code, applying
+// every rewrite it can, and reports whether it changed anything. Later
+// rewrites in a pass see the effect of earlier ones; the jump targets it
+// starts with only grow during the pass, which can only keep it from
+// rewriting, so Optimize repeats it until nothing changes.
+func rewrite(code []*peephole) bool {
+	changed := false
+	live := liveInstructions(code)
+	if len(live) < 2 {
+		// Only the end marker: there is nothing to rewrite.
+		return false
+	}
+	targets := jumpTargets(code, live)
+	last := live[len(live)-2]
+
+	for i, in := range live[:len(live)-1] {
+		if in.dead {
+			continue
+		}
+		next := live[i+1]
+		for next.dead {
+			next = code[next.index+1]
+		}
+		if in.target != nil {
+			in.target = resolve(code, in.target)
+		}
+
+		switch {
+		case isJump(in.op) && in.target.op == OpJump && in.target != in && in.target.target != in.target:
+			// A jump to a jump goes straight to the final target.
+			in.target = resolve(code, in.target.target)
+			targets[in.target] = true
+			changed = true
+		case isJump(in.op) && in.target == next:
+			// A jump to the next instruction only pops the condition,
+			// if it has one.
+			if in.op == OpJumpNotTruthy {
+				in.op, in.operands, in.target = OpPop, nil, nil
+			} else {
+				in.dead = true
+			}
+			changed = true
+		case next.op == OpJumpNotTruthy && !targets[next]:
+			switch in.op {
+			case OpTrue:
+				in.dead, next.dead = true, true
+				changed = true
+			case OpFalse, OpNull:
+				in.dead = true
+				next.op = OpJump
+				changed = true
+			}
+		case isPurePush(in.op) && next.op == OpPop && !targets[next] && next != last:
+			in.dead, next.dead = true, true
+			changed = true
+		case in.op == OpJump || in.op == OpReturnValue || in.op == OpReturn:
+			for j := i + 1; j < len(live)-1 && !targets[live[j]]; j++ {
+				if !live[j].dead {
+					live[j].dead = true
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// decode splits ins into instructions, followed by an end marker that
+// jumps past the last instruction refer to. It returns nil for
+// instructions it cannot decode.
+func decode(ins Instructions, lines LineTable) []*peephole {
+	code := []*peephole{}
+	byOffset := make(map[int]*peephole)
+
+	for offset := 0; offset < len(ins); {
+		def, err := Lookup(ins[offset])
+		if err != nil {
+			return nil
+		}
+		operands, read := ReadOperands(def, ins[offset+1:])
+		in := &peephole{op: Opcode(ins[offset]), operands: operands, line: lines.Line(offset), index: len(code)}
+		code = append(code, in)
+		byOffset[offset] = in
+		offset += 1 + read
+	}
+	end := &peephole{index: len(code)}
+	code = append(code, end)
+	byOffset[len(ins)] = end
+
+	for _, in := range code {
+		if isJump(in.op) {
+			target, ok := byOffset[in.operands[0]]
+			if !ok {
+				return nil
+			}
+			in.target = target
+		}
+	}
+	return code
+}
+
+// resolve returns the instruction that executes when control reaches in:
+// in itself or, if it was removed, the next instruction that was not.
+// Instructions are only removed where that makes no difference.
+func resolve(code []*peephole, in *peephole) *peephole {
+	for in.dead {
+		in = code[in.index+1]
+	}
+	return in
+}
+
+// liveInstructions returns the instructions that have not been removed,
+// ending with the end marker.
+func liveInstructions(code []*peephole) []*peephole {
+	live := []*peephole{}
+	for _, in := range code {
+		if !in.dead {
+			live = append(live, in)
+		}
+	}
+	return live
+}
+
+func jumpTargets(code, live []*peephole) map[*peephole]bool {
+	targets := make(map[*peephole]bool)
+	for _, in := range live {
+		if in.target != nil {
+			in.target = resolve(code, in.target)
+			targets[in.target] = true
+		}
+	}
+	return targets
+}
+
+func encode(code []*peephole) (Instructions, LineTable) {
+	live := liveInstructions(code)
+
+	offsets := make(map[*peephole]int)
+	offset := 0
+	for _, in := range live {
+		offsets[in] = offset
+		if in.index < len(code)-1 {
+			offset += len(Make(in.op, in.operands...))
+		}
+	}
+
+	ins := Instructions{}
+	var lines LineTable
+	for _, in := range live[:len(live)-1] {
+		if in.line > 0 {
+			lines = lines.Add(len(ins), in.line)
+		}
+		if in.target != nil {
+			in.operands = append([]int{offsets[resolve(code, in.target)]}, in.operands[1:]...)
+		}
+		ins = append(ins, Make(in.op, in.operands...)...)
+	}
+	return ins, lines
+}
@@ -0,0 +1,217 @@
+package code
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         []Instructions
+		lines         LineTable
+		expected      []Instructions
+		expectedLines LineTable
+	}{
+		{
+			name:     "no instructions",
+			input:    []Instructions{},
+			expected: []Instructions{},
+		},
+		{
+			name: "values pushed only to be popped",
+			input: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpPop),
+				Make(OpGetGlobal, 1),
+				Make(OpPop),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			lines: LineTable{{0, 1}, {4, 2}, {8, 3}},
+			expected: []Instructions{
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expectedLines: LineTable{{0, 3}},
+		},
+		{
+			name: "default values",
+			input: []Instructions{
+				Make(OpJumpIfArgument, 5, 0),
+				Make(OpJumpIfArgument, 14, 1),
+				Make(OpGetLocal, 0),
+				Make(OpSetLocal, 1),
+				Make(OpGetLocal, 1),
+				Make(OpReturnValue),
+			},
+			lines: LineTable{{0, 1}},
+			expected: []Instructions{
+				Make(OpJumpIfArgument, 9, 1),
+				Make(OpGetLocal, 0),
+				Make(OpSetLocal, 1),
+				Make(OpGetLocal, 1),
+				Make(OpReturnValue),
+			},
+			expectedLines: LineTable{{0, 1}},
+		},
+		{
+			name: "true condition",
+			input: []Instructions{
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpPop),
+				Make(OpConstant, 1),
+				Make(OpPop),
+			},
+			lines: LineTable{{0, 1}, {12, 2}},
+			expected: []Instructions{
+				Make(OpConstant, 1),
+				Make(OpPop),
+			},
+			expectedLines: LineTable{{0, 2}},
+		},
+		{
+			name: "false condition",
+			input: []Instructions{
+				Make(OpFalse),
+				Make(OpJumpNotTruthy, 10),
+				Make(OpConstant, 0),
+				Make(OpJump, 11),
+				Make(OpNull),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpNull),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "jump to a jump",
+			input: []Instructions{
+				Make(OpGetLocal, 0),
+				Make(OpJumpNotTruthy, 22),
+				Make(OpGetLocal, 1),
+				Make(OpJumpNotTruthy, 16),
+				Make(OpConstant, 0),
+				Make(OpJump, 19),
+				Make(OpConstant, 1),
+				Make(OpJump, 25),
+				Make(OpConstant, 2),
+				Make(OpReturnValue),
+			},
+			lines: LineTable{{0, 1}, {10, 2}, {16, 3}, {19, 4}, {22, 5}, {25, 6}},
+			expected: []Instructions{
+				Make(OpGetLocal, 0),
+				Make(OpJumpNotTruthy, 22),
+				Make(OpGetLocal, 1),
+				Make(OpJumpNotTruthy, 16),
+				Make(OpConstant, 0),
+				Make(OpJump, 25),
+				Make(OpConstant, 1),
+				Make(OpJump, 25),
+				Make(OpConstant, 2),
+				Make(OpReturnValue),
+			},
+			expectedLines: LineTable{{0, 1}, {10, 2}, {16, 3}, {19, 4}, {22, 5}, {25, 6}},
+		},
+		{
+			name: "unreachable code after return",
+			input: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpReturnValue),
+				Make(OpConstant, 1),
+				Make(OpReturnValue),
+			},
+			lines: LineTable{{0, 1}, {4, 2}},
+			expected: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpReturnValue),
+			},
+			expectedLines: LineTable{{0, 1}},
+		},
+		{
+			name: "jump targets move with removed code",
+			input: []Instructions{
+				Make(OpGetGlobal, 0),
+				Make(OpJumpNotTruthy, 14),
+				Make(OpNull),
+				Make(OpPop),
+				Make(OpGetGlobal, 1),
+				Make(OpJump, 17),
+				Make(OpGetGlobal, 2),
+				Make(OpReturnValue),
+			},
+			lines: LineTable{{0, 1}, {6, 2}, {8, 3}, {14, 4}, {17, 5}},
+			expected: []Instructions{
+				Make(OpGetGlobal, 0),
+				Make(OpJumpNotTruthy, 12),
+				Make(OpGetGlobal, 1),
+				Make(OpJump, 15),
+				Make(OpGetGlobal, 2),
+				Make(OpReturnValue),
+			},
+			expectedLines: LineTable{{0, 1}, {6, 3}, {12, 4}, {15, 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		ins, lines := Optimize(concat(tt.input), tt.lines)
+
+		expected := concat(tt.expected)
+		if ins.String() != expected.String() {
+			t.Errorf("%s: wrong instructions.\nwant=\n%s\ngot=\n%s", tt.name, expected, ins)
+		}
+		if !reflect.DeepEqual(lines, tt.expectedLines) {
+			t.Errorf("%s: wrong lines. want=%v, got=%v", tt.name, tt.expectedLines, lines)
+		}
+	}
+}
+
+func concat(s []Instructions) Instructions {
+	out := Instructions{}
+	for _, ins := range s {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+// TestOptimizePasses checks that a long program takes as few passes as a
+// short one, as each pass applies every rewrite it can.
+func TestOptimizePasses(t *testing.T) {
+	code := decode(manyStatements(20000), nil)
+
+	passes := 0
+	for rewrite(code) {
+		passes++
+	}
+	if passes > 1 {
+		t.Errorf("too many passes. want at most 1, got=%d", passes)
+	}
+
+	ins, _ := encode(code)
+	expected := concat([]Instructions{Make(OpConstant, 0), Make(OpPop)})
+	if ins.String() != expected.String() {
+		t.Errorf("wrong instructions.\nwant=\n%s\ngot=\n%s", expected, ins)
+	}
+}
+
+func BenchmarkOptimize(b *testing.B) {
+	ins := manyStatements(20000)
+	for i := 0; i < b.N; i++ {
+		Optimize(ins, nil)
+	}
+}
+
+// manyStatements returns the instructions of a program of n statements
+// that push a constant and pop it.
+func manyStatements(n int) Instructions {
+	parts := []Instructions{}
+	for i := 0; i < n; i++ {
+		parts = append(parts, Make(OpConstant, 0), Make(OpPop))
+	}
+	return concat(parts)
+}
@@ -5,7 +5,6 @@ import (
 	"interpreter/ast"
 	"interpreter/code"
 	"interpreter/object"
-	"sort"
 )
 
 type EmittedInstruction struct {
@@ -14,21 +13,34 @@ type EmittedInstruction struct {
 }
 
 type Compiler struct {
-	constants   []object.Object
-	symbolTable *SymbolTable
-	scopes      []CompilationScope
-	scopeIndex  int
+	constants     []object.Object
+	constantIndex map[constantKey]int
+	symbolTable   *SymbolTable
+	scopes        []CompilationScope
+	scopeIndex    int
+
+	// line is the source line of the node being compiled.
+	line int
+
+	noOptimize bool
+
+	// err is the first instruction that could not be encoded. Compile
+	// returns it once the node being compiled is done.
+	err error
 }
 
 type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	lines               code.LineTable
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Lines        code.LineTable
+	GlobalNames  []string
 }
 
 func New() *Compiler {
@@ -44,10 +56,11 @@ func New() *Compiler {
 	}
 
 	return &Compiler{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes:      []CompilationScope{mainScope},
-		scopeIndex:  0,
+		constants:     []object.Object{},
+		constantIndex: make(map[constantKey]int),
+		symbolTable:   symbolTable,
+		scopes:        []CompilationScope{mainScope},
+		scopeIndex:    0,
 	}
 }
 
@@ -55,6 +68,7 @@ func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler
 	compiler := New()
 	compiler.symbolTable = symbolTable
 	compiler.constants = constants
+	compiler.constantIndex = indexConstants(constants)
 	return compiler
 }
 
@@ -63,6 +77,12 @@ func (c *Compiler) currentInstructions() code.Instructions {
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if pos := ast.Pos(node); pos.IsValid() && pos.Line != c.line {
+		line := c.line
+		c.line = pos.Line
+		defer func() { c.line = line }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -78,6 +98,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.PrefixExpression:
+		if value, ok := constantValue(node); ok && !c.noOptimize {
+			c.emitConstant(value)
+			return nil
+		}
 		err := c.Compile(node.Right)
 		if err != nil {
 			return err
@@ -91,6 +115,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
 	case *ast.InfixExpression:
+		if value, ok := constantValue(node); ok && !c.noOptimize {
+			c.emitConstant(value)
+			return nil
+		}
 		if node.Operator == "<" {
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -140,6 +168,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpFalse)
 		}
 	case *ast.IfExpression:
+		if value, ok := constantValue(node.Condition); ok && !c.noOptimize {
+			if isTruthy(value) {
+				return c.compileTakenBranch(node.Consequence)
+			}
+			return c.compileTakenBranch(node.Alternative)
+		}
 		err := c.Compile(node.Condition)
 		if err != nil {
 			return err
@@ -175,6 +209,28 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		afterAlternativePos := len(c.currentInstructions())
 		c.changeOperand(jumpPos, afterAlternativePos)
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+	case *ast.TemplateLiteral:
+		if value, ok := constantValue(node); ok && !c.noOptimize {
+			c.emitConstant(value)
+			return nil
+		}
+		parts := 0
+		for i, segment := range node.Segments {
+			if segment != "" {
+				c.emit(code.OpConstant, c.addConstant(&object.String{Value: segment}))
+				parts++
+			}
+			if i < len(node.Values) {
+				err := c.Compile(node.Values[i])
+				if err != nil {
+					return err
+				}
+				parts++
+			}
+		}
+		c.emit(code.OpConcat, parts)
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -183,17 +239,20 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			return c.compilePattern(node.Pattern)
+		}
+
 		symbol := c.symbolTable.Define(node.Name.Value)
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
-		}
+		c.storeSymbol(symbol)
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
@@ -212,14 +271,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-		for _, k := range keys {
+		for _, k := range ast.SortedKeys(node) {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -240,6 +292,22 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err = c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
@@ -247,11 +315,12 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.symbolTable.DefineFunctionName(node.Name)
 		}
 
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
+		err := c.compileParameters(node)
+		if err != nil {
+			return err
 		}
 
-		err := c.Compile(node.Body)
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -266,16 +335,37 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		localNames := c.symbolTable.DefinitionNames()
+		lines := c.scopes[c.scopeIndex].lines
 		instructions := c.leaveScope()
+		if !c.noOptimize {
+			instructions, lines = code.Optimize(instructions, lines)
+		}
 
+		freeNames := []string{}
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
+			freeNames = append(freeNames, s.Name)
+		}
+
+		numDefaults := 0
+		for _, d := range node.Defaults {
+			if d != nil {
+				numDefaults++
+			}
 		}
 
 		compiledFunction := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			NumDefaults:   numDefaults,
+			Variadic:      node.Variadic,
+			Name:          node.Name,
+			Pos:           node.Token.Pos,
+			Lines:         lines,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
 		}
 
 		fnConstantIndex := c.addConstant(compiledFunction)
@@ -291,6 +381,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		if hasSpread(node.Arguments) {
+			return c.compileSpreadCall(node)
+		}
 		for _, arg := range node.Arguments {
 			err := c.Compile(arg)
 			if err != nil {
@@ -298,26 +391,67 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.SpreadExpression:
+		return fmt.Errorf("cannot spread outside of a call")
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literals are only allowed in top-level let statements")
 	}
-	return nil
+	return c.err
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
+	globals := c.symbolTable
+	for globals.Outer != nil {
+		globals = globals.Outer
+	}
+
+	instructions := c.currentInstructions()
+	lines := c.scopes[c.scopeIndex].lines
+	if !c.noOptimize {
+		instructions, lines = code.Optimize(instructions, lines)
+	}
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
+		Lines:        lines,
+		GlobalNames:  globals.DefinitionNames(),
 	}
 }
 
+// SourceLines returns the lines that have instructions in the main program
+// or in any compiled function, in increasing order.
+func (b *Bytecode) SourceLines() []int {
+	table := append(code.LineTable{}, b.Lines...)
+	for _, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			table = append(table, fn.Lines...)
+		}
+	}
+	return table.Lines()
+}
+
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 	for i := 0; i < len(newInstruction); i++ {
 		c.currentInstructions()[pos+i] = newInstruction[i]
 	}
 }
 
+// changeOperand replaces the first operand of the instruction at opPos.
 func (c *Compiler) changeOperand(opPos int, operand int) {
 	op := code.Opcode(c.currentInstructions()[opPos])
-	newInstruction := code.Make(op, operand)
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		c.fail(err)
+		return
+	}
+	operands, _ := code.ReadOperands(def, c.currentInstructions()[opPos+1:])
+	operands[0] = operand
+	newInstruction, err := code.MakeChecked(op, operands...)
+	if err != nil {
+		c.fail(err)
+		return
+	}
 	c.replaceInstruction(opPos, newInstruction)
 }
 
@@ -337,20 +471,50 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Truncate(last.Position)
 }
 
-func (c *Compiler) addConstant(obj object.Object) int {
-	c.constants = append(c.constants, obj)
-	return len(c.constants) - 1
+// wideOpcodes maps opcodes to the variants emit uses when an operand does
+// not fit.
+var wideOpcodes = map[code.Opcode]code.Opcode{
+	code.OpConstant:   code.OpConstantWide,
+	code.OpClosure:    code.OpClosureWide,
+	code.OpGetLocal:   code.OpGetLocalWide,
+	code.OpSetLocal:   code.OpSetLocalWide,
+	code.OpCall:       code.OpCallWide,
+	code.OpGetBuiltin: code.OpGetBuiltinWide,
+	code.OpGetFree:    code.OpGetFreeWide,
 }
 
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
-	ins := code.Make(op, operands...)
+	ins, err := code.MakeChecked(op, operands...)
+	if wide, ok := wideOpcodes[op]; ok && err != nil {
+		op = wide
+		ins, err = code.MakeChecked(op, operands...)
+	}
+	if err != nil {
+		c.fail(err)
+		return len(c.currentInstructions())
+	}
+
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(op, pos)
+	if c.line > 0 {
+		c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Add(pos, c.line)
+	}
 	return pos
 }
 
+// fail records err unless an earlier error was recorded.
+func (c *Compiler) fail(err error) {
+	if c.err == nil {
+		if c.line > 0 {
+			err = fmt.Errorf("line %d: %w", c.line, err)
+		}
+		c.err = err
+	}
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
@@ -392,6 +556,14 @@ func (c *Compiler) replaceLastPopWithReturn() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+func (c *Compiler) storeSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
 func (c *Compiler) loadSymbol(symbol Symbol) {
 	switch symbol.Scope {
 	case GlobalScope:
@@ -7,6 +7,7 @@ import (
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"reflect"
 	"testing"
 )
 
@@ -278,6 +279,29 @@ func TestStringExpression(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:          `let a = 1; "x${a}y${a}"`,
+			expectedConsts: []interface{}{1, "x", "y"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConcat, 4),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `"${1}"`,
+			expectedConsts: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConcat, 1),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -336,14 +360,14 @@ func TestHashLiterals(t *testing.T) {
 		},
 		{
 			input:          "{1: 2, 2: 3, 3: 4}",
-			expectedConsts: []interface{}{1, 2, 2, 3, 3, 4},
+			expectedConsts: []interface{}{1, 2, 3, 4},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
-				code.Make(code.OpConstant, 5),
 				code.Make(code.OpHash, 6),
 				code.Make(code.OpPop),
 			},
@@ -372,14 +396,14 @@ func TestIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			input:          "[1, 2, 3][1 + 1]",
-			expectedConsts: []interface{}{1, 2, 3, 1, 1},
+			expectedConsts: []interface{}{1, 2, 3},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpConstant, 2),
 				code.Make(code.OpArray, 3),
-				code.Make(code.OpConstant, 3),
-				code.Make(code.OpConstant, 4),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpAdd),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
@@ -387,18 +411,44 @@ func TestIndexExpressions(t *testing.T) {
 		},
 		{
 			input:          "{1: 2}[2 - 1]",
-			expectedConsts: []interface{}{1, 2, 2, 1},
+			expectedConsts: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
 				code.Make(code.OpHash, 2),
-				code.Make(code.OpConstant, 2),
-				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpSub),
 				code.Make(code.OpIndex),
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:          `"abc"[1:1 + 1]`,
+			expectedConsts: []interface{}{"abc", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpNull),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `"abc"[::2]`,
+			expectedConsts: []interface{}{"abc", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -670,6 +720,233 @@ func TestLetStatementScopes(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a, b = a, ...c) { b }`,
+			expectedConsts: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpJumpIfArgument, 9, 1),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+
+	program := parse(`fn(a, b = 1, ...c) { }`)
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	fn := compiler.Bytecode().Constants[1].(*object.CompiledFunction)
+	if fn.NumParameters != 3 || fn.NumDefaults != 1 || !fn.Variadic {
+		t.Errorf("wrong parameters. want=3, 1, true, got=%d, %d, %t",
+			fn.NumParameters, fn.NumDefaults, fn.Variadic)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          `match ([1]) { [1, a] if a => a, _ => 2 }`,
+			expectedConsts: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpMatchArray, 2, 0),
+				code.Make(code.OpJumpNotTruthy, 61),
+				// 0019
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMatchValue),
+				code.Make(code.OpJumpNotTruthy, 61),
+				// 0033
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				// 0043
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJumpNotTruthy, 61),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				// 0055
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpJump, 71),
+				// 0061
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpJump, 71),
+				// 0067
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpNoMatch),
+				// 0071
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `match ({}) { {"a": b} => b }`,
+			expectedConsts: []interface{}{"a"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMatchHash, 1),
+				code.Make(code.OpJumpNotTruthy, 34),
+				// 0018
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				// 0028
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpJump, 38),
+				// 0034
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpNoMatch),
+				// 0038
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          `let [a, ...b] = [1];`,
+			expectedConsts: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpDestructureArray),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArrayRest, 1),
+				code.Make(code.OpSetGlobal, 2),
+			},
+		},
+		{
+			input:          `let {x, "y": [z]} = {};`,
+			expectedConsts: []interface{}{"x", "y", 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpDestructureHash),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndex),
+				code.Make(code.OpDestructureArray),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpSetGlobal, 3),
+			},
+		},
+		{
+			input: `fn([a], b) { a + b }`,
+			expectedConsts: []interface{}{
+				0,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpDestructureArray),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetLocal, 2),
+					code.Make(code.OpGetLocal, 2),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSpreadCalls(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          `f(...a)`,
+			expectedConsts: []interface{}{0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `f(1, ...a, 2, 3, ...a)`,
+			expectedConsts: []interface{}{0, 1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpExtend),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpExtend),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for i := range tests {
+		tests[i].input = "let f = 0; let a = 0; " + tests[i].input
+		tests[i].expectedInstructions = append([]code.Instructions{
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpSetGlobal, 0),
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpSetGlobal, 1),
+		}, tests[i].expectedInstructions...)
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestCompilerScopes(t *testing.T) {
 	compiler := New()
 	if compiler.scopeIndex != 0 {
@@ -913,13 +1190,12 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 			},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpClosure, 1, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 0),
 				code.Make(code.OpCall, 1),
 				code.Make(code.OpPop),
 			},
@@ -942,18 +1218,17 @@ func TestRecursiveFunctions(t *testing.T) {
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
-				1,
 				[]code.Instructions{
 					code.Make(code.OpClosure, 1, 0),
 					code.Make(code.OpSetLocal, 0),
 					code.Make(code.OpGetLocal, 0),
-					code.Make(code.OpConstant, 2),
+					code.Make(code.OpConstant, 0),
 					code.Make(code.OpCall, 1),
 					code.Make(code.OpReturnValue),
 				},
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpClosure, 2, 0),
 				code.Make(code.OpSetGlobal, 0),
 				code.Make(code.OpGetGlobal, 0),
 				code.Make(code.OpCall, 0),
@@ -970,12 +1245,25 @@ func parse(input string) *ast.Program {
 	return p.ParseProgram()
 }
 
+// runCompilerTests compiles without optimizations, so the instructions
+// follow the source one to one.
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
+	compileAndTest(t, tests, false)
+}
+
+func runOptimizedCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+	compileAndTest(t, tests, true)
+}
+
+func compileAndTest(t *testing.T, tests []compilerTestCase, optimize bool) {
+	t.Helper()
 
 	for _, tt := range tests {
 		program := parse(tt.input)
 		compiler := New()
+		compiler.SetOptimizations(optimize)
 		err := compiler.Compile(program)
 		if err != nil {
 			t.Fatalf("compiler error: %s", err)
@@ -1070,3 +1358,64 @@ func testStringObject(expected string, actual object.Object) error {
 	}
 	return nil
 }
+
+func TestLineTable(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) {
+    let y = x;
+    y
+};
+f(a);`
+
+	program := parse(input)
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	// OpConstant 0, OpSetGlobal 0 | OpClosure 2 0, OpSetGlobal 1 |
+	// OpGetGlobal 1, OpGetGlobal 0, OpCall 1, OpPop
+	expected := code.LineTable{{Offset: 0, Line: 1}, {Offset: 6, Line: 2}, {Offset: 13, Line: 6}}
+	if !reflect.DeepEqual(bytecode.Lines, expected) {
+		t.Errorf("wrong main lines. want=%v, got=%v", expected, bytecode.Lines)
+	}
+
+	fn, ok := bytecode.Constants[1].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 1 is not a function: %T", bytecode.Constants[1])
+	}
+	// OpGetLocal 0, OpSetLocal 1 | OpGetLocal 1, OpReturnValue
+	expected = code.LineTable{{Offset: 0, Line: 3}, {Offset: 4, Line: 4}}
+	if !reflect.DeepEqual(fn.Lines, expected) {
+		t.Errorf("wrong function lines. want=%v, got=%v", expected, fn.Lines)
+	}
+	if !reflect.DeepEqual(fn.LocalNames, []string{"x", "y"}) {
+		t.Errorf("wrong local names: %v", fn.LocalNames)
+	}
+	if !reflect.DeepEqual(bytecode.GlobalNames, []string{"a", "f"}) {
+		t.Errorf("wrong global names: %v", bytecode.GlobalNames)
+	}
+	if lines := bytecode.SourceLines(); !reflect.DeepEqual(lines, []int{1, 2, 3, 4, 6}) {
+		t.Errorf("wrong source lines: %v", lines)
+	}
+}
+
+func TestFreeNames(t *testing.T) {
+	program := parse(`fn(a) { fn(b) { a + b } }`)
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	inner, ok := compiler.Bytecode().Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 0 is not a function")
+	}
+	if !reflect.DeepEqual(inner.FreeNames, []string{"a"}) {
+		t.Errorf("wrong free names: %v", inner.FreeNames)
+	}
+	if !reflect.DeepEqual(inner.LocalNames, []string{"b"}) {
+		t.Errorf("wrong local names: %v", inner.LocalNames)
+	}
+}
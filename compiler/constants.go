@@ -0,0 +1,65 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/object"
+)
+
+// constantKey identifies the value of a constant, so equal constants can
+// share a slot in the pool.
+type constantKey struct {
+	kind  object.ObjectType
+	value string
+}
+
+// keyOf returns the key of obj, or false for constants that are never
+// shared.
+func keyOf(obj object.Object) (constantKey, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return constantKey{obj.Type(), fmt.Sprint(obj.Value)}, true
+	case *object.String:
+		return constantKey{obj.Type(), obj.Value}, true
+	case *object.CompiledFunction:
+		// Functions are only shared when all of their fields are the same,
+		// so that a field added to CompiledFunction takes part without
+		// being listed here. The column of Pos is left out, as only its
+		// line is ever read.
+		fn := *obj
+		fn.Pos.Column = 0
+		return constantKey{obj.Type(), fmt.Sprintf("%#v", fn)}, true
+	}
+	return constantKey{}, false
+}
+
+// indexConstants maps the keys of the constants to their first index.
+func indexConstants(constants []object.Object) map[constantKey]int {
+	index := make(map[constantKey]int)
+	for i, obj := range constants {
+		if key, ok := keyOf(obj); ok {
+			if _, seen := index[key]; !seen {
+				index[key] = i
+			}
+		}
+	}
+	return index
+}
+
+// addConstant returns the index of obj in the constant pool, reusing the
+// slot of an equal constant added before, by this compiler or by an
+// earlier one sharing the pool.
+func (c *Compiler) addConstant(obj object.Object) int {
+	key, ok := keyOf(obj)
+	if ok {
+		if i, ok := c.constantIndex[key]; ok {
+			return i
+		}
+	}
+
+	c.constants = append(c.constants, obj)
+	i := len(c.constants) - 1
+	if ok {
+		c.constantIndex[key] = i
+	}
+	return i
+}
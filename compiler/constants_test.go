@@ -0,0 +1,157 @@
+package compiler
+
+import (
+	"interpreter/code"
+	"interpreter/object"
+	"interpreter/token"
+	"reflect"
+	"testing"
+)
+
+func TestConstantInterning(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          `"name"; 1; "name"; 1; "other"`,
+			expectedConsts: []interface{}{"name", 1, "other"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `[fn(a) { a + 1 }, fn(a) { a + 1 }, fn(b) { b + 1 }]`,
+			expectedConsts: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+				// Same code, but the local has another name.
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstantInterningAcrossCompilations(t *testing.T) {
+	symbolTable := NewSymbolTable()
+	constants := []object.Object{}
+
+	for _, input := range []string{`"a"; 1`, `1; "a"; fn() { 2 }`, `fn() { 2 }; 2`} {
+		c := NewWithState(symbolTable, constants)
+		if err := c.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants = c.Bytecode().Constants
+	}
+
+	expected := []interface{}{
+		"a",
+		1,
+		2,
+		[]code.Instructions{
+			code.Make(code.OpConstant, 2),
+			code.Make(code.OpReturnValue),
+		},
+	}
+	if err := testConstants(t, expected, constants); err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+}
+
+func TestWideConstants(t *testing.T) {
+	constants := make([]object.Object, 70000)
+	for i := range constants {
+		constants[i] = &object.Integer{Value: int64(-i)}
+	}
+
+	c := NewWithState(NewSymbolTable(), constants)
+	c.SetOptimizations(false)
+	if err := c.Compile(parse(`fn() { 5 }; 0`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := c.Bytecode()
+
+	expected := []code.Instructions{
+		code.Make(code.OpClosureWide, 70001, 0),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expected, bytecode.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	fn, ok := bytecode.Constants[70001].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 70001 is not a function. got=%T", bytecode.Constants[70001])
+	}
+	expected = []code.Instructions{
+		code.Make(code.OpConstantWide, 70000),
+		code.Make(code.OpReturnValue),
+	}
+	if err := testInstructions(expected, fn.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+// TestFunctionKeyCoversEveryField checks that functions that differ in any
+// field are not shared, however many fields CompiledFunction has.
+func TestFunctionKeyCoversEveryField(t *testing.T) {
+	base, _ := keyOf(&object.CompiledFunction{})
+
+	fields := reflect.TypeOf(object.CompiledFunction{}).NumField()
+	for i := 0; i < fields; i++ {
+		fn := &object.CompiledFunction{}
+		field := reflect.ValueOf(fn).Elem().Field(i)
+		switch field.Kind() {
+		case reflect.Int:
+			field.SetInt(1)
+		case reflect.Bool:
+			field.SetBool(true)
+		case reflect.String:
+			field.SetString("f")
+		case reflect.Slice:
+			field.Set(reflect.MakeSlice(field.Type(), 1, 1))
+		case reflect.Struct:
+			// Pos, of which only the line counts.
+			field.Field(0).SetInt(1)
+		default:
+			t.Fatalf("unexpected kind of field %s: %s", reflect.TypeOf(*fn).Field(i).Name, field.Kind())
+		}
+
+		if key, _ := keyOf(fn); key == base {
+			t.Errorf("functions that differ in %s have the same key", reflect.TypeOf(*fn).Field(i).Name)
+		}
+	}
+
+	a, _ := keyOf(&object.CompiledFunction{Pos: token.Position{Line: 1, Column: 2}})
+	b, _ := keyOf(&object.CompiledFunction{Pos: token.Position{Line: 1, Column: 9}})
+	if a != b {
+		t.Errorf("functions that differ in the column of Pos have different keys")
+	}
+}
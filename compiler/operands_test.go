@@ -0,0 +1,125 @@
+package compiler
+
+import (
+	"fmt"
+	"interpreter/code"
+	"interpreter/object"
+	"strings"
+	"testing"
+)
+
+// names returns n identifiers with the given prefix. Identifiers cannot
+// hold digits, so the index is spelled with letters.
+func names(prefix string, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		name := []byte(prefix)
+		for j := i; ; j /= 26 {
+			name = append(name, byte('a'+j%26))
+			if j < 26 {
+				break
+			}
+		}
+		names[i] = string(name)
+	}
+	return names
+}
+
+// testCompiledFunction returns the instructions of fn, which must be a
+// compiled function.
+func testCompiledFunction(t *testing.T, fn object.Object) code.Instructions {
+	t.Helper()
+	compiled, ok := fn.(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant is not a function. got=%T", fn)
+	}
+	return compiled.Instructions
+}
+
+func TestWideLocals(t *testing.T) {
+	var body strings.Builder
+	for _, name := range names("l", 300) {
+		fmt.Fprintf(&body, "let %s = 1; ", name)
+	}
+	body.WriteString(names("l", 300)[299])
+
+	c := New()
+	c.SetOptimizations(false)
+	if err := c.Compile(parse(fmt.Sprintf("fn() { %s }", body.String()))); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	fn := c.Bytecode().Constants[1]
+	ins := testCompiledFunction(t, fn)
+	tail := concatInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetLocal, 255),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetLocalWide, 256),
+	})
+	if !strings.Contains(string(ins), string(tail)) {
+		t.Errorf("no OpSetLocalWide after local 255. got=\n%s", ins)
+	}
+	end := concatInstructions([]code.Instructions{
+		code.Make(code.OpGetLocalWide, 299),
+		code.Make(code.OpReturnValue),
+	})
+	if !strings.HasSuffix(string(ins), string(end)) {
+		t.Errorf("function does not end with OpGetLocalWide. got=\n%s", ins)
+	}
+}
+
+func TestWideCalls(t *testing.T) {
+	params := names("p", 300)
+	input := fmt.Sprintf("let f = fn(%s) { fn() { %s } }; f(%s)",
+		strings.Join(params, ", "), strings.Join(params, " + "),
+		strings.Repeat("1, ", 299)+"1")
+
+	c := New()
+	if err := c.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := c.Bytecode()
+
+	end := concatInstructions([]code.Instructions{
+		code.Make(code.OpCallWide, 300),
+		code.Make(code.OpPop),
+	})
+	if !strings.HasSuffix(string(bytecode.Instructions), string(end)) {
+		t.Errorf("call does not use OpCallWide. got=\n%s", bytecode.Instructions)
+	}
+
+	outer := testCompiledFunction(t, bytecode.Constants[1])
+	end = concatInstructions([]code.Instructions{
+		code.Make(code.OpGetLocalWide, 299),
+		code.Make(code.OpClosureWide, 0, 300),
+		code.Make(code.OpReturnValue),
+	})
+	if !strings.HasSuffix(string(outer), string(end)) {
+		t.Errorf("closure does not use OpClosureWide. got=\n%s", outer)
+	}
+
+	inner := testCompiledFunction(t, bytecode.Constants[0])
+	end = concatInstructions([]code.Instructions{
+		code.Make(code.OpGetFreeWide, 299),
+		code.Make(code.OpAdd),
+		code.Make(code.OpReturnValue),
+	})
+	if !strings.HasSuffix(string(inner), string(end)) {
+		t.Errorf("free variable does not use OpGetFreeWide. got=\n%s", inner)
+	}
+}
+
+func TestOperandOutOfRange(t *testing.T) {
+	input := fmt.Sprintf("let a = 1;\n[%s]", strings.Repeat("a, ", 65535)+"a")
+
+	c := New()
+	err := c.Compile(parse(input))
+	if err == nil {
+		t.Fatalf("expected a compiler error")
+	}
+	expected := "line 2: operand 0 of OpArray out of range: 65536 does not fit in [0, 65535]"
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err)
+	}
+}
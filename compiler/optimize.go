@@ -0,0 +1,171 @@
+package compiler
+
+import (
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/object"
+	"strings"
+)
+
+// SetOptimizations turns constant folding, the elimination of dead if
+// branches and the peephole pass over the instructions on or off. They are
+// on by default; with them off every expression is compiled as written.
+func (c *Compiler) SetOptimizations(on bool) {
+	c.noOptimize = !on
+}
+
+// constantValue returns the value of expr if it can be computed at compile
+// time. Expressions that fail at runtime, like a division by zero or an
+// operation on mismatched types, are not constant, so they still fail
+// when they run.
+func constantValue(expr ast.Expression) (object.Object, bool) {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: expr.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: expr.Value}, true
+	case *ast.Boolean:
+		return &object.Boolean{Value: expr.Value}, true
+	case *ast.PrefixExpression:
+		right, ok := constantValue(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldPrefix(expr.Operator, right)
+	case *ast.InfixExpression:
+		left, ok := constantValue(expr.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := constantValue(expr.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldInfix(expr.Operator, left, right)
+	case *ast.TemplateLiteral:
+		var out strings.Builder
+		for i, segment := range expr.Segments {
+			out.WriteString(segment)
+			if i < len(expr.Values) {
+				value, ok := constantValue(expr.Values[i])
+				if !ok {
+					return nil, false
+				}
+				out.WriteString(object.ToString(value))
+			}
+		}
+		return &object.String{Value: out.String()}, true
+	}
+	return nil, false
+}
+
+func foldPrefix(operator string, right object.Object) (object.Object, bool) {
+	switch operator {
+	case "!":
+		if right, ok := right.(*object.Boolean); ok {
+			return &object.Boolean{Value: !right.Value}, true
+		}
+		// Integers and strings are truthy.
+		return &object.Boolean{Value: false}, true
+	case "-":
+		if right, ok := right.(*object.Integer); ok {
+			return &object.Integer{Value: -right.Value}, true
+		}
+	}
+	return nil, false
+}
+
+func foldInfix(operator string, left, right object.Object) (object.Object, bool) {
+	switch left := left.(type) {
+	case *object.Integer:
+		right, ok := right.(*object.Integer)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return &object.Integer{Value: left.Value + right.Value}, true
+		case "-":
+			return &object.Integer{Value: left.Value - right.Value}, true
+		case "*":
+			return &object.Integer{Value: left.Value * right.Value}, true
+		case "/":
+			if right.Value == 0 {
+				return nil, false
+			}
+			return &object.Integer{Value: left.Value / right.Value}, true
+		case "==":
+			return &object.Boolean{Value: left.Value == right.Value}, true
+		case "!=":
+			return &object.Boolean{Value: left.Value != right.Value}, true
+		case ">":
+			return &object.Boolean{Value: left.Value > right.Value}, true
+		case "<":
+			return &object.Boolean{Value: left.Value < right.Value}, true
+		}
+	case *object.String:
+		right, ok := right.(*object.String)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return &object.String{Value: left.Value + right.Value}, true
+		case "==":
+			return &object.Boolean{Value: left.Value == right.Value}, true
+		case "!=":
+			return &object.Boolean{Value: left.Value != right.Value}, true
+		}
+	case *object.Boolean:
+		right, ok := right.(*object.Boolean)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "==":
+			return &object.Boolean{Value: left.Value == right.Value}, true
+		case "!=":
+			return &object.Boolean{Value: left.Value != right.Value}, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Compiler) emitConstant(value object.Object) {
+	switch value := value.(type) {
+	case *object.Boolean:
+		if value.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	default:
+		c.emit(code.OpConstant, c.addConstant(value))
+	}
+}
+
+// compileTakenBranch compiles the branch of an if expression that runs
+// when its condition is constant, leaving the value of the branch on the
+// stack like the if expression would.
+func (c *Compiler) compileTakenBranch(branch *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+	if branch != nil {
+		if err := c.Compile(branch); err != nil {
+			return err
+		}
+	}
+
+	if len(c.currentInstructions()) == start {
+		c.emit(code.OpNull)
+	} else if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	}
+	return nil
+}
+
+func isTruthy(value object.Object) bool {
+	if b, ok := value.(*object.Boolean); ok {
+		return b.Value
+	}
+	return true
+}
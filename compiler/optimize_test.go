@@ -0,0 +1,230 @@
+package compiler
+
+import (
+	"interpreter/code"
+	"testing"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          "1 + 2 * 3 - 4 / 2",
+			expectedConsts: []interface{}{5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "-(2 - 5)",
+			expectedConsts: []interface{}{3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `"mon" + "key"`,
+			expectedConsts: []interface{}{"monkey"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `"n=${1 + 2}, ${true}"`,
+			expectedConsts: []interface{}{"n=3, true"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "!true",
+			expectedConsts: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpFalse),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "1 < 2",
+			expectedConsts: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `"ab" == "a" + "b"`,
+			expectedConsts: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "!!5",
+			expectedConsts: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "(1 == 1) != false",
+			expectedConsts: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// Only the constant operand is folded.
+			input:          "let x = 1; x + (2 + 3)",
+			expectedConsts: []interface{}{1, 5},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func TestConstantFoldingKeepsRuntimeErrors(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          "1 / (2 - 2)",
+			expectedConsts: []interface{}{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDiv),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "-true",
+			expectedConsts: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `1 + "a"; "a" < "b"`,
+			expectedConsts: []interface{}{1, "a", "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpGreaterThan),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func TestDeadBranchElimination(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:          "if (1 < 2) { 10 } else { 20 }",
+			expectedConsts: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "if (false) { 10 } else { 20 }",
+			expectedConsts: []interface{}{20},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          "let a = 1; if (false) { 10 }",
+			expectedConsts: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:          `if ("") { 10 }`,
+			expectedConsts: []interface{}{10},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
+
+func TestPeephole(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:                "",
+			expectedConsts:       []interface{}{},
+			expectedInstructions: []code.Instructions{},
+		},
+		{
+			input: "fn() { return 1; 2 }",
+			expectedConsts: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(a, b) { if (a) { if (b) { 1 } else { 2 } } else { 3 } }",
+			expectedConsts: []interface{}{
+				1,
+				2,
+				3,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJumpNotTruthy, 22),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpJumpNotTruthy, 16),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpJump, 25),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpJump, 25),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runOptimizedCompilerTests(t, tests)
+}
@@ -0,0 +1,106 @@
+package compiler
+
+import (
+	"interpreter/ast"
+	"interpreter/code"
+)
+
+// compileParameters defines the parameters of fn and emits the code that
+// assigns default values to the ones the call did not pass. The parameters
+// are all defined first, as they must take the first locals, before
+// anything a default value defines. Each parameter is hidden until its
+// default value is compiled, so a default sees the parameters before it
+// and, like in the evaluator, nothing after. The parameters that are
+// patterns are destructured last.
+func (c *Compiler) compileParameters(fn *ast.FunctionLiteral) error {
+	params := make([]Symbol, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		if fn.Pattern(i) != nil {
+			// The argument itself is only there to be destructured.
+			params[i] = c.symbolTable.DefineHidden(p.Value)
+		} else {
+			params[i] = c.symbolTable.Define(p.Value)
+		}
+	}
+	reveal := make([]func(), len(params))
+	for i := len(params) - 1; i >= 0; i-- {
+		reveal[i] = c.symbolTable.Hide(params[i].Name)
+	}
+
+	for i := range fn.Parameters {
+		value := fn.Default(i)
+		if value == nil {
+			reveal[i]()
+			continue
+		}
+
+		jumpPos := c.emit(code.OpJumpIfArgument, 9999, i)
+		err := c.Compile(value)
+		if err != nil {
+			return err
+		}
+		reveal[i]()
+		c.emit(code.OpSetLocal, params[i].Index)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+
+	for i, pattern := range fn.Patterns {
+		if pattern == nil {
+			continue
+		}
+		err := c.compileParameterPattern(pattern, params[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasSpread(args []ast.Expression) bool {
+	for _, arg := range args {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadCall compiles a call whose arguments are only known at
+// runtime. The arguments are collected in an array, with OpArray for runs
+// of plain arguments and OpExtend for each spread one, and OpCallSpread
+// calls the function with its elements.
+func (c *Compiler) compileSpreadCall(call *ast.CallExpression) error {
+	// run counts the plain arguments since the last spread one.
+	run := 0
+	started := false
+	for _, arg := range call.Arguments {
+		spread, ok := arg.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(arg)
+			if err != nil {
+				return err
+			}
+			run++
+			continue
+		}
+
+		c.emit(code.OpArray, run)
+		if started {
+			c.emit(code.OpExtend)
+		}
+		started, run = true, 0
+
+		err := c.Compile(spread.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpExtend)
+	}
+	if run > 0 {
+		c.emit(code.OpArray, run)
+		c.emit(code.OpExtend)
+	}
+
+	c.emit(code.OpCallSpread)
+	return c.err
+}
@@ -0,0 +1,293 @@
+package compiler
+
+import (
+	"interpreter/ast"
+	"interpreter/code"
+	"interpreter/object"
+)
+
+// compilePattern binds the value on top of the stack to pattern. The value
+// of an array or hash pattern is kept in a hidden variable named after the
+// pattern, and its parts are taken from there with OpIndex.
+func (c *Compiler) compilePattern(pattern ast.Expression) error {
+	if ident, ok := pattern.(*ast.Identifier); ok {
+		c.storeSymbol(c.symbolTable.Define(ident.Value))
+		return c.err
+	}
+
+	c.emitDestructure(pattern)
+	value := c.symbolTable.DefineHidden(pattern.String())
+	c.storeSymbol(value)
+	return c.destructure(pattern, value)
+}
+
+// compileParameterPattern destructures the parameter param with pattern.
+func (c *Compiler) compileParameterPattern(pattern ast.Expression, param Symbol) error {
+	c.loadSymbol(param)
+	c.emitDestructure(pattern)
+	c.emit(code.OpPop)
+	return c.destructure(pattern, param)
+}
+
+func (c *Compiler) emitDestructure(pattern ast.Expression) {
+	switch pattern.(type) {
+	case *ast.ArrayPattern:
+		c.emit(code.OpDestructureArray)
+	case *ast.HashPattern:
+		c.emit(code.OpDestructureHash)
+	}
+}
+
+// destructure binds the parts of the array or hash in value to the
+// elements of pattern. Missing elements and keys are null, as OpIndex
+// gives them.
+func (c *Compiler) destructure(pattern ast.Expression, value Symbol) error {
+	switch pattern := pattern.(type) {
+	case *ast.ArrayPattern:
+		for i, element := range pattern.Elements {
+			c.loadSymbol(value)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(code.OpIndex)
+			err := c.compilePattern(element)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			c.loadSymbol(value)
+			c.emit(code.OpArrayRest, len(pattern.Elements))
+			c.storeSymbol(c.symbolTable.Define(pattern.Rest.Value))
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			c.loadSymbol(value)
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpIndex)
+			err = c.compilePattern(pair.Pattern)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.err
+}
+
+// compileMatch lowers a match expression to a chain of tests. The value is
+// kept in a hidden variable named after the expression. Each arm tests the parts
+// of the value its pattern looks at, jumping to the next arm on the first
+// failed test, and only then tests its guard, binds its variables and
+// leaves the value of its body, jumping past the remaining arms.
+func (c *Compiler) compileMatch(me *ast.MatchExpression) error {
+	err := c.Compile(me.Value)
+	if err != nil {
+		return err
+	}
+	value := c.symbolTable.DefineHidden(me.String())
+	c.storeSymbol(value)
+
+	endJumps := []int{}
+	for _, arm := range me.Arms {
+		nextJumps := []int{}
+		err := c.testPattern(arm.Pattern, value, nil, &nextJumps)
+		if err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			err = c.compileGuard(arm, value, &nextJumps)
+		} else {
+			err = c.bindMatch(arm.Pattern, value, nil, c.symbolTable.Rebind)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(arm.Body)
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		nextArmPos := len(c.currentInstructions())
+		for _, pos := range nextJumps {
+			c.changeOperand(pos, nextArmPos)
+		}
+	}
+
+	c.loadSymbol(value)
+	c.emit(code.OpNoMatch)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterMatchPos)
+	}
+	return c.err
+}
+
+// A matchStep takes a part out of an array or a hash: the element at index,
+// or the value of key if it is set. A path of steps leads from the value of
+// a match expression to the part a nested pattern looks at.
+type matchStep struct {
+	index int
+	key   ast.Expression
+}
+
+func (c *Compiler) loadPart(value Symbol, path []matchStep) error {
+	c.loadSymbol(value)
+	for _, step := range path {
+		if step.key != nil {
+			err := c.Compile(step.key)
+			if err != nil {
+				return err
+			}
+		} else {
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(step.index)}))
+		}
+		c.emit(code.OpIndex)
+	}
+	return nil
+}
+
+// testPattern emits the tests of pattern against the part of value at
+// path, recording the jumps taken when a test fails.
+func (c *Compiler) testPattern(pattern ast.Expression, value Symbol, path []matchStep, failJumps *[]int) error {
+	path = path[:len(path):len(path)]
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return nil
+	case *ast.ArrayPattern:
+		err := c.loadPart(value, path)
+		if err != nil {
+			return err
+		}
+		atLeast := 0
+		if pattern.Rest != nil {
+			atLeast = 1
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements), atLeast)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+		for i, element := range pattern.Elements {
+			err := c.testPattern(element, value, append(path, matchStep{index: i}), failJumps)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.HashPattern:
+		err := c.loadPart(value, path)
+		if err != nil {
+			return err
+		}
+		for _, pair := range pattern.Pairs {
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpMatchHash, len(pattern.Pairs))
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+		for _, pair := range pattern.Pairs {
+			err := c.testPattern(pair.Pattern, value, append(path, matchStep{key: pair.Key}), failJumps)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		err := c.loadPart(value, path)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpMatchValue)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+	return c.err
+}
+
+// compileGuard tests the guard of arm, whose pattern matched value. The
+// guard sees the variables of the pattern in hidden slots, which
+// are copied to the variables only once it holds, so an arm whose guard
+// fails leaves them as they were.
+func (c *Compiler) compileGuard(arm *ast.MatchArm, value Symbol, failJumps *[]int) error {
+	names := []string{}
+	scratch := map[string]Symbol{}
+	err := c.bindMatch(arm.Pattern, value, nil, func(name string) Symbol {
+		symbol := c.symbolTable.DefineHidden(name + " if " + arm.Guard.String())
+		if _, ok := scratch[name]; !ok {
+			names = append(names, name)
+		}
+		scratch[name] = symbol
+		return symbol
+	})
+	if err != nil {
+		return err
+	}
+
+	restores := []func(){}
+	for _, name := range names {
+		restores = append(restores, c.symbolTable.Shadow(name, scratch[name]))
+	}
+	err = c.Compile(arm.Guard)
+	for _, restore := range restores {
+		restore()
+	}
+	if err != nil {
+		return err
+	}
+	*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+	for _, name := range names {
+		c.loadSymbol(scratch[name])
+		c.storeSymbol(c.symbolTable.Rebind(name))
+	}
+	return c.err
+}
+
+// bindMatch binds the variables of a pattern that matched the part of
+// value at path to the symbols bind gives for their names. Wildcards bind
+// nothing.
+func (c *Compiler) bindMatch(pattern ast.Expression, value Symbol, path []matchStep, bind func(name string) Symbol) error {
+	path = path[:len(path):len(path)]
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if ast.IsWildcard(pattern) {
+			return nil
+		}
+		err := c.loadPart(value, path)
+		if err != nil {
+			return err
+		}
+		c.storeSymbol(bind(pattern.Value))
+	case *ast.ArrayPattern:
+		for i, element := range pattern.Elements {
+			err := c.bindMatch(element, value, append(path, matchStep{index: i}), bind)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil && !ast.IsWildcard(pattern.Rest) {
+			err := c.loadPart(value, path)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpArrayRest, len(pattern.Elements))
+			c.storeSymbol(bind(pattern.Rest.Value))
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			err := c.bindMatch(pair.Pattern, value, append(path, matchStep{key: pair.Key}), bind)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return c.err
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "interpreter/object"
+
 type SymbolScope string
 
 const (
@@ -20,6 +22,7 @@ type SymbolTable struct {
 	Outer          *SymbolTable
 	store          map[string]Symbol
 	numDefinitions int
+	names          []string
 	FreeSymbols    []Symbol
 }
 
@@ -44,9 +47,63 @@ func (s *SymbolTable) Define(name string) Symbol {
 
 	s.store[name] = symbol
 	s.numDefinitions++
+	s.names = append(s.names, name)
 	return symbol
 }
 
+// DefineHidden defines a slot for a value the compiler keeps for itself.
+// Its name is marked with object.HiddenPrefix, which leaves it out of
+// what debuggers show and keeps it apart from every identifier.
+func (s *SymbolTable) DefineHidden(name string) Symbol {
+	return s.Define(object.HiddenPrefix + name)
+}
+
+// Rebind returns the symbol name is defined as in this scope, and defines
+// it only if it is not. Unlike Define it keeps the slot of an earlier
+// definition, so code that may or may not run, like a match arm, can bind
+// the name without hiding its previous value from the code after it.
+func (s *SymbolTable) Rebind(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	return s.Define(name)
+}
+
+// Shadow makes name resolve to the slot of symbol in this scope until the
+// returned function is called, which restores what name resolved to
+// before.
+func (s *SymbolTable) Shadow(name string, symbol Symbol) (restore func()) {
+	restore = s.restorer(name)
+	symbol.Name = name
+	s.store[name] = symbol
+	return restore
+}
+
+// Hide makes name resolve as if it was not defined in this scope until
+// the returned function is called, which restores its definition.
+func (s *SymbolTable) Hide(name string) (restore func()) {
+	restore = s.restorer(name)
+	delete(s.store, name)
+	return restore
+}
+
+func (s *SymbolTable) restorer(name string) func() {
+	previous, ok := s.store[name]
+	return func() {
+		if ok {
+			s.store[name] = previous
+		} else {
+			delete(s.store, name)
+		}
+	}
+}
+
+// DefinitionNames returns the names passed to Define, indexed by symbol
+// index.
+func (s *SymbolTable) DefinitionNames() []string {
+	return s.names
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
 	if !ok && s.Outer != nil {
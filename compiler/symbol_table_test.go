@@ -322,3 +322,33 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("name a = %v, expected %v", result, expected)
 	}
 }
+
+func TestRebind(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+	local.Resolve("a")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{global, "len", Symbol{Name: "len", Scope: GlobalScope, Index: 1}},
+		{global, "c", Symbol{Name: "c", Scope: GlobalScope, Index: 2}},
+		{local, "b", Symbol{Name: "b", Scope: LocalScope, Index: 0}},
+		{local, "a", Symbol{Name: "a", Scope: LocalScope, Index: 1}},
+		{local, "a", Symbol{Name: "a", Scope: LocalScope, Index: 1}},
+	}
+
+	for _, tt := range tests {
+		result := tt.table.Rebind(tt.name)
+		if result != tt.expected {
+			t.Errorf("name %s = %v, expected %v", tt.name, result, tt.expected)
+		}
+	}
+}
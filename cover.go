@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"interpreter/coverage"
+	"io"
+	"os"
+)
+
+// runCover implements `cover [-merge file]... [-o file] [-html file]
+// [<file>...]`. It runs each script with the evaluator, adds the coverage
+// of earlier runs read from lcov files, prints a summary per file and
+// writes the merged result as lcov and annotated HTML.
+func runCover(args []string) int {
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
+	output := flags.String("o", "", "write lcov data to `file`")
+	html := flags.String("html", "", "write an annotated source report to `file`")
+	var merge []string
+	flags.Func("merge", "add the lcov data in `file`; may be repeated", func(name string) error {
+		merge = append(merge, name)
+		return nil
+	})
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 && len(merge) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cover [-merge file]... [-o file] [-html file] [<file>...]")
+		return 2
+	}
+
+	profile := coverage.New()
+	for _, name := range merge {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		p, err := coverage.ReadLCOV(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			return 2
+		}
+		profile.Merge(p)
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if err := profile.Run(name, src); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			status = 1
+		}
+	}
+
+	for _, f := range profile.Files() {
+		lines, lineCount := f.LinesHit()
+		branches, branchCount := f.BranchesHit()
+		fmt.Printf("%s: %d/%d lines, %d/%d branches\n", f.Name, lines, lineCount, branches, branchCount)
+	}
+
+	if *output != "" {
+		if err := writeFile(*output, profile.WriteLCOV); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if *html != "" {
+		err := writeFile(*html, func(w io.Writer) error {
+			return profile.WriteHTML(w, os.ReadFile)
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	return status
+}
+
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,242 @@
+// Package coverage records which statements and if/else branches of a
+// script run, and reports the result as lcov data or annotated HTML.
+package coverage
+
+import (
+	"errors"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"interpreter/script"
+	"sort"
+)
+
+// Profile holds the coverage of any number of files, accumulated over any
+// number of runs.
+type Profile struct {
+	files map[string]*File
+}
+
+// File is the coverage of one source file. Counts are kept per line, the
+// granularity of lcov; a line holding several statements counts the one
+// that ran most often.
+type File struct {
+	Name     string
+	Lines    map[int]int64
+	Branches map[Branch]int64
+}
+
+// Branch is one arm of an if expression. Block numbers the if expressions
+// starting on Line in source order. Arm is 0 for the consequence and 1 for
+// the alternative, which is taken when the condition is false even if
+// there is no else.
+type Branch struct {
+	Line  int
+	Block int
+	Arm   int
+}
+
+func New() *Profile {
+	return &Profile{files: make(map[string]*File)}
+}
+
+// File returns the coverage of the named file, adding an empty one if
+// there is none yet.
+func (p *Profile) File(name string) *File {
+	f, ok := p.files[name]
+	if !ok {
+		f = &File{Name: name, Lines: make(map[int]int64), Branches: make(map[Branch]int64)}
+		p.files[name] = f
+	}
+	return f
+}
+
+// Files returns the files of the profile ordered by name.
+func (p *Profile) Files() []*File {
+	files := make([]*File, 0, len(p.files))
+	for _, f := range p.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// Merge adds the counts of q to p.
+func (p *Profile) Merge(q *Profile) {
+	for _, qf := range q.files {
+		f := p.File(qf.Name)
+		for line, count := range qf.Lines {
+			f.Lines[line] += count
+		}
+		for branch, count := range qf.Branches {
+			f.Branches[branch] += count
+		}
+	}
+}
+
+// Run evaluates src, recording its coverage under name. A runtime error
+// is returned after the coverage up to it has been recorded.
+func (p *Profile) Run(name string, src []byte) error {
+	program, err := script.Parse(string(src))
+	if err != nil {
+		return err
+	}
+
+	r := newRecorder(program)
+	env := object.NewEnvironment()
+	env.SetTracer(r)
+	result := evaluator.Eval(program, env)
+	r.record(p.File(name))
+
+	if err, ok := result.(*object.Error); ok && err.Fatal {
+		return errors.New(err.Message)
+	}
+	return nil
+}
+
+// LinesHit returns how many of the file's lines ran and how many could
+// have.
+func (f *File) LinesHit() (hit, found int) {
+	for _, count := range f.Lines {
+		if count > 0 {
+			hit++
+		}
+	}
+	return hit, len(f.Lines)
+}
+
+// BranchesHit returns how many of the file's branches were taken and how
+// many there are.
+func (f *File) BranchesHit() (hit, found int) {
+	for _, count := range f.Branches {
+		if count > 0 {
+			hit++
+		}
+	}
+	return hit, len(f.Branches)
+}
+
+// SortedLines returns the lines of the file in ascending order.
+func (f *File) SortedLines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for line := range f.Lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// SortedBranches returns the branches of the file ordered by line, block
+// and arm.
+func (f *File) SortedBranches() []Branch {
+	branches := make([]Branch, 0, len(f.Branches))
+	for b := range f.Branches {
+		branches = append(branches, b)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		a, b := branches[i], branches[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Block != b.Block {
+			return a.Block < b.Block
+		}
+		return a.Arm < b.Arm
+	})
+	return branches
+}
+
+// recorder is the evaluator tracer of a single run. It knows every
+// statement and if expression of the program up front, so code that never
+// runs is reported with a count of zero.
+type recorder struct {
+	statements map[ast.Statement]int64
+	conditions map[ast.Expression]Branch
+	branches   map[Branch]int64
+}
+
+func newRecorder(program ast.Node) *recorder {
+	r := &recorder{
+		statements: make(map[ast.Statement]int64),
+		conditions: make(map[ast.Expression]Branch),
+		branches:   make(map[Branch]int64),
+	}
+
+	blocks := make(map[int]int)
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+		case ast.Statement:
+			if ast.Pos(node).Line > 0 {
+				r.statements[node] = 0
+			}
+		case *ast.IfExpression:
+			line := ast.Pos(node).Line
+			r.conditions[node.Condition] = Branch{Line: line, Block: blocks[line]}
+			blocks[line]++
+		case *ast.CallExpression:
+			// Quoted code is data, not something that can run.
+			if node.Function.TokenLiteral() == "quote" {
+				return false
+			}
+		}
+		return node != nil
+	})
+	for _, branch := range r.conditions {
+		r.branches[branch] = 0
+		branch.Arm = 1
+		r.branches[branch] = 0
+	}
+	return r
+}
+
+func (r *recorder) Enter(node ast.Node, env *object.Environment) {
+	if stmt, ok := node.(ast.Statement); ok {
+		if _, ok := r.statements[stmt]; ok {
+			r.statements[stmt]++
+		}
+	}
+}
+
+func (r *recorder) Exit(node ast.Node, result object.Object) {
+	expr, ok := node.(ast.Expression)
+	if !ok {
+		return
+	}
+	branch, ok := r.conditions[expr]
+	if !ok {
+		return
+	}
+	switch result := result.(type) {
+	case *object.Error:
+		// A fatal error stops the program before either arm runs. Other
+		// errors are values, which count as true.
+		if result.Fatal {
+			return
+		}
+	case *object.Null:
+		branch.Arm = 1
+	case *object.Boolean:
+		if !result.Value {
+			branch.Arm = 1
+		}
+	}
+	r.branches[branch]++
+}
+
+// record adds the counts of the run to f.
+func (r *recorder) record(f *File) {
+	lines := make(map[int]int64)
+	for stmt, count := range r.statements {
+		line := ast.Pos(stmt).Line
+		if count >= lines[line] {
+			lines[line] = count
+		}
+	}
+	for line, count := range lines {
+		f.Lines[line] += count
+	}
+	for branch, count := range r.branches {
+		f.Branches[branch] += count
+	}
+}
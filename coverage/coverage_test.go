@@ -0,0 +1,145 @@
+package coverage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const input = `let sign = fn(x) {
+  if (x > 0) {
+    1
+  } else {
+    if (x < 0) { -1 } else { 0 }
+  }
+};
+let unused = fn() {
+  puts("never");
+};
+sign(5);
+sign(7);
+sign(-2);`
+
+func TestRun(t *testing.T) {
+	p := New()
+	if err := p.Run("sign.monkey", []byte(input)); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+
+	f := p.File("sign.monkey")
+	expectedLines := map[int]int64{
+		1: 1, 2: 3, 3: 2, 5: 1, 8: 1, 9: 0, 11: 1, 12: 1, 13: 1,
+	}
+	if !reflect.DeepEqual(f.Lines, expectedLines) {
+		t.Errorf("wrong lines.\nwant=%v\ngot=%v", expectedLines, f.Lines)
+	}
+
+	expectedBranches := map[Branch]int64{
+		{Line: 2, Block: 0, Arm: 0}: 2,
+		{Line: 2, Block: 0, Arm: 1}: 1,
+		{Line: 5, Block: 0, Arm: 0}: 1,
+		{Line: 5, Block: 0, Arm: 1}: 0,
+	}
+	if !reflect.DeepEqual(f.Branches, expectedBranches) {
+		t.Errorf("wrong branches.\nwant=%v\ngot=%v", expectedBranches, f.Branches)
+	}
+
+	if hit, found := f.LinesHit(); hit != 8 || found != 9 {
+		t.Errorf("wrong lines hit. want=8/9, got=%d/%d", hit, found)
+	}
+	if hit, found := f.BranchesHit(); hit != 3 || found != 4 {
+		t.Errorf("wrong branches hit. want=3/4, got=%d/%d", hit, found)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	p := New()
+	err := p.Run("error.monkey", []byte("let a = 1;\na + true;\nlet b = 2;"))
+	if err == nil || err.Error() != "type mismatch: INTEGER + BOOLEAN" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	expected := map[int]int64{1: 1, 2: 1, 3: 0}
+	if got := p.File("error.monkey").Lines; !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong lines.\nwant=%v\ngot=%v", expected, got)
+	}
+
+	if err := p.Run("parse.monkey", []byte("let = 1;")); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+func TestRunErrorCondition(t *testing.T) {
+	p := New()
+	src := "let x = if (first(1)) { 1 } else { 2 };\nif (1 + true) { 3 }"
+	err := p.Run("condition.monkey", []byte(src))
+	if err == nil || err.Error() != "type mismatch: INTEGER + BOOLEAN" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+
+	// The error first returns is a value, so its arm runs; the fatal one
+	// stops the program before either arm does.
+	expected := map[Branch]int64{
+		{Line: 1, Block: 0, Arm: 0}: 1,
+		{Line: 1, Block: 0, Arm: 1}: 0,
+		{Line: 2, Block: 0, Arm: 0}: 0,
+		{Line: 2, Block: 0, Arm: 1}: 0,
+	}
+	if got := p.File("condition.monkey").Branches; !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong branches.\nwant=%v\ngot=%v", expected, got)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	src := []byte("let f = fn(x) {\n  if (x) { 1 }\n};\nf(X);")
+
+	p := New()
+	p.Run("f.monkey", bytes.Replace(src, []byte("X"), []byte("true"), 1))
+	q := New()
+	q.Run("f.monkey", bytes.Replace(src, []byte("X"), []byte("false"), 1))
+	q.Run("g.monkey", []byte("1;"))
+	p.Merge(q)
+
+	f := p.File("f.monkey")
+	if f.Lines[2] != 2 || f.Lines[4] != 2 {
+		t.Errorf("wrong merged lines. got=%v", f.Lines)
+	}
+	if f.Branches[Branch{Line: 2, Arm: 0}] != 1 || f.Branches[Branch{Line: 2, Arm: 1}] != 1 {
+		t.Errorf("wrong merged branches. got=%v", f.Branches)
+	}
+
+	var names []string
+	for _, f := range p.Files() {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"f.monkey", "g.monkey"}) {
+		t.Errorf("wrong files. got=%v", names)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	p := New()
+	p.Run("sign.monkey", []byte(input))
+
+	var out bytes.Buffer
+	err := p.WriteHTML(&out, func(name string) ([]byte, error) {
+		return []byte(input), nil
+	})
+	if err != nil {
+		t.Fatalf("WriteHTML returned error: %s", err)
+	}
+
+	html := out.String()
+	for _, want := range []string{
+		`<p>88.9% of lines, 75.0% of branches</p>`,
+		`<tr class="covered" title="2 of 2 branches taken"><td class="number">2</td><td class="count">3</td><td class="text">  if (x &gt; 0) {</td></tr>`,
+		`<tr class="partial" title="1 of 2 branches taken"><td class="number">5</td>`,
+		`<tr class="uncovered"><td class="number">9</td><td class="count">0</td><td class="text">  puts(&#34;never&#34;);</td></tr>`,
+		`<tr class=""><td class="number">4</td><td class="count"></td><td class="text">  } else {</td></tr>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("output does not contain %q.\n%s", want, html)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+type htmlFile struct {
+	Name     string
+	Lines    string
+	Branches string
+	Source   []htmlLine
+}
+
+type htmlLine struct {
+	Number int
+	Count  string
+	Class  string
+	Title  string
+	Text   string
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.5em; white-space: pre; vertical-align: top; }
+td.number, td.count { text-align: right; color: #888; }
+tr.covered td.text { background: #dfd; }
+tr.uncovered td.text { background: #fdd; }
+tr.partial td.text { background: #ffd; }
+</style>
+</head>
+<body>
+{{range .}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p>{{.Lines}}, {{.Branches}}</p>
+<table>
+{{range .Source}}<tr class="{{.Class}}"{{if .Title}} title="{{.Title}}"{{end}}><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td class="text">{{.Text}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes a page showing the source of every file in p, each
+// line marked as run, not run or, for an if with an untaken arm, partly
+// run. readFile supplies the sources, typically os.ReadFile.
+func (p *Profile) WriteHTML(w io.Writer, readFile func(name string) ([]byte, error)) error {
+	files := []htmlFile{}
+	for _, f := range p.Files() {
+		src, err := readFile(f.Name)
+		if err != nil {
+			return err
+		}
+
+		arms := make(map[int][]int64)
+		for _, b := range f.SortedBranches() {
+			arms[b.Line] = append(arms[b.Line], f.Branches[b])
+		}
+
+		hf := htmlFile{
+			Name:     f.Name,
+			Lines:    percent(f.LinesHit()) + " of lines",
+			Branches: percent(f.BranchesHit()) + " of branches",
+		}
+		for i, text := range strings.Split(strings.TrimSuffix(string(src), "\n"), "\n") {
+			line := htmlLine{Number: i + 1, Text: text}
+			if count, ok := f.Lines[i+1]; ok {
+				line.Count = fmt.Sprint(count)
+				line.Class = "covered"
+				if count == 0 {
+					line.Class = "uncovered"
+				}
+			}
+			if counts, ok := arms[i+1]; ok {
+				taken := 0
+				for _, c := range counts {
+					if c > 0 {
+						taken++
+					}
+				}
+				line.Title = fmt.Sprintf("%d of %d branches taken", taken, len(counts))
+				if taken < len(counts) && line.Class == "covered" {
+					line.Class = "partial"
+				}
+			}
+			hf.Source = append(hf.Source, line)
+		}
+		files = append(files, hf)
+	}
+	return htmlTemplate.Execute(w, files)
+}
+
+// percent formats hit out of found as a percentage, counting nothing to
+// cover as fully covered.
+func percent(hit, found int) string {
+	if found == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(hit)/float64(found))
+}
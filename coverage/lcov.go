@@ -0,0 +1,101 @@
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteLCOV writes p in the lcov trace file format read by genhtml and
+// most coverage services.
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range p.Files() {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.Name)
+
+		branches := f.SortedBranches()
+		for _, b := range branches {
+			taken := strconv.FormatInt(f.Branches[b], 10)
+			if f.Branches[Branch{Line: b.Line, Block: b.Block, Arm: 0}]+f.Branches[Branch{Line: b.Line, Block: b.Block, Arm: 1}] == 0 {
+				// The condition never ran.
+				taken = "-"
+			}
+			fmt.Fprintf(bw, "BRDA:%d,%d,%d,%s\n", b.Line, b.Block, b.Arm, taken)
+		}
+		hit, found := f.BranchesHit()
+		fmt.Fprintf(bw, "BRF:%d\nBRH:%d\n", found, hit)
+
+		for _, line := range f.SortedLines() {
+			fmt.Fprintf(bw, "DA:%d,%d\n", line, f.Lines[line])
+		}
+		hit, found = f.LinesHit()
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\n", found, hit)
+
+		fmt.Fprintln(bw, "end_of_record")
+	}
+	return bw.Flush()
+}
+
+// ReadLCOV reads a trace file written by WriteLCOV. Records other than
+// SF, DA, BRDA and end_of_record are ignored.
+func ReadLCOV(r io.Reader) (*Profile, error) {
+	p := New()
+	var f *File
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		kind, value, _ := strings.Cut(line, ":")
+
+		if kind != "SF" && kind != "DA" && kind != "BRDA" && kind != "end_of_record" {
+			continue
+		}
+		if kind == "SF" {
+			f = p.File(value)
+			continue
+		}
+		if f == nil {
+			return nil, fmt.Errorf("line %d: %s outside of a file record", n, kind)
+		}
+
+		switch kind {
+		case "end_of_record":
+			f = nil
+		case "DA":
+			fields, err := parseFields(value, 2)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed DA record: %w", n, err)
+			}
+			f.Lines[int(fields[0])] += fields[1]
+		case "BRDA":
+			fields, err := parseFields(strings.Replace(value, ",-", ",0", 1), 4)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: malformed BRDA record: %w", n, err)
+			}
+			b := Branch{Line: int(fields[0]), Block: int(fields[1]), Arm: int(fields[2])}
+			f.Branches[b] += fields[3]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseFields(s string, n int) ([]int64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) < n {
+		return nil, fmt.Errorf("want %d fields, got %d", n, len(parts))
+	}
+	fields := make([]int64, n)
+	for i := range fields {
+		v, err := strconv.ParseInt(parts[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = v
+	}
+	return fields, nil
+}
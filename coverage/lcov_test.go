@@ -0,0 +1,97 @@
+package coverage
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteLCOV(t *testing.T) {
+	p := New()
+	p.Run("sign.monkey", []byte(input))
+	p.Run("b.monkey", []byte("let f = fn() { if (true) { 1 } };\n2;"))
+
+	var out bytes.Buffer
+	if err := p.WriteLCOV(&out); err != nil {
+		t.Fatalf("WriteLCOV returned error: %s", err)
+	}
+
+	expected := `TN:
+SF:b.monkey
+BRDA:1,0,0,-
+BRDA:1,0,1,-
+BRF:2
+BRH:0
+DA:1,1
+DA:2,1
+LF:2
+LH:2
+end_of_record
+TN:
+SF:sign.monkey
+BRDA:2,0,0,2
+BRDA:2,0,1,1
+BRDA:5,0,0,1
+BRDA:5,0,1,0
+BRF:4
+BRH:3
+DA:1,1
+DA:2,3
+DA:3,2
+DA:5,1
+DA:8,1
+DA:9,0
+DA:11,1
+DA:12,1
+DA:13,1
+LF:9
+LH:8
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+
+	read, err := ReadLCOV(&out)
+	if err != nil {
+		t.Fatalf("ReadLCOV returned error: %s", err)
+	}
+	if !reflect.DeepEqual(read, p) {
+		t.Errorf("profile changed by a round trip.\nwant=%v\ngot=%v", p.files, read.files)
+	}
+}
+
+func TestReadLCOV(t *testing.T) {
+	input := `TN:test
+SF:a.monkey
+FN:1,f
+DA:1,2
+DA:1,3
+BRDA:4,1,0,5
+end_of_record
+`
+	p, err := ReadLCOV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadLCOV returned error: %s", err)
+	}
+	f := p.File("a.monkey")
+	if f.Lines[1] != 5 || f.Branches[Branch{Line: 4, Block: 1, Arm: 0}] != 5 {
+		t.Errorf("wrong counts. lines=%v, branches=%v", f.Lines, f.Branches)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"DA:1,1\n", "line 1: DA outside of a file record"},
+		{"SF:a\nDA:1\n", "line 2: malformed DA record: want 2 fields, got 1"},
+		{"SF:a\nBRDA:1,0,x,1\n", `line 2: malformed BRDA record: strconv.ParseInt: parsing "x": invalid syntax`},
+	}
+	for _, tt := range errors {
+		_, err := ReadLCOV(strings.NewReader(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
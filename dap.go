@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"interpreter/dap"
+	"os"
+)
+
+// runDAP implements `dap`, serving the Debug Adapter Protocol on stdin and
+// stdout. Scripts print to os.Stdout, so it is swapped for a pipe whose
+// contents are sent to the client as output events.
+func runDAP() int {
+	out := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout = w
+
+	server := dap.NewServer(os.Stdin, out)
+	server.ForwardOutput(r)
+	err = server.Run()
+
+	os.Stdout = out
+	w.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
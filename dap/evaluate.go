@@ -0,0 +1,57 @@
+package dap
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/compiler"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/vm"
+)
+
+// evaluate runs expr on a fresh VM in which bindings are globals. Later
+// bindings shadow earlier ones with the same name.
+func evaluate(expr string, bindings []vm.Binding) (result object.Object, err error) {
+	p := parser.New(lexer.New(expr))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		errs := []error{}
+		for _, err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+	globals := make([]object.Object, vm.GlobalsSize)
+	for _, b := range bindings {
+		symbol := symbolTable.Define(b.Name)
+		globals[symbol.Index] = b.Value
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("evaluation failed: %v", r)
+		}
+	}()
+
+	machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+
+	result = machine.LastPoppedStackElem()
+	if result == nil {
+		result = vm.Null
+	}
+	return result, nil
+}
@@ -0,0 +1,479 @@
+// Package dap implements a Debug Adapter Protocol server that runs a
+// script on the VM under vm.Debugger.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"interpreter/compiler"
+	"interpreter/object"
+	"interpreter/script"
+	"interpreter/transport"
+	"interpreter/vm"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// threadID identifies the only thread, the VM itself.
+const threadID = 1
+
+type Server struct {
+	in *bufio.Reader
+
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	// Set up by the request loop before the VM starts.
+	program    string
+	bytecode   *compiler.Bytecode
+	breakable  map[int]bool
+	debugger   *vm.Debugger
+	launched   bool
+	configured bool
+	started    bool
+	resume     chan vm.Action
+	done       chan struct{}
+
+	// Shared with the goroutine running the VM.
+	mu          sync.Mutex
+	stopped     *vm.VM
+	handles     []func() []Variable
+	terminating bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		resume: make(chan vm.Action),
+		done:   make(chan struct{}),
+	}
+	s.debugger = vm.NewDebugger(s.onStop)
+	return s
+}
+
+// ForwardOutput sends everything read from r to the client as output
+// events, e.g. the read end of a pipe that replaced os.Stdout.
+func (s *Server) ForwardOutput(r io.Reader) {
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				s.event("output", outputEvent{Category: "stdout", Output: string(buf[:n])})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Run serves requests until the client disconnects or closes its end of
+// the connection.
+func (s *Server) Run() error {
+	for {
+		msg, err := transport.ReadMessage(s.in)
+		if err == io.EOF {
+			s.terminate()
+			return nil
+		}
+		if err != nil {
+			s.terminate()
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			return fmt.Errorf("dap: malformed message: %w", err)
+		}
+
+		if req.Command == "disconnect" || req.Command == "terminate" {
+			s.terminate()
+			s.respond(&req, nil)
+			if req.Command == "disconnect" {
+				return nil
+			}
+			continue
+		}
+		s.handle(&req)
+	}
+}
+
+func (s *Server) handle(req *request) {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		})
+		s.event("initialized", nil)
+	case "launch":
+		s.launch(req)
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+	case "configurationDone":
+		s.configured = true
+		s.respond(req, nil)
+		s.start()
+	case "threads":
+		s.respond(req, map[string]interface{}{
+			"threads": []Thread{{ID: threadID, Name: "main"}},
+		})
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		s.scopes(req)
+	case "variables":
+		s.variables(req)
+	case "evaluate":
+		s.evaluate(req)
+	case "continue":
+		s.resumeWith(req, vm.Continue)
+	case "next":
+		s.resumeWith(req, vm.StepOver)
+	case "stepIn":
+		s.resumeWith(req, vm.StepIn)
+	case "stepOut":
+		s.resumeWith(req, vm.StepOut)
+	case "pause":
+		s.debugger.Pause()
+		s.respond(req, nil)
+	default:
+		s.fail(req, fmt.Sprintf("unsupported request %q", req.Command))
+	}
+}
+
+func (s *Server) launch(req *request) {
+	var args launchArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	bytecode, err := script.Compile(string(src), true)
+	if err != nil {
+		s.fail(req, fmt.Sprintf("%s: %s", args.Program, err))
+		return
+	}
+
+	s.program = args.Program
+	s.bytecode = bytecode
+	s.breakable = make(map[int]bool)
+	for _, line := range bytecode.SourceLines() {
+		s.breakable[line] = true
+	}
+	s.debugger.StopOnEntry = args.StopOnEntry
+	s.launched = true
+
+	s.respond(req, nil)
+	s.start()
+}
+
+// start runs the program once it is launched and configured.
+func (s *Server) start() {
+	if !s.launched || !s.configured || s.started {
+		return
+	}
+	s.started = true
+
+	machine := vm.New(s.bytecode)
+	machine.SetDebugger(s.debugger)
+	go func() {
+		defer close(s.done)
+
+		exitCode := 0
+		if err := machine.Run(); err != nil && err != vm.ErrTerminated {
+			s.event("output", outputEvent{Category: "stderr", Output: err.Error() + "\n"})
+			exitCode = 1
+		}
+		s.event("exited", exitedEvent{ExitCode: exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// terminate stops the program, if it is running, and waits for it.
+func (s *Server) terminate() {
+	if !s.started {
+		return
+	}
+
+	s.mu.Lock()
+	s.terminating = true
+	stopped := s.stopped
+	s.stopped = nil
+	s.mu.Unlock()
+
+	if stopped != nil {
+		s.resume <- vm.Terminate
+	} else {
+		s.debugger.Pause()
+	}
+	<-s.done
+}
+
+// onStop runs on the VM's goroutine and blocks until the client resumes.
+func (s *Server) onStop(machine *vm.VM, reason vm.StopReason) vm.Action {
+	s.mu.Lock()
+	if s.terminating {
+		s.mu.Unlock()
+		return vm.Terminate
+	}
+	s.stopped = machine
+	s.handles = nil
+	s.mu.Unlock()
+
+	s.event("stopped", stoppedEvent{Reason: reason.String(), ThreadID: threadID, AllThreadsStopped: true})
+	return <-s.resume
+}
+
+func (s *Server) resumeWith(req *request, action vm.Action) {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.stopped = nil
+	s.handles = nil
+	s.mu.Unlock()
+
+	if stopped == nil {
+		s.fail(req, "program is not stopped")
+		return
+	}
+	if req.Command == "continue" {
+		s.respond(req, map[string]interface{}{"allThreadsContinued": true})
+	} else {
+		s.respond(req, nil)
+	}
+	s.resume <- action
+}
+
+func (s *Server) setBreakpoints(req *request) {
+	var args setBreakpointsArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+
+	s.debugger.ClearBreakpoints()
+	breakpoints := []Breakpoint{}
+	for _, b := range args.Breakpoints {
+		bp := Breakpoint{Verified: true, Line: b.Line}
+		if s.breakable != nil && !s.breakable[b.Line] {
+			bp.Verified = false
+			bp.Message = "no code at this line"
+		} else {
+			s.debugger.SetBreakpoint(b.Line)
+		}
+		breakpoints = append(breakpoints, bp)
+	}
+	s.respond(req, map[string]interface{}{"breakpoints": breakpoints})
+}
+
+// paused returns the stopped VM, or fails req if there is none. The VM
+// stays blocked in onStop until resumeWith, so it can be read freely.
+func (s *Server) paused(req *request) *vm.VM {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped == nil {
+		s.fail(req, "program is not stopped")
+	}
+	return s.stopped
+}
+
+// frame returns the frame with the given ID; IDs count from the innermost
+// frame, starting at 1.
+func (s *Server) frame(req *request, machine *vm.VM, id int) (vm.StackFrame, bool) {
+	backtrace := machine.Backtrace()
+	if id < 1 || id > len(backtrace) {
+		s.fail(req, fmt.Sprintf("unknown frame %d", id))
+		return vm.StackFrame{}, false
+	}
+	return backtrace[id-1], true
+}
+
+func (s *Server) stackTrace(req *request) {
+	machine := s.paused(req)
+	if machine == nil {
+		return
+	}
+
+	source := Source{Name: filepath.Base(s.program), Path: s.program}
+	frames := []StackFrame{}
+	for i, f := range machine.Backtrace() {
+		frames = append(frames, StackFrame{ID: i + 1, Name: f.Function, Source: source, Line: f.Line, Column: 1})
+	}
+	s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)})
+}
+
+func (s *Server) scopes(req *request) {
+	var args frameArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	machine := s.paused(req)
+	if machine == nil {
+		return
+	}
+	frame, ok := s.frame(req, machine, args.FrameID)
+	if !ok {
+		return
+	}
+
+	scopes := []Scope{{Name: "Locals", VariablesReference: s.bindingsHandle(frame.Locals)}}
+	if len(frame.Free) != 0 {
+		scopes = append(scopes, Scope{Name: "Closure", VariablesReference: s.bindingsHandle(frame.Free)})
+	}
+	scopes = append(scopes, Scope{Name: "Globals", VariablesReference: s.bindingsHandle(machine.Globals())})
+	s.respond(req, map[string]interface{}{"scopes": scopes})
+}
+
+func (s *Server) variables(req *request) {
+	var args variablesArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	if machine := s.paused(req); machine == nil {
+		return
+	}
+
+	s.mu.Lock()
+	ref := args.VariablesReference
+	var handle func() []Variable
+	if ref >= 1 && ref <= len(s.handles) {
+		handle = s.handles[ref-1]
+	}
+	s.mu.Unlock()
+
+	if handle == nil {
+		s.fail(req, fmt.Sprintf("unknown variables reference %d", ref))
+		return
+	}
+	s.respond(req, map[string]interface{}{"variables": handle()})
+}
+
+func (s *Server) evaluate(req *request) {
+	var args evaluateArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	machine := s.paused(req)
+	if machine == nil {
+		return
+	}
+
+	bindings := machine.Globals()
+	if args.FrameID != 0 {
+		frame, ok := s.frame(req, machine, args.FrameID)
+		if !ok {
+			return
+		}
+		bindings = append(bindings, frame.Free...)
+		bindings = append(bindings, frame.Locals...)
+	}
+
+	result, err := evaluate(args.Expression, bindings)
+	if err != nil {
+		s.fail(req, err.Error())
+		return
+	}
+	v := s.variable("", result)
+	s.respond(req, map[string]interface{}{
+		"result":             v.Value,
+		"type":               v.Type,
+		"variablesReference": v.VariablesReference,
+	})
+}
+
+// reference registers a function listing variables and returns its
+// variables reference. References are valid until the program resumes.
+func (s *Server) reference(fn func() []Variable) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles = append(s.handles, fn)
+	return len(s.handles)
+}
+
+func (s *Server) bindingsHandle(bindings []vm.Binding) int {
+	return s.reference(func() []Variable {
+		vars := []Variable{}
+		for _, b := range bindings {
+			vars = append(vars, s.variable(b.Name, b.Value))
+		}
+		return vars
+	})
+}
+
+// variable describes obj, giving arrays and hashes a reference to their
+// elements.
+func (s *Server) variable(name string, obj object.Object) Variable {
+	v := Variable{Name: name, Value: obj.Inspect(), Type: string(obj.Type())}
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		if len(obj.Elements) != 0 {
+			v.VariablesReference = s.reference(func() []Variable {
+				vars := []Variable{}
+				for i, el := range obj.Elements {
+					vars = append(vars, s.variable(fmt.Sprintf("[%d]", i), el))
+				}
+				return vars
+			})
+		}
+	case *object.Hash:
+		if len(obj.Pairs) != 0 {
+			v.VariablesReference = s.reference(func() []Variable {
+				vars := []Variable{}
+				for _, pair := range obj.Pairs {
+					vars = append(vars, s.variable(pair.Key.Inspect(), pair.Value))
+				}
+				sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+				return vars
+			})
+		}
+	}
+	return v
+}
+
+func (s *Server) respond(req *request, body interface{}) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *Server) fail(req *request, message string) {
+	s.send(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: message})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) send(msg interface{}) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *response:
+		msg.Seq = s.seq
+	case *event:
+		msg.Seq = s.seq
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	transport.WriteMessage(s.out, data)
+}
@@ -0,0 +1,151 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"interpreter/transport"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// session starts a server on in-memory pipes and returns the client's ends.
+func session(t *testing.T) (io.WriteCloser, *bufio.Reader, chan error) {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		done <- err
+	}()
+	return clientOut, bufio.NewReader(clientIn), done
+}
+
+func decode(t *testing.T, data string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %s", data, err)
+	}
+	return v
+}
+
+func TestRecordedSession(t *testing.T) {
+	transcript, err := os.ReadFile("testdata/session.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, in, done := session(t)
+	for i, line := range strings.Split(string(transcript), "\n") {
+		switch {
+		case strings.HasPrefix(line, "-> "):
+			if err := transport.WriteMessage(out, []byte(line[3:])); err != nil {
+				t.Fatalf("line %d: write failed: %s", i+1, err)
+			}
+		case strings.HasPrefix(line, "<- "):
+			msg, err := transport.ReadMessage(in)
+			if err != nil {
+				t.Fatalf("line %d: read failed: %s", i+1, err)
+			}
+			want := decode(t, line[3:])
+			got := decode(t, string(msg))
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("line %d: wrong message.\nwant=%s\ngot= %s", i+1, line[3:], msg)
+			}
+		}
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+}
+
+func TestDisconnectWhileRunning(t *testing.T) {
+	out, in, done := session(t)
+
+	requests := []struct {
+		request   string
+		responses int
+	}{
+		{`{"seq":1,"type":"request","command":"initialize"}`, 2},
+		{`{"seq":2,"type":"request","command":"launch","arguments":{"program":"testdata/program.monkey","stopOnEntry":true}}`, 1},
+		{`{"seq":3,"type":"request","command":"configurationDone"}`, 2},
+	}
+
+	var last map[string]interface{}
+	for _, r := range requests {
+		transport.WriteMessage(out, []byte(r.request))
+		for i := 0; i < r.responses; i++ {
+			msg, err := transport.ReadMessage(in)
+			if err != nil {
+				t.Fatalf("read failed: %s", err)
+			}
+			json.Unmarshal(msg, &last)
+		}
+	}
+	body, _ := last["body"].(map[string]interface{})
+	if last["event"] != "stopped" || body["reason"] != "entry" {
+		t.Fatalf("expected to stop on entry, got %v", last)
+	}
+
+	transport.WriteMessage(out, []byte(`{"seq":4,"type":"request","command":"disconnect"}`))
+
+	events := []string{}
+	for {
+		msg, err := transport.ReadMessage(in)
+		if err != nil {
+			t.Fatalf("read failed: %s", err)
+		}
+		var m map[string]interface{}
+		json.Unmarshal(msg, &m)
+		if m["type"] == "response" {
+			if m["command"] != "disconnect" || m["success"] != true {
+				t.Fatalf("wrong response: %s", msg)
+			}
+			break
+		}
+		events = append(events, m["event"].(string))
+	}
+	if !reflect.DeepEqual(events, []string{"exited", "terminated"}) {
+		t.Errorf("wrong events: %v", events)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+}
+
+func TestLaunchErrors(t *testing.T) {
+	out, in, done := session(t)
+
+	tests := []struct {
+		request string
+		message string
+	}{
+		{`{"seq":1,"type":"request","command":"launch","arguments":{"program":"testdata/missing.monkey"}}`, "no such file"},
+		{`{"seq":2,"type":"request","command":"stepIn"}`, "program is not stopped"},
+		{`{"seq":3,"type":"request","command":"restartFrame"}`, `unsupported request "restartFrame"`},
+	}
+
+	for _, tt := range tests {
+		transport.WriteMessage(out, []byte(tt.request))
+		msg, err := transport.ReadMessage(in)
+		if err != nil {
+			t.Fatalf("read failed: %s", err)
+		}
+		var resp response
+		json.Unmarshal(msg, &resp)
+		if resp.Success || !strings.Contains(resp.Message, tt.message) {
+			t.Errorf("expected failure containing %q, got %s", tt.message, msg)
+		}
+	}
+
+	out.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+}
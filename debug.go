@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"interpreter/debugger"
+	"interpreter/script"
+	"os"
+)
+
+// runDebug implements `debug [-O0] <file>`, running the script under the
+// interactive debugger.
+func runDebug(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	noOptimize := flags.Bool("O0", false, "disable optimizations, so every line can be stepped through")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: debug [-O0] <file>")
+		return 2
+	}
+	name := flags.Arg(0)
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	bytecode, err := script.Compile(string(src), !*noOptimize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 2
+	}
+
+	if err := debugger.Start(string(src), bytecode, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 1
+	}
+	return 0
+}
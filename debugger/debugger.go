@@ -0,0 +1,180 @@
+// Package debugger implements an interactive command-line debugger on top
+// of the VM's debugger hooks.
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"interpreter/compiler"
+	"interpreter/vm"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const prompt = "(debug) "
+
+const help = `Commands:
+  break [line]   b   set a breakpoint, or list breakpoints without a line
+  clear <line>       remove a breakpoint
+  continue       c   run until the next breakpoint
+  step           s   run to the next line, entering calls
+  next           n   run to the next line, stepping over calls
+  out            o   run until the current function returns
+  backtrace      bt  show the call stack
+  locals         l   show local and free variables of the current function
+  globals        g   show global variables
+  list               show the source around the current line
+  quit           q   stop the program
+`
+
+type session struct {
+	lines     []string
+	breakable map[int]bool
+	debugger  *vm.Debugger
+	scanner   *bufio.Scanner
+	out       io.Writer
+}
+
+// Start runs bytecode under the debugger, reading commands from in. src is
+// the source the bytecode was compiled from. Execution stops before the
+// first line so breakpoints can be set.
+func Start(src string, bytecode *compiler.Bytecode, in io.Reader, out io.Writer) error {
+	s := &session{
+		lines:     strings.Split(src, "\n"),
+		breakable: make(map[int]bool),
+		scanner:   bufio.NewScanner(in),
+		out:       out,
+	}
+	for _, line := range bytecode.SourceLines() {
+		s.breakable[line] = true
+	}
+
+	s.debugger = vm.NewDebugger(s.stopped)
+	s.debugger.StopOnEntry = true
+
+	machine := vm.New(bytecode)
+	machine.SetDebugger(s.debugger)
+	err := machine.Run()
+	if err == vm.ErrTerminated {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Program exited.")
+	return nil
+}
+
+func (s *session) stopped(machine *vm.VM, reason vm.StopReason) vm.Action {
+	backtrace := machine.Backtrace()
+	line := backtrace[0].Line
+	fmt.Fprintf(s.out, "Stopped at line %d (%s)\n", line, reason)
+	s.printLine(line, true)
+
+	for {
+		fmt.Fprint(s.out, prompt)
+		if !s.scanner.Scan() {
+			return vm.Terminate
+		}
+
+		fields := strings.Fields(s.scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "continue", "c":
+			return vm.Continue
+		case "step", "s":
+			return vm.StepIn
+		case "next", "n":
+			return vm.StepOver
+		case "out", "o":
+			return vm.StepOut
+		case "quit", "q":
+			return vm.Terminate
+		case "break", "b":
+			s.breakCommand(fields[1:])
+		case "clear":
+			s.clearCommand(fields[1:])
+		case "backtrace", "bt":
+			for i, f := range backtrace {
+				fmt.Fprintf(s.out, "#%d %s at line %d\n", i, f.Function, f.Line)
+			}
+		case "locals", "l":
+			s.printBindings(backtrace[0].Locals)
+			s.printBindings(backtrace[0].Free)
+		case "globals", "g":
+			s.printBindings(machine.Globals())
+		case "list":
+			for n := line - 3; n <= line+3; n++ {
+				s.printLine(n, n == line)
+			}
+		case "help", "h":
+			fmt.Fprint(s.out, help)
+		default:
+			fmt.Fprintf(s.out, "unknown command %q, try help\n", fields[0])
+		}
+	}
+}
+
+func (s *session) breakCommand(args []string) {
+	if len(args) == 0 {
+		for _, line := range s.debugger.Breakpoints() {
+			fmt.Fprintf(s.out, "Breakpoint at line %d\n", line)
+		}
+		return
+	}
+
+	line, ok := s.lineArgument(args)
+	if !ok {
+		return
+	}
+	if !s.breakable[line] {
+		fmt.Fprintf(s.out, "no code at line %d\n", line)
+		return
+	}
+	s.debugger.SetBreakpoint(line)
+	fmt.Fprintf(s.out, "Breakpoint set at line %d\n", line)
+}
+
+func (s *session) clearCommand(args []string) {
+	line, ok := s.lineArgument(args)
+	if !ok {
+		return
+	}
+	s.debugger.ClearBreakpoint(line)
+	fmt.Fprintf(s.out, "Breakpoint cleared at line %d\n", line)
+}
+
+func (s *session) lineArgument(args []string) (int, bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(s.out, "expected a line number")
+		return 0, false
+	}
+	line, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(s.out, "invalid line number %q\n", args[0])
+		return 0, false
+	}
+	return line, true
+}
+
+func (s *session) printBindings(bindings []vm.Binding) {
+	for _, b := range bindings {
+		fmt.Fprintf(s.out, "%s = %s\n", b.Name, b.Value.Inspect())
+	}
+}
+
+func (s *session) printLine(n int, current bool) {
+	if n < 1 || n > len(s.lines) {
+		return
+	}
+	marker := "  "
+	if current {
+		marker = "=>"
+	}
+	fmt.Fprintf(s.out, "%s %4d | %s\n", marker, n, s.lines[n-1])
+}
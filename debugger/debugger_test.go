@@ -0,0 +1,80 @@
+package debugger
+
+import (
+	"bytes"
+	"interpreter/script"
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	src := `let add = fn(x, y) {
+    let z = x + y;
+    z
+};
+let a = add(1, 2);
+a`
+
+	bytecode, err := script.Compile(src, true)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	commands := strings.Join([]string{
+		"break 4",
+		"break 2",
+		"break",
+		"continue",
+		"locals",
+		"bt",
+		"out",
+		"next",
+		"globals",
+		"continue",
+	}, "\n")
+
+	var out bytes.Buffer
+	if err := Start(src, bytecode, strings.NewReader(commands), &out); err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+
+	expected := `Stopped at line 1 (entry)
+=>    1 | let add = fn(x, y) {
+(debug) no code at line 4
+(debug) Breakpoint set at line 2
+(debug) Breakpoint at line 2
+(debug) Stopped at line 2 (breakpoint)
+=>    2 |     let z = x + y;
+(debug) x = 1
+y = 2
+(debug) #0 add at line 2
+#1 main at line 5
+(debug) Stopped at line 5 (step)
+=>    5 | let a = add(1, 2);
+(debug) Stopped at line 6 (step)
+=>    6 | a
+(debug) add = fn add(x, y)
+a = 3
+(debug) Program exited.
+`
+
+	if got := out.String(); got != expected {
+		t.Fatalf("wrong output.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestSessionQuit(t *testing.T) {
+	src := "let a = 1;\nlet b = 2;"
+	bytecode, err := script.Compile(src, true)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	var out bytes.Buffer
+	if err := Start(src, bytecode, strings.NewReader("step\nquit\n"), &out); err != nil {
+		t.Fatalf("Start returned error: %s", err)
+	}
+	if strings.Contains(out.String(), "Program exited.") {
+		t.Errorf("expected program to be stopped, got:\n%s", out.String())
+	}
+}
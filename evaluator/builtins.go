@@ -7,8 +7,47 @@ import (
 var builtins = map[string]*object.Builtin{
 	"len":   object.GetBuiltinByName("len"),
 	"push":  object.GetBuiltinByName("push"),
-	"print": object.GetBuiltinByName("print"),
+	"puts":  object.GetBuiltinByName("puts"),
 	"first": object.GetBuiltinByName("first"),
 	"last":  object.GetBuiltinByName("last"),
 	"rest":  object.GetBuiltinByName("rest"),
+
+	"assert":      object.GetBuiltinByName("assert"),
+	"assertEqual": object.GetBuiltinByName("assertEqual"),
+	"assertError": object.GetBuiltinByName("assertError"),
+
+	"name":  object.GetBuiltinByName("name"),
+	"arity": object.GetBuiltinByName("arity"),
+
+	"split":      object.GetBuiltinByName("split"),
+	"join":       object.GetBuiltinByName("join"),
+	"trim":       object.GetBuiltinByName("trim"),
+	"upper":      object.GetBuiltinByName("upper"),
+	"lower":      object.GetBuiltinByName("lower"),
+	"replace":    object.GetBuiltinByName("replace"),
+	"contains":   object.GetBuiltinByName("contains"),
+	"startsWith": object.GetBuiltinByName("startsWith"),
+	"endsWith":   object.GetBuiltinByName("endsWith"),
+	"indexOf":    object.GetBuiltinByName("indexOf"),
+	"substr":     object.GetBuiltinByName("substr"),
+	"repeat":     object.GetBuiltinByName("repeat"),
+	"format":     object.GetBuiltinByName("format"),
+	"chars":      object.GetBuiltinByName("chars"),
+	"str":        object.GetBuiltinByName("str"),
+	"int":        object.GetBuiltinByName("int"),
+
+	"map":     object.GetBuiltinByName("map"),
+	"filter":  object.GetBuiltinByName("filter"),
+	"reduce":  object.GetBuiltinByName("reduce"),
+	"sort":    object.GetBuiltinByName("sort"),
+	"reverse": object.GetBuiltinByName("reverse"),
+	"slice":   object.GetBuiltinByName("slice"),
+	"concat":  object.GetBuiltinByName("concat"),
+	"range":   object.GetBuiltinByName("range"),
+	"zip":     object.GetBuiltinByName("zip"),
+	"keys":    object.GetBuiltinByName("keys"),
+	"values":  object.GetBuiltinByName("values"),
+	"has":     object.GetBuiltinByName("has"),
+	"delete":  object.GetBuiltinByName("delete"),
+	"merge":   object.GetBuiltinByName("merge"),
 }
@@ -4,15 +4,27 @@ import (
 	"fmt"
 	"interpreter/ast"
 	"interpreter/object"
+	"strings"
 )
 
 var (
 	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	TRUE  = object.True
+	FALSE = object.False
 )
 
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	tracer := env.Tracer()
+	if tracer == nil {
+		return eval(node, env)
+	}
+	tracer.Enter(node, env)
+	result := eval(node, env)
+	tracer.Exit(node, result)
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
@@ -26,6 +38,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		bounds := []object.Object{NULL, NULL, NULL}
+		for i, bound := range []ast.Expression{node.Start, node.End, node.Step} {
+			if bound == nil {
+				continue
+			}
+			bounds[i] = Eval(bound, env)
+			if isError(bounds[i]) {
+				return bounds[i]
+			}
+		}
+		return object.Slice(left, bounds[0], bounds[1], bounds[2])
 	case *ast.ArrayLiteral:
 		elements := evalExpression(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -33,19 +61,41 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments to quote: want=1, got=%d",
+					len(node.Arguments))
+			}
+			return quote(node.Arguments[0], env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpression(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, err := evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
+		}
+		result := applyFunction(function, args, env.Host())
+		if err, ok := result.(*object.Error); ok && err.Fatal && len(err.Trace) > 0 {
+			traceFunction(err, function)
+			err.Trace = append(err.Trace, object.Frame{Line: ast.Pos(node).Line})
 		}
-		return applyFunction(function, args)
+		return result
+	case *ast.SpreadExpression:
+		return newError("cannot spread outside of a call")
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{
+			Parameters: node.Parameters,
+			Defaults:   node.Defaults,
+			Patterns:   node.Patterns,
+			Variadic:   node.Variadic,
+			Body:       node.Body,
+			Env:        env,
+			Name:       node.Name,
+			Pos:        node.Token.Pos,
+		}
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.LetStatement:
@@ -53,6 +103,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			return bindPattern(node.Pattern, val, env)
+		}
 		env.Set(node.Name.Value, val)
 	case *ast.Program:
 		return evalProgram(node, env)
@@ -66,6 +119,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalBlockStatement(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -90,20 +145,49 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
 	}
 
 	return nil
 }
 
+// newError returns an error that stops the evaluation. Errors builtins
+// return are values instead, as in the VM.
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Message: fmt.Sprintf(format, a...), Fatal: true}
 }
 
-func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR
+// traceLine starts the trace of err with the line of the statement that
+// failed, unless a statement nested in it already did.
+func traceLine(err object.Object, statement ast.Statement) {
+	if err, ok := err.(*object.Error); ok && len(err.Trace) == 0 {
+		err.Trace = []object.Frame{{Line: ast.Pos(statement).Line}}
 	}
-	return false
+}
+
+// traceFunction names the innermost frame of the trace of err that is
+// not named yet after fn, the function that failed. Builtins are not
+// listed in traces, like in the VM.
+func traceFunction(err *object.Error, fn object.Object) {
+	function, ok := fn.(*object.Function)
+	n := len(err.Trace)
+	if !ok || n == 0 || err.Trace[n-1].Function != "" {
+		return
+	}
+	switch {
+	case function.Name != "":
+		err.Trace[n-1].Function = function.Name
+	case function.Pos.IsValid():
+		err.Trace[n-1].Function = fmt.Sprintf("fn@%d", function.Pos.Line)
+	default:
+		err.Trace[n-1].Function = "fn"
+	}
+}
+
+func isError(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Fatal
 }
 
 func evalIdentifier(
@@ -132,7 +216,11 @@ func evalBlockStatement(
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR {
+			if rt == object.RETURN_VALUE_OBJ {
+				return result
+			}
+			if isError(result) {
+				traceLine(result, statements)
 				return result
 			}
 		}
@@ -151,6 +239,13 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
+			if !result.Fatal {
+				continue
+			}
+			traceLine(result, statement)
+			if n := len(result.Trace); result.Trace[n-1].Function == "" {
+				result.Trace[n-1].Function = "main"
+			}
 			return result
 		}
 	}
@@ -158,6 +253,21 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	return result
 }
 
+func evalTemplateLiteral(tl *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+	for i, segment := range tl.Segments {
+		out.WriteString(segment)
+		if i < len(tl.Values) {
+			value := Eval(tl.Values[i], env)
+			if isError(value) {
+				return value
+			}
+			out.WriteString(object.ToString(value))
+		}
+	}
+	return &object.String{Value: out.String()}
+}
+
 func evalIfExpression(
 	ie *ast.IfExpression,
 	env *object.Environment,
@@ -220,6 +330,8 @@ func evalInfixExpression(
 	case left.Type() == object.INTEGER_OBJ &&
 		right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -227,8 +339,6 @@ func evalInfixExpression(
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
 	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -239,14 +349,20 @@ func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	if operator != "+" {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
 		return newError("unknown operator: %s %s %s", left.Type(), operator,
 			right.Type())
 	}
-
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
 }
 
 func evalIntegerInfixExpression(
@@ -330,14 +446,55 @@ func evalExpression(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalArguments evaluates the arguments of a call, replacing spread
+// arrays by their elements.
+func evalArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) ([]object.Object, object.Object) {
+	args := []object.Object{}
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := Eval(e, env)
+			if isError(evaluated) {
+				return nil, evaluated
+			}
+			args = append(args, evaluated)
+			continue
+		}
+
+		evaluated := Eval(spread.Value, env)
+		if isError(evaluated) {
+			return nil, evaluated
+		}
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			return nil, newError("cannot spread %s, want=ARRAY", evaluated.Type())
+		}
+		args = append(args, array.Elements...)
+	}
+
+	return args, nil
+}
+
+func applyFunction(fn object.Object, args []object.Object, host *object.Host) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendEnv := extendFunctionEnv(fn, args)
+		extendEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		evaluated := Eval(fn.Body, extendEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		ctx := &builtinContext{host: host}
+		result := fn.Fn(ctx, args...)
+		if ctx.err != nil {
+			return ctx.err
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
@@ -346,17 +503,91 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// builtinContext is the object.Context of builtins called by the
+// evaluator. err is the first error that stops the program, which the
+// call of the builtin results in whatever the builtin returns, as in the
+// VM.
+type builtinContext struct {
+	host *object.Host
+	err  *object.Error
+}
+
+func (c *builtinContext) Call(fn object.Object, args ...object.Object) object.Object {
+	result := unwrapReturnValue(applyFunction(fn, args, c.host))
+	if result == nil {
+		return NULL
+	}
+	if isError(result) {
+		err := result.(*object.Error)
+		traceFunction(err, fn)
+		c.fail(err)
+	}
+	return result
+}
+
+func (c *builtinContext) Errorf(format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	c.fail(err)
+	return err
+}
+
+func (c *builtinContext) fail(err *object.Error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *builtinContext) Host() *object.Host {
+	return c.host
+}
+
+// extendFunctionEnv binds the parameters of fn to args. Default values
+// are evaluated in the new environment, so they can use the parameters
+// before them.
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+) (*object.Environment, object.Object) {
+	if arity := fn.Arity(); !arity.Accepts(len(args)) {
+		return nil, newError("%s", object.ArityError(fn.Signature(), arity, len(args)))
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
+	values := make([]object.Object, len(fn.Parameters))
 	for paramID, param := range fn.Parameters {
-		env.Set(param.Value, args[paramID])
+		var value object.Object
+		switch {
+		case fn.Variadic && paramID == len(fn.Parameters)-1:
+			rest := []object.Object{}
+			if paramID < len(args) {
+				rest = append(rest, args[paramID:]...)
+			}
+			value = &object.Array{Elements: rest}
+		case paramID < len(args):
+			value = args[paramID]
+		default:
+			value = Eval(fn.Defaults[paramID], env)
+			if isError(value) {
+				return nil, value
+			}
+		}
+		env.Set(param.Value, value)
+		values[paramID] = value
 	}
 
-	return env
+	// Like in the VM, patterns are destructured once every parameter has
+	// its value, so default values cannot refer to the names they bind.
+	for paramID, pattern := range fn.Patterns {
+		if pattern == nil {
+			continue
+		}
+		if err := bindPattern(pattern, values[paramID], env); err != nil {
+			return nil, err
+		}
+	}
+
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -371,6 +602,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -383,6 +616,9 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
+	if idx < 0 {
+		idx += max + 1
+	}
 	if idx < 0 || idx > max {
 		return NULL
 	}
@@ -390,6 +626,20 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	value := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 {
+		idx += int64(len(value))
+	}
+	if idx < 0 || idx >= int64(len(value)) {
+		return NULL
+	}
+
+	return &object.String{Value: string(value[idx])}
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"bytes"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"reflect"
 	"testing"
 )
 
@@ -300,6 +302,270 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let add = fn(a, b = 2) { a + b }; add(1)", 3},
+		{"let add = fn(a, b = 2) { a + b }; add(1, 10)", 11},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1)", 3},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5)", 6},
+		{"let a = 10; let f = fn(a = a) { a }; f()", 10},
+		{"let f = fn(...rest) { len(rest) }; f()", 0},
+		{"let f = fn(a, ...rest) { a + len(rest) }; f(1, 2, 3)", 3},
+		{"let f = fn(a, b = 5, ...rest) { b + len(rest) }; f(1)", 5},
+		{"let f = fn(a, ...rest) { rest[1] }; f(1, 2, 3)", 3},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[], 1, ...[2, 3])", 6},
+		{"let f = fn(...rest) { len(rest) }; f(...[1, 2], ...[3])", 3},
+		{"len(...[[1, 2]])", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArityErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments to fn(): want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments to fn(a): want=1, got=0"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments to fn(a, b): want=2, got=1"},
+		{"let add = fn(a, b = 1) { a + b; }; add(1, 2, 3);", "wrong number of arguments to fn add(a, b): want=1 to 2, got=3"},
+		{"let log = fn(level, ...messages) { messages; }; log();", "wrong number of arguments to fn log(level, ...messages): want=1 or more, got=0"},
+		{"fn(a) { a; }(...[1, 2]);", "wrong number of arguments to fn(a): want=1, got=2"},
+		{"fn(a) { a; }(...1);", "cannot spread INTEGER, want=ARRAY"},
+		{"fn(a, b = c) { a; }(1);", "identifier not found: c"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned, got %T", evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, expected %s got %s",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestErrorTrace(t *testing.T) {
+	input := `let f = fn(x) {
+  x + true
+};
+let g = fn(x) {
+  f(x)
+};
+fn(x) {
+  g(x)
+}(1);`
+	evaluated := testEval(input)
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := []object.Frame{
+		{Function: "f", Line: 2},
+		{Function: "g", Line: 5},
+		{Function: "fn@7", Line: 8},
+		{Function: "main", Line: 7},
+	}
+	if !reflect.DeepEqual(err.Trace, expected) {
+		t.Errorf("wrong trace. want=%v, got=%v", expected, err.Trace)
+	}
+}
+
+func TestFunctionMetadata(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let fibonacci = fn(x) { x }; name(fibonacci)`, "fibonacci"},
+		{`name(fn(x) { x })`, nil},
+		{`name(len)`, "len"},
+		{`arity(fn(a, b) { a })`, 2},
+		{`arity(fn(a, b = 1, ...rest) { a })`, 1},
+		{`arity(len)`, 1},
+		{`arity(substr)`, 2},
+		{`let fibonacci = fn(x) { x }; fibonacci`, "fn fibonacci(x) {\nx\n}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, expected, evaluated)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a + b", 3},
+		{"let [a, b] = [1]; b", nil},
+		{"let [a, ...b] = [1, 2, 3]; b", "[2, 3]"},
+		{"let [a, b, ...c] = [1]; c", "[]"},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; a - b", 1},
+		{`let {name, "age": years} = {"name": "Al", "age": 30}; name`, "Al"},
+		{`let {name, "age": years} = {"name": "Al", "age": 30}; years`, 30},
+		{`let {missing} = {}; missing`, nil},
+		{`let {1: one, true: yes} = {1: 10, true: 20}; one + yes`, 30},
+		{`let {point: [x, y]} = {"point": [3, 4]}; x * y`, 12},
+		{"let f = fn([a, b], c) { a + b + c }; f([1, 2], 3)", 6},
+		{`let f = fn({x}, [y] = [2]) { x * y }; f({"x": 3})`, 6},
+		{"let f = fn() { let [a, b] = [1, 2]; a + b }; f()", 3},
+		{"let f = fn(x) { fn([y]) { x + y } }; f(1)([2])", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, expected, evaluated)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let [a] = 1;", "cannot destructure INTEGER, want=ARRAY"},
+		{"let {a} = [1];", "cannot destructure ARRAY, want=HASH"},
+		{"let [{a}] = [[1]];", "cannot destructure ARRAY, want=HASH"},
+		{"let f = fn([a]) { a }; f(1);", "cannot destructure INTEGER, want=ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q, got %T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, expected %s got %s",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	describe := `let describe = fn(x) {
+		match (x) {
+			0 => "zero",
+			-1 => "minus one",
+			"hi" => "greeting",
+			true => "yes",
+			[] => "empty",
+			[first, ...others] => first,
+			{"type": "user", name} => name,
+			{"type": "point", "at": [x, y]} => x + y,
+			n if n == 11 => "eleven",
+			_ => "other"
+		}
+	};`
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + `describe("hi")`, "greeting"},
+		{describe + "describe(true)", "yes"},
+		{describe + "describe(false)", "other"},
+		{describe + "describe([])", "empty"},
+		{describe + `describe(["a", "b"])`, "a"},
+		{describe + `describe({"type": "user", "name": "Al"})`, "Al"},
+		{describe + `describe({"type": "point", "at": [1, 2]})`, 3},
+		{describe + `describe({"type": "point", "at": [1]})`, "other"},
+		{describe + `describe({"type": "admin", "name": "Al"})`, "other"},
+		{describe + "describe(11)", "eleven"},
+		{describe + "describe(5)", "other"},
+		{"match ([1, 2, 3]) { [a, ...b] => b }", "[2, 3]"},
+		{"match ([1, 2, 3]) { [a, ..._] => a }", 1},
+		{"match ([1, 2, 3]) { [a, b] => 1, [a, b, c] => a + b + c }", 6},
+		{"match ([1, [2, 3]]) { [1, [a, 4]] => a, [1, [a, 3]] => a * 10 }", 20},
+		{"let a = 1; match ([5, 2]) { [a, 1] => a, _ => a }", 1},
+		{"let n = 0; match (5) { n if n > 10 => 1, _ => n }", 0},
+		{"let n = 0; match ([5, 6]) { [n, m] if n > m => 1, [_, m] => n + m }", 6},
+		{"let n = 0; match (5) { n if n > 1 => n, _ => 0 } + n", 10},
+		{"let f = fn(n) { match (5) { n if n > 10 => 1, _ => n } }; f(0)", 0},
+		{"let f = fn(n) { match (5) { n if fn() { n > 10 }() => 1, _ => n } }; f(0)", 0},
+		{"let f = fn(x) { match (x) { 0 => 1, n => n * f(n - 1) } }; f(5)", 120},
+		{"let f = fn(x) { fn() { match (x) { [a] => a } } }; f([7])()", 7},
+		{"let f = fn(x) { match (x) { n if n > 0 => n, _ => -x } }; f(-3) + f(4)", 7},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated == nil || evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %q. want=%q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"match (5) { 0 => 1, [a] => a }", "no match for INTEGER 5"},
+		{"match ([1, 2]) { [a] => a }", "no match for ARRAY [1, 2]"},
+		{"match ({}) { {[1]: a} => a }", "unusable as hash key: ARRAY"},
+		{`match ("a") { n if n > 1 => n }`, "type mismatch: STRING > INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q, got %T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message, expected %s got %s",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 		let newAdder = fn(x) {
@@ -326,6 +592,39 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Al"; let age = 30; "Hello ${name}, you are ${age + 1}"`, "Hello Al, you are 31"},
+		{`"${1}${2}"`, "12"},
+		{`"${"a"} ${true} ${[1, "b"]} ${{"k": 2}} ${if (false) { 1 }}"`, "a true [1, b] {k: 2} null"},
+		{`let f = fn(x) { "<${x}>" }; "${f(f(1))}!"`, "<<1>>!"},
+		{`let x = 1; "a ${"b ${x + 1}"} c"`, "a b 2 c"},
+		{`let f = fn(n) { fn() { "${n}" } }; f(7)()`, "7"},
+		{`let x = ""; "${x}"`, ""},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object not a string for %q, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	evaluated := testEval(`"a ${-true} b"`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "unknown operator: -BOOLEAN" {
+		t.Errorf("expected the error of the interpolated value, got %+v", evaluated)
+	}
+}
+
 func TestStringConcat(t *testing.T) {
 	input := `"hello" + " " + "world"`
 	evaluated := testEval(input)
@@ -432,6 +731,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -447,6 +754,192 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexAndSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[3]`, "null"},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-4]`, "null"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[3:99]`, "lo"},
+		{`"hello"[4:2]`, ""},
+		{`let s = "hello"; s[1:len(s) - 1]`, "ell"},
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3][-5:1]", "[1]"},
+		{"let a = [1, 2, 3]; let b = a[0:2]; push(b, 4); a", "[1, 2, 3]"},
+		{"[1, 2, 3, 4][1:]", "[2, 3, 4]"},
+		{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+		{"[1, 2, 3, 4, 5][1:4:2]", "[2, 4]"},
+		{"[1, 2, 3, 4][::-1]", "[4, 3, 2, 1]"},
+		{"[1, 2, 3, 4, 5][-2::-2]", "[4, 2]"},
+		{"[1, 2, 3][0::9223372036854775807]", "[1]"},
+		{"[1, 2, 3][::-9223372036854775807 - 1]", "[3]"},
+		{"[1, 2, 3][2:0:-9223372036854775807 - 1]", "[3]"},
+		{`"abc"[1::9223372036854775807]`, "b"},
+		{`"hello"[-3:]`, "llo"},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[::-1]`, "olléh"},
+		{`"hello"[::-1]`, "olleh"},
+		{"1[0:1]", "Error: slice operator not supported: INTEGER"},
+		{`"abc"[0:"b"]`, "Error: slice bounds must be INTEGER, got STRING"},
+		{`"abc"[::0]`, "Error: slice step must not be 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, "[11, 12]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`map([[1], [2, 3]], fn(xs) { reduce(map(xs, fn(x) { x * x }), fn(a, b) { a + b }) })`, "[1, 13]"},
+		{`filter(range(10), fn(x) { x / 3 * 3 == x })`, "[0, 3, 6, 9]"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], fn(acc, x) { acc + x }, 5)`, "5"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort([3, 1, 2], fn(a, b) { a - b })`, "[1, 2, 3]"},
+		{`let a = [2, 1]; sort(a); a`, "[2, 1]"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`[slice([1, 2, 3, 4], 1, 3), slice([1, 2, 3, 4], 2), slice("hello", 1, 99)]`, "[[2, 3], [3, 4], ello]"},
+		{`concat([1], [], [2, 3])`, "[1, 2, 3]"},
+		{`[contains([1, [2], "a"], [2]), contains([1, 2], 3)]`, "[true, false]"},
+		{`[range(3), range(2, 5), range(5, 0, -2)]`, "[[0, 1, 2], [2, 3, 4], [5, 3, 1]]"},
+		{`range(9223372036854775805, 9223372036854775807, 5)`, "[9223372036854775805]"},
+		{`range(3, -9223372036854775807 - 1, -9223372036854775807 - 1)`, "[3, -9223372036854775805]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`keys({"b": 1, 2: 2, "a": 3, 1: 4, true: 5})`, "[true, 1, 2, a, b]"},
+		{`values({"b": 1, 2: 2, "a": 3})`, "[2, 3, 1]"},
+		{`[has({"a": 1}, "a"), has({"a": 1}, "b")]`, "[true, false]"},
+		{`let h = {"a": 1, "b": 2}; [keys(delete(h, "a")), len(h)]`, "[[b], 2]"},
+		{`values(merge({"a": 1, "b": 2}, {"b": 3}, {"c": 4}))`, "[1, 3, 4]"},
+		{`rest([])`, "[]"},
+		{`map([1], 1)`, "Error: argument to `map` must be FUNCTION, got INTEGER"},
+		{`map([1], len)`, "Error: argument to `len` not supported, got INTEGER"},
+		{`map([1], fn(x) { x + "a" })`, "Error: type mismatch: INTEGER + STRING"},
+		{`map([1], fn(a, b) { a })`, "Error: wrong number of arguments to fn(a, b): want=2, got=1"},
+		{`reduce([], fn(a, b) { a })`, "Error: reduce of an empty array without an initial value"},
+		{`sort([1, "a"])`, "Error: cannot compare STRING and INTEGER in `sort` without a comparator"},
+		{`sort([1, 2], fn(a, b) { "a" })`, "Error: comparator of `sort` must return BOOLEAN or INTEGER, got STRING"},
+		{`range(1, 2, 0)`, "Error: step of `range` must not be 0"},
+		{`sort([1, 2], fn(a, b) { })`, "Error: comparator of `sort` must return BOOLEAN or INTEGER, got NULL"},
+		{`range(0, 9223372036854775807, 2)`, "Error: result of `range` too long: 4611686018427387904 elements"},
+		{`range(-9223372036854775807 - 1, 9223372036854775807)`, "Error: result of `range` too long: 18446744073709551615 elements"},
+		{`has({}, [])`, "Error: unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBuiltinContext(t *testing.T) {
+	// greet calls its argument with the greeting the host provides.
+	greet := &object.Builtin{Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return ctx.Errorf("greet wants 1 argument, got %d", len(args))
+		}
+		greeting, _ := ctx.Host().Service("greeting").(string)
+		return ctx.Call(args[0], &object.String{Value: greeting})
+	}}
+	// ignore calls its argument and drops the result.
+	ignore := &object.Builtin{Fn: func(ctx object.Context, args ...object.Object) object.Object {
+		ctx.Call(args[0])
+		return &object.Integer{Value: 1}
+	}}
+
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{`greet(fn(g) { puts(g); len(g) }) + 1`, "6", "hello\n"},
+		{`greet(fn(g) { greet(fn(h) { g + " " + h }) })`, "hello hello", ""},
+		{`greet(upper)`, "HELLO", ""},
+		{`greet()`, "Error: greet wants 1 argument, got 0", ""},
+		{`greet(fn() { 1 })`, "Error: wrong number of arguments to fn(): want=0, got=1", ""},
+		{`[greet(fn(g) { }), greet(fn(g) { if (true) { return len(g); } })]`, "[null, 5]", ""},
+		{`ignore(fn() { 1 }) + ignore(fn() { int("x") })`, "2", ""},
+		{`ignore(fn() { 1 + true })`, "Error: type mismatch: INTEGER + BOOLEAN", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		env := object.NewEnvironment()
+		env.SetHost(&object.Host{Stdout: &out, Services: map[string]interface{}{"greeting": "hello"}})
+		env.Set("greet", greet)
+		env.Set("ignore", ignore)
+
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("abc", "")`, "[a, b, c]"},
+		{`join([1, "b", true], "-")`, "1-b-true"},
+		{`trim("  hi there  ")`, "hi there"},
+		{`upper("Hello") + lower("Hello")`, "HELLOhello"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`[contains("hello", "ell"), startsWith("hello", "he"), endsWith("hello", "he")]`, "[true, true, false]"},
+		{`if (contains("hello", "h")) { 1 } else { 2 }`, "1"},
+		{`contains("a", "a") == true`, "true"},
+		{`[indexOf("hello", "l"), indexOf("hello", "z")]`, "[2, -1]"},
+		{`[substr("hello", 1, 3), substr("hello", 3), substr("hello", 10, 1)]`, "[ell, lo, ]"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`format("%s is %d years old, 100%%", "Anna", 28)`, "Anna is 28 years old, 100%"},
+		{`format("%v and %q", [1, "a"], "b")`, `[1, a] and "b"`},
+		{`chars("héllo")`, "[h, é, l, l, o]"},
+		{`[len("héllo"), indexOf("héllo", "l"), substr("héllo", 1, 2)]`, "[5, 2, él]"},
+		{`substr("héllo", 2, 9223372036854775807)`, "llo"},
+		{`str(12) + str("a") + str([1, true])`, "12a[1, true]"},
+		{`int("42") + int(" -7 ") + int(true)`, "36"},
+		{`split(1, ",")`, "Error: argument to `split` must be STRING, got INTEGER"},
+		{`substr("a", -1)`, "Error: negative argument to `substr`"},
+		{`repeat("a", -1)`, "Error: negative count to `repeat`: -1"},
+		{`repeat("ab", 4611686018427387904)`, "Error: result of `repeat` too long: 4611686018427387904 times 2 bytes"},
+		{`[int("abc"), 1]`, `[Error: could not convert "abc" to INTEGER, 1]`},
+		{`format("%d", "a")`, "Error: %d in `format` must be INTEGER, got STRING"},
+		{`format("%s %s", "a")`, "Error: missing argument for %s in `format`"},
+		{`int("4x")`, `Error: could not convert "4x" to INTEGER`},
+		{`int([])`, "Error: argument to `int` not supported, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
     {
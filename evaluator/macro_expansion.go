@@ -0,0 +1,249 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+	"sync/atomic"
+)
+
+// maxExpansionDepth bounds how often the output of a macro may itself be
+// expanded, so a macro that expands to a call of itself fails instead of
+// looping forever.
+const maxExpansionDepth = 100
+
+var gensymCounter int64
+
+// DefineMacros removes top-level `let name = macro(...) {...}` statements
+// from program and binds the macros in env.
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	for i := len(definitions) - 1; i >= 0; i-- {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok || letStatement.Name == nil {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros replaces every call of a macro defined in env with the AST
+// the macro returns. Bindings introduced by the macro body are renamed so
+// they cannot capture identifiers passed in as arguments.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return expandMacros(program, env, 0)
+}
+
+func expandMacros(program ast.Node, env *object.Environment, depth int) (ast.Node, error) {
+	var err error
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+
+		if depth >= maxExpansionDepth {
+			err = fmt.Errorf("macro expansion too deep in %s", callExpression)
+			return node
+		}
+
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			err = fmt.Errorf("wrong number of arguments to macro %s: want=%d, got=%d",
+				callExpression.Function, len(macro.Parameters), len(callExpression.Arguments))
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		evaluated := Eval(macro.Body, evalEnv)
+		if isError(evaluated) {
+			err = fmt.Errorf("expanding macro %s: %s", callExpression.Function,
+				evaluated.(*object.Error).Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			err = fmt.Errorf("macro %s must return a quote, got %s",
+				callExpression.Function, typeOf(evaluated))
+			return node
+		}
+
+		result := makeHygienic(quote.Node, callExpression.Arguments)
+
+		result, err = expandMacros(result, env, depth+1)
+		return result
+	})
+
+	return expanded, err
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
+
+func isMacroCall(
+	exp *ast.CallExpression,
+	env *object.Environment,
+) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(
+	macro *object.Macro,
+	args []*object.Quote,
+) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
+
+// makeHygienic renames the let bindings, function parameters and match
+// arm bindings that a macro introduces, together with the macro's own references to them. The
+// argument subtrees spliced in by unquote are left alone, so user code
+// passed to the macro keeps referring to the user's bindings.
+func makeHygienic(node ast.Node, args []ast.Expression) ast.Node {
+	fromArgs := make(map[ast.Node]bool)
+	for _, a := range args {
+		fromArgs[a] = true
+	}
+
+	renamed := make(map[string]string)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if fromArgs[n] {
+			return false
+		}
+
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			for _, ident := range n.Bindings() {
+				renamed[ident.Value] = ""
+			}
+		case *ast.FunctionLiteral:
+			for i, p := range n.Parameters {
+				if pattern := n.Pattern(i); pattern != nil {
+					for _, ident := range ast.Bindings(pattern) {
+						renamed[ident.Value] = ""
+					}
+				} else {
+					renamed[p.Value] = ""
+				}
+			}
+		case *ast.MatchExpression:
+			for _, arm := range n.Arms {
+				for _, ident := range arm.Bindings() {
+					renamed[ident.Value] = ""
+				}
+			}
+		}
+		return true
+	})
+
+	if len(renamed) == 0 {
+		return node
+	}
+
+	for name := range renamed {
+		renamed[name] = gensym(name)
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		if fromArgs[n] {
+			return false
+		}
+
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if name, ok := renamed[n.Value]; ok {
+				n.Value = name
+			}
+		case *ast.FunctionLiteral:
+			if name, ok := renamed[n.Name]; ok {
+				n.Name = name
+			}
+		}
+		return true
+	})
+
+	return node
+}
+
+// gensym returns a fresh identifier based on name. The '#' cannot appear in
+// identifiers written by users, so the result never clashes with them.
+func gensym(name string) string {
+	return fmt.Sprintf("%s#%d", name, atomic.AddInt64(&gensymCounter, 1))
+}
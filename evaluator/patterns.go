@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"interpreter/ast"
+	"interpreter/object"
+)
+
+// bindPattern binds the identifiers in pattern to the parts of value they
+// stand for and returns nil, or an error. Elements past the end of an
+// array and keys missing from a hash bind null, just like indexing them
+// gives null, but destructuring a value that is not an array or a hash is
+// an error.
+func bindPattern(pattern ast.Expression, value object.Object, env *object.Environment) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.Set(pattern.Value, value)
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return newError("cannot destructure %s, want=ARRAY", value.Type())
+		}
+		for i, element := range pattern.Elements {
+			item := evalArrayIndexExpression(array, &object.Integer{Value: int64(i)})
+			if err := bindPattern(element, item, env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := []object.Object{}
+			if len(pattern.Elements) < len(array.Elements) {
+				rest = append(rest, array.Elements[len(pattern.Elements):]...)
+			}
+			env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+		}
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return newError("cannot destructure %s, want=HASH", value.Type())
+		}
+		for _, pair := range pattern.Pairs {
+			key := Eval(pair.Key, env)
+			if isError(key) {
+				return key
+			}
+			item := evalHashIndexExpression(hash, key)
+			if isError(item) {
+				return item
+			}
+			if err := bindPattern(pair.Pattern, item, env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	value := Eval(me.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	for _, arm := range me.Arms {
+		bindings := []binding{}
+		matched, err := matchPattern(arm.Pattern, value, env, &bindings)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			// The guard sees the bindings in an environment of its own, so
+			// an arm whose guard fails leaves env untouched.
+			guardEnv := object.NewEnclosedEnvironment(env)
+			for _, b := range bindings {
+				guardEnv.Set(b.name, b.value)
+			}
+			guard := Eval(arm.Guard, guardEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		for _, b := range bindings {
+			env.Set(b.name, b.value)
+		}
+		return Eval(arm.Body, env)
+	}
+
+	return newError("no match for %s %s", value.Type(), value.Inspect())
+}
+
+type binding struct {
+	name  string
+	value object.Object
+}
+
+// matchPattern reports whether value matches the pattern of a match arm,
+// collecting the bindings it makes. Nothing is bound until the whole
+// pattern matches, so a failed arm leaves the environment untouched.
+func matchPattern(pattern ast.Expression, value object.Object, env *object.Environment, bindings *[]binding) (bool, object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if !ast.IsWildcard(pattern) {
+			*bindings = append(*bindings, binding{pattern.Value, value})
+		}
+		return true, nil
+	case *ast.ArrayPattern:
+		array, ok := value.(*object.Array)
+		if !ok {
+			return false, nil
+		}
+		n := len(pattern.Elements)
+		if len(array.Elements) < n || pattern.Rest == nil && len(array.Elements) != n {
+			return false, nil
+		}
+		for i, element := range pattern.Elements {
+			matched, err := matchPattern(element, array.Elements[i], env, bindings)
+			if !matched || err != nil {
+				return false, err
+			}
+		}
+		if pattern.Rest != nil && !ast.IsWildcard(pattern.Rest) {
+			rest := append([]object.Object{}, array.Elements[n:]...)
+			*bindings = append(*bindings, binding{pattern.Rest.Value, &object.Array{Elements: rest}})
+		}
+		return true, nil
+	case *ast.HashPattern:
+		hash, ok := value.(*object.Hash)
+		if !ok {
+			return false, nil
+		}
+		for _, pair := range pattern.Pairs {
+			key := Eval(pair.Key, env)
+			if isError(key) {
+				return false, key
+			}
+			hashable, ok := key.(object.HashTable)
+			if !ok {
+				return false, newError("unusable as hash key: %s", key.Type())
+			}
+			item, ok := hash.Pairs[hashable.Hashkey()]
+			if !ok {
+				return false, nil
+			}
+			matched, err := matchPattern(pair.Pattern, item.Value, env, bindings)
+			if !matched || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	default:
+		literal := Eval(pattern, env)
+		if isError(literal) {
+			return false, literal
+		}
+		return object.Equal(literal, value), nil
+	}
+}
@@ -0,0 +1,10 @@
+package evaluator
+
+import (
+	"interpreter/object"
+)
+
+// Tracer observes evaluation. Install one with SetTracer on the
+// environment passed to Eval; the environments of the functions it calls
+// inherit it.
+type Tracer = object.Tracer
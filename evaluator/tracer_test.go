@@ -0,0 +1,126 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"strings"
+	"testing"
+)
+
+type recordingTracer struct {
+	events []string
+	depth  int
+}
+
+func (r *recordingTracer) Enter(node ast.Node, env *object.Environment) {
+	r.events = append(r.events, fmt.Sprintf("%s%T %s", strings.Repeat("  ", r.depth), node, node))
+	r.depth++
+}
+
+func (r *recordingTracer) Exit(node ast.Node, result object.Object) {
+	r.depth--
+	if result != nil {
+		r.events = append(r.events, fmt.Sprintf("%s= %s", strings.Repeat("  ", r.depth), result.Inspect()))
+	}
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	env := object.NewEnvironment()
+	env.SetTracer(tracer)
+
+	Eval(parser.New(lexer.New(`-1 + 2`)).ParseProgram(), env)
+
+	expected := []string{
+		"*ast.Program ((-1) + 2)",
+		"  *ast.ExpressionStatement ((-1) + 2)",
+		"    *ast.InfixExpression ((-1) + 2)",
+		"      *ast.PrefixExpression (-1)",
+		"        *ast.IntegerLiteral 1",
+		"        = 1",
+		"      = -1",
+		"      *ast.IntegerLiteral 2",
+		"      = 2",
+		"    = 1",
+		"  = 1",
+		"= 1",
+	}
+	if got := strings.Join(tracer.events, "\n"); got != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nwant=\n%s\ngot=\n%s", strings.Join(expected, "\n"), got)
+	}
+	if tracer.depth != 0 {
+		t.Errorf("unbalanced events. depth=%d", tracer.depth)
+	}
+}
+
+func TestTracerPerEnvironment(t *testing.T) {
+	program := parser.New(lexer.New(`let f = fn(x) { x + 1 }; f(1)`)).ParseProgram()
+
+	// Two evaluations run at the same time, each with its own tracer.
+	traced, other := &recordingTracer{}, &recordingTracer{}
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 10; i++ {
+			env := object.NewEnvironment()
+			env.SetTracer(other)
+			Eval(program, env)
+		}
+		done <- true
+	}()
+	env := object.NewEnvironment()
+	env.SetTracer(traced)
+	Eval(program, env)
+	<-done
+
+	if len(other.events) != 10*len(traced.events) {
+		t.Errorf("evaluations recorded into each other's tracer: %d and %d events",
+			len(traced.events), len(other.events))
+	}
+	// The body of f runs in an environment enclosed by env, which
+	// inherits its tracer.
+	want := "*ast.InfixExpression (x + 1)"
+	found := 0
+	for _, event := range traced.events {
+		if strings.TrimSpace(event) == want {
+			found++
+		}
+	}
+	if found != 1 {
+		t.Errorf("want one %q event, got %d in\n%s", want, found, strings.Join(traced.events, "\n"))
+	}
+}
+
+const benchmarkInput = `
+let fibonacci = fn(x) {
+  if (x < 2) { return x; }
+  fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(15);
+`
+
+type nopTracer struct{}
+
+func (nopTracer) Enter(node ast.Node, env *object.Environment) {}
+func (nopTracer) Exit(node ast.Node, result object.Object)     {}
+
+func benchmarkEval(b *testing.B, t Tracer) {
+	program := parser.New(lexer.New(benchmarkInput)).ParseProgram()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env := object.NewEnvironment()
+		env.SetTracer(t)
+		Eval(program, env)
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	benchmarkEval(b, nil)
+}
+
+func BenchmarkEvalTraced(b *testing.B) {
+	benchmarkEval(b, nopTracer{})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"interpreter/format"
+	"io"
+	"os"
+)
+
+// runFmt implements `fmt [-w] [-l] [-d] [files]`. Without files it formats
+// standard input. With -l or -d the exit status is 1 when any file is not
+// formatted, so it can be used as a CI check.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	list := flags.Bool("l", false, "list files whose formatting differs")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		res, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>: %s\n", err)
+			return 2
+		}
+		os.Stdout.Write(res)
+		return 0
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+
+		res, err := format.Source(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			status = 2
+			continue
+		}
+
+		changed := !bytes.Equal(src, res)
+		if changed && (*list || *diff) && status == 0 {
+			status = 1
+		}
+
+		switch {
+		case *list || *diff:
+			if *list && changed {
+				fmt.Println(name)
+			}
+			if *diff && changed {
+				os.Stdout.WriteString(unifiedDiff(name, string(src), string(res)))
+			}
+		case *write:
+			if changed {
+				if err := os.WriteFile(name, res, 0644); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 2
+				}
+			}
+		default:
+			os.Stdout.Write(res)
+		}
+	}
+
+	return status
+}
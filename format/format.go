@@ -0,0 +1,561 @@
+// Package format prints programs in their canonical source form.
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"sort"
+	"strings"
+)
+
+const (
+	indentString = "    "
+	maxWidth     = 80
+)
+
+// Source parses src and returns it in canonical form. Comments are kept,
+// and at most one blank line is kept between statements. Formatting the
+// result again returns it unchanged.
+//
+// Comments are only kept between statements and at the end of a line, so
+// Source returns an error rather than move a comment that sits inside an
+// expression, such as between the elements of an array.
+func Source(src []byte) ([]byte, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		errs := []error{}
+		for _, err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	pr := &printer{comments: l.Comments()}
+	pr.program(program)
+	if pr.err != nil {
+		return nil, pr.err
+	}
+	return pr.out.Bytes(), nil
+}
+
+// Node returns the canonical source for node, without comments. A string
+// literal holding a quote or ${, which only a program built in Go can
+// have, is printed as it is even though it would not parse.
+func Node(node ast.Node) string {
+	pr := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		pr.program(node)
+		return strings.TrimSuffix(pr.out.String(), "\n")
+	case ast.Statement:
+		pr.statement(node, false)
+	case ast.Expression:
+		pr.expression(node)
+	}
+	return pr.out.String()
+}
+
+type printer struct {
+	out           bytes.Buffer
+	indent        int
+	pendingIndent bool
+
+	comments []token.Token
+	next     int
+	lastLine int
+
+	err error
+}
+
+// fail records the first reason the source cannot be formatted.
+func (p *printer) fail(pos token.Position, format string, a ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, a...))
+	}
+}
+
+// checkComments fails if the next comment comes before pos, which is in
+// the middle of the statement being printed.
+func (p *printer) checkComments(pos token.Position) {
+	if p.next == len(p.comments) || !pos.IsValid() {
+		return
+	}
+	c := p.comments[p.next].Pos
+	if c.Line < pos.Line || c.Line == pos.Line && c.Column < pos.Column {
+		p.fail(c, "cannot format a comment inside an expression")
+	}
+}
+
+func (p *printer) print(s string) {
+	if p.pendingIndent {
+		p.out.WriteString(strings.Repeat(indentString, p.indent))
+		p.pendingIndent = false
+	}
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteByte('\n')
+	p.pendingIndent = true
+}
+
+func (p *printer) column() int {
+	b := p.out.Bytes()
+	col := len(b) - (bytes.LastIndexByte(b, '\n') + 1)
+	if p.pendingIndent {
+		col += p.indent * len(indentString)
+	}
+	return col
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.sequence(program.Statements, 0, false)
+	if p.out.Len() > 0 {
+		p.print("\n")
+	}
+}
+
+// sequence prints the statements of a program or block with the comments
+// that precede them. Inside a block every item starts on a new line; at
+// the top level the first item does not. Comments that come before endLine
+// are printed after the last statement; an endLine of zero prints all of
+// the remaining comments and a negative one prints none.
+func (p *printer) sequence(statements []ast.Statement, endLine int, inBlock bool) {
+	first := true
+	startItem := func(line int) {
+		if !first && line > 0 && p.lastLine > 0 && line-p.lastLine > 1 {
+			p.out.WriteByte('\n')
+		}
+		if inBlock || !first {
+			p.newline()
+		}
+		first = false
+	}
+
+	for i, s := range statements {
+		line := ast.Pos(s).Line
+
+		for p.next < len(p.comments) && line > 0 && p.comments[p.next].Pos.Line < line {
+			c := p.comments[p.next]
+			p.next++
+			startItem(c.Pos.Line)
+			p.print(c.Literal)
+			p.lastLine = c.Pos.Line
+		}
+
+		var trailing *token.Token
+		if p.next < len(p.comments) && line > 0 && p.comments[p.next].Pos.Line == line {
+			trailing = &p.comments[p.next]
+			p.next++
+			if insideExpression(s, trailing.Pos) {
+				p.fail(trailing.Pos, "cannot format a comment inside an expression")
+			}
+		}
+
+		startItem(line)
+		implicit := inBlock && i == len(statements)-1
+
+		if trailing == nil {
+			p.statement(s, implicit)
+		} else {
+			p.statementWithComment(s, implicit, trailing.Literal)
+		}
+		p.lastLine = ast.EndLine(s)
+		if p.next < len(p.comments) && p.comments[p.next].Pos.Line < p.lastLine {
+			p.fail(p.comments[p.next].Pos, "cannot format a comment inside an expression")
+		}
+	}
+
+	for p.next < len(p.comments) && (endLine == 0 || p.comments[p.next].Pos.Line < endLine) {
+		c := p.comments[p.next]
+		p.next++
+		startItem(c.Pos.Line)
+		p.print(c.Literal)
+		p.lastLine = c.Pos.Line
+	}
+}
+
+// insideExpression reports whether the comment at pos comes before an
+// expression of s, rather than after the end of s or before the first
+// statement of one of its blocks.
+func insideExpression(s ast.Statement, pos token.Position) bool {
+	var next ast.Node
+	ast.Inspect(s, func(n ast.Node) bool {
+		if n == nil || next != nil {
+			return false
+		}
+		if p := ast.Pos(n); p.Line > pos.Line || p.Line == pos.Line && p.Column > pos.Column {
+			next = n
+			return false
+		}
+		return true
+	})
+	_, ok := next.(ast.Expression)
+	return ok
+}
+
+// statementWithComment prints a statement that had a comment on its first
+// line. The comment stays at the end of the line if the statement fits on
+// one line, and moves above the statement otherwise.
+func (p *printer) statementWithComment(s ast.Statement, implicit bool, comment string) {
+	saved := p.out
+	p.out = bytes.Buffer{}
+	p.statement(s, implicit)
+	rendered := p.out.String()
+	p.out = saved
+
+	if !strings.Contains(rendered, "\n") {
+		p.out.WriteString(rendered)
+		p.out.WriteString(" " + comment)
+		return
+	}
+
+	indent := strings.Repeat(indentString, p.indent)
+	p.out.WriteString(indent + comment + "\n")
+	p.out.WriteString(rendered)
+}
+
+// statement prints s. Statements end in a semicolon, except for an
+// expression statement that provides the value of a block; dropping the
+// others could make the next line parse as part of this statement.
+func (p *printer) statement(s ast.Statement, implicit bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.print("let ")
+		if s.Pattern != nil {
+			p.expression(s.Pattern)
+		} else {
+			p.print(s.Name.Value)
+		}
+		p.print(" = ")
+		p.expression(s.Value)
+		p.print(";")
+	case *ast.ReturnStatement:
+		p.print("return")
+		if s.ReturnValue != nil {
+			p.print(" ")
+			p.expression(s.ReturnValue)
+		}
+		p.print(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+		if !implicit {
+			p.print(";")
+		}
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	hasComments := p.next < len(p.comments) && b.Rbrace.IsValid() &&
+		p.comments[p.next].Pos.Line < b.Rbrace.Line
+	if len(b.Statements) == 0 && !hasComments {
+		p.print("{}")
+		return
+	}
+
+	p.print("{")
+	p.indent++
+	endLine := -1
+	if b.Rbrace.IsValid() {
+		endLine = b.Rbrace.Line
+	}
+	p.sequence(b.Statements, endLine, true)
+	p.indent--
+	p.newline()
+	p.print("}")
+	if b.Rbrace.Line > p.lastLine {
+		p.lastLine = b.Rbrace.Line
+	}
+}
+
+func (p *printer) expression(e ast.Expression) {
+	if e != nil {
+		p.checkComments(ast.Pos(e))
+	}
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.print(e.Value)
+	case *ast.IntegerLiteral:
+		p.print(fmt.Sprintf("%d", e.Value))
+	case *ast.Boolean:
+		p.print(fmt.Sprintf("%t", e.Value))
+	case *ast.StringLiteral:
+		p.checkString(e.Token.Pos, e.Value)
+		p.print(`"` + e.Value + `"`)
+	case *ast.TemplateLiteral:
+		p.print(`"`)
+		for i, segment := range e.Segments {
+			p.checkString(e.Token.Pos, segment)
+			p.print(segment)
+			if i < len(e.Values) {
+				p.print("${")
+				p.expression(e.Values[i])
+				p.print("}")
+			}
+		}
+		p.print(`"`)
+	case *ast.PrefixExpression:
+		p.print(e.Operator)
+		p.operand(e.Right, precedence(e.Right) < parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		p.operand(e.Left, precedence(e.Left) < prec)
+		p.print(" " + e.Operator + " ")
+		p.operand(e.Right, precedence(e.Right) <= prec)
+	case *ast.IfExpression:
+		p.print("if (")
+		p.expression(e.Condition)
+		p.print(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.MatchExpression:
+		p.match(e)
+	case *ast.FunctionLiteral:
+		p.print("fn")
+		p.parameters(e.Parameters, e.Defaults, e.Patterns, e.Variadic)
+		p.block(e.Body)
+	case *ast.MacroLiteral:
+		p.print("macro")
+		p.parameters(e.Parameters, nil, nil, false)
+		p.block(e.Body)
+	case *ast.SpreadExpression:
+		p.print("...")
+		p.expression(e.Value)
+	case *ast.CallExpression:
+		p.operand(e.Function, precedence(e.Function) < parser.CALL)
+		p.print("(")
+		for i, arg := range e.Arguments {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expression(arg)
+		}
+		p.print(")")
+	case *ast.IndexExpression:
+		p.operand(e.Left, precedence(e.Left) < parser.CALL)
+		p.print("[")
+		p.expression(e.Index)
+		p.print("]")
+	case *ast.SliceExpression:
+		p.operand(e.Left, precedence(e.Left) < parser.CALL)
+		p.print("[")
+		p.expression(e.Start)
+		p.print(":")
+		p.expression(e.End)
+		if e.Step != nil {
+			p.print(":")
+			p.expression(e.Step)
+		}
+		p.print("]")
+	case *ast.ArrayLiteral:
+		p.list("[", "]", len(e.Elements), func(i int) {
+			p.expression(e.Elements[i])
+		})
+	case *ast.HashLiteral:
+		keys := hashKeys(e)
+		p.list("{", "}", len(keys), func(i int) {
+			p.expression(keys[i])
+			p.print(": ")
+			p.expression(e.Pairs[keys[i]])
+		})
+	case *ast.ArrayPattern:
+		n := len(e.Elements)
+		if e.Rest != nil {
+			n++
+		}
+		p.list("[", "]", n, func(i int) {
+			if i < len(e.Elements) {
+				p.expression(e.Elements[i])
+			} else {
+				p.print("..." + e.Rest.Value)
+			}
+		})
+	case *ast.HashPattern:
+		p.list("{", "}", len(e.Pairs), func(i int) {
+			pair := e.Pairs[i]
+			if pair.Shorthand() {
+				p.expression(pair.Pattern)
+				return
+			}
+			// Keys written as identifiers stay identifiers.
+			if key, ok := pair.Key.(*ast.StringLiteral); ok && key.Token.Type == token.IDENT {
+				p.print(key.Value)
+			} else {
+				p.expression(pair.Key)
+			}
+			p.print(": ")
+			p.expression(pair.Pattern)
+		})
+	}
+}
+
+// checkString fails if the lexer would not read s back from between
+// quotes: it ends a string at a quote and starts an interpolation at ${,
+// and has no escapes for either.
+func (p *printer) checkString(pos token.Position, s string) {
+	if strings.Contains(s, `"`) || strings.Contains(s, "${") {
+		p.fail(pos, "cannot format string %q, which holds a quote or ${", s)
+	}
+}
+
+// match prints a match expression with one arm per line.
+func (p *printer) match(me *ast.MatchExpression) {
+	p.print("match (")
+	p.expression(me.Value)
+	p.print(") ")
+	if len(me.Arms) == 0 {
+		p.print("{}")
+		return
+	}
+
+	p.print("{")
+	p.indent++
+	for i, arm := range me.Arms {
+		p.newline()
+		p.expression(arm.Pattern)
+		if arm.Guard != nil {
+			p.print(" if ")
+			p.expression(arm.Guard)
+		}
+		p.print(" => ")
+		p.expression(arm.Body)
+		if i < len(me.Arms)-1 {
+			p.print(",")
+		}
+	}
+	p.indent--
+	p.newline()
+	p.print("}")
+	if me.Rbrace.Line > p.lastLine {
+		p.lastLine = me.Rbrace.Line
+	}
+}
+
+func (p *printer) operand(e ast.Expression, parenthesize bool) {
+	if parenthesize {
+		p.print("(")
+		p.expression(e)
+		p.print(")")
+		return
+	}
+	p.expression(e)
+}
+
+func (p *printer) parameters(params []*ast.Identifier, defaults, patterns []ast.Expression, variadic bool) {
+	p.print("(")
+	for i, param := range params {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.checkComments(param.Token.Pos)
+		if variadic && i == len(params)-1 {
+			p.print("...")
+		}
+		if i < len(patterns) && patterns[i] != nil {
+			p.expression(patterns[i])
+		} else {
+			p.print(param.Value)
+		}
+		if i < len(defaults) && defaults[i] != nil {
+			p.print(" = ")
+			p.expression(defaults[i])
+		}
+	}
+	p.print(") ")
+}
+
+// list prints the n items of an array or hash literal on one line if they
+// fit, and one item per line otherwise.
+func (p *printer) list(open, close string, n int, item func(i int)) {
+	if n == 0 {
+		p.print(open + close)
+		return
+	}
+
+	flat := p.scratch(func() {
+		p.print(open)
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				p.print(", ")
+			}
+			item(i)
+		}
+		p.print(close)
+	})
+	if !strings.Contains(flat, "\n") && p.column()+len(flat) <= maxWidth {
+		p.print(flat)
+		return
+	}
+
+	p.print(open)
+	p.indent++
+	for i := 0; i < n; i++ {
+		p.newline()
+		item(i)
+		if i < n-1 {
+			p.print(",")
+		}
+	}
+	p.indent--
+	p.newline()
+	p.print(close)
+}
+
+// scratch renders f on a single line without consuming any comments and
+// returns the result.
+func (p *printer) scratch(f func()) string {
+	saved := *p
+	p.out = bytes.Buffer{}
+	p.pendingIndent = false
+	f()
+	rendered := p.out.String()
+	err := p.err
+	*p = saved
+	p.err = err
+	return rendered
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(token.TokenType(e.Operator))
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.SliceExpression:
+		return parser.INDEX
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+// hashKeys orders the keys of a hash literal as they appeared in the
+// source. Keys without a position sort last, by their string form.
+func hashKeys(hl *ast.HashLiteral) []ast.Expression {
+	keys := ast.SortedKeys(hl)
+	positioned := []ast.Expression{}
+	rest := []ast.Expression{}
+	for _, k := range keys {
+		if ast.Pos(k).IsValid() {
+			positioned = append(positioned, k)
+		} else {
+			rest = append(rest, k)
+		}
+	}
+	sort.SliceStable(positioned, func(i, j int) bool {
+		a, b := ast.Pos(positioned[i]), ast.Pos(positioned[j])
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return append(positioned, rest...)
+}
@@ -0,0 +1,249 @@
+package format
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=5", "let x = 5;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"1-(2-3)", "1 - (2 - 3);\n"},
+		{"(1-2)-3", "1 - 2 - 3;\n"},
+		{"-(a+b)", "-(a + b);\n"},
+		{"!(true==false)", "!(true == false);\n"},
+		{"a+b(c)[0]", "a + b(c)[0];\n"},
+		{"(a+b)[0]", "(a + b)[0];\n"},
+		{"s[ 1 : n-1 ]", "s[1:n - 1];\n"},
+		{"(a+b)[0:2][1]", "(a + b)[0:2][1];\n"},
+		{"a[ : -1 ]", "a[:-1];\n"},
+		{"a[1 :: 2 ]", "a[1::2];\n"},
+		{"a[::]", "a[:];\n"},
+		{"(-f)(1)", "(-f)(1);\n"},
+		{"(a<b)==(c>d)", "a < b == c > d;\n"},
+		{`"hello"+" "+"world"`, `"hello" + " " + "world";` + "\n"},
+		{"return x", "return x;\n"},
+		{"[]; {}", "[];\n{};\n"},
+		{"fn(){}", "fn() {};\n"},
+		{"fn(a,b=1+2,...c){}", "fn(a, b = 1 + 2, ...c) {};\n"},
+		{"f(1,...xs)", "f(1, ...xs);\n"},
+		{"let [a,b,...c]=x", "let [a, b, ...c] = x;\n"},
+		{`let {a,"b":c,d:[e],}=x`, `let {a, "b": c, d: [e]} = x;` + "\n"},
+		{"fn([a],{b}={}){}", "fn([a], {b} = {}) {};\n"},
+		{`"a${x+1}b${ f( y ) }"`, `"a${x + 1}b${f(y)}";` + "\n"},
+		{`"${ {"k":1}["k"] }"`, `"${{"k": 1}["k"]}";` + "\n"},
+		{"match(x){}", "match (x) {};\n"},
+		{
+			`match(x){0=>"zero",[a,...b]=>a,{"type":"user",name}=>name,n if n>10=>n,-1=>(1+2)*3,_=>null,}`,
+			"match (x) {\n    0 => \"zero\",\n    [a, ...b] => a,\n    {\"type\": \"user\", name} => name,\n    n if n > 10 => n,\n    -1 => (1 + 2) * 3,\n    _ => null\n};\n",
+		},
+		{
+			"let add = fn(a,b){a+b};",
+			"let add = fn(a, b) {\n    a + b\n};\n",
+		},
+		{
+			"if(x>1){return x;}else{let y=1;y}",
+			"if (x > 1) {\n    return x;\n} else {\n    let y = 1;\n    y\n};\n",
+		},
+		{
+			"let m = macro(a){quote(unquote(a))};",
+			"let m = macro(a) {\n    quote(unquote(a))\n};\n",
+		},
+		{
+			`{"b": 1, "a": 2, 3: [1,2]}`,
+			`{"b": 1, "a": 2, 3: [1, 2]};` + "\n",
+		},
+		{
+			"let a = 1;\n\n\n\nlet b = 2;\nlet c = 3;",
+			"let a = 1;\n\nlet b = 2;\nlet c = 3;\n",
+		},
+		{
+			`let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}, {"name": "Bob"}];`,
+			`let people = [
+    {"name": "Alice", "age": 24},
+    {"name": "Anna", "age": 28},
+    {"name": "Bob"}
+];
+`,
+		},
+		{
+			`let h = {"long key number one": 1111111111, "long key number two": 22222222222222};`,
+			`let h = {
+    "long key number one": 1111111111,
+    "long key number two": 22222222222222
+};
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Errorf("input %q: unexpected error %s", tt.input, err)
+			continue
+		}
+
+		if string(formatted) != tt.expected {
+			t.Errorf("input %q:\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	input := `// Package header.
+
+let x = 1; // one
+// before y
+let y = fn(a) { // moved
+  // inside
+  a
+  // end of body
+};
+// the end
+`
+	expected := `// Package header.
+
+let x = 1; // one
+// before y
+// moved
+let y = fn(a) {
+    // inside
+    a
+    // end of body
+};
+// the end
+`
+
+	formatted, err := Source([]byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+
+	if string(formatted) != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, formatted)
+	}
+}
+
+func TestSourceIdempotent(t *testing.T) {
+	inputs := []string{
+		`let fibonacci = fn(x) {
+    if (x == 0) { 0 } else { if (x == 1) { return 1; } else { fibonacci(x - 1) + fibonacci(x - 2); } }
+};
+fibonacci(15); // result
+
+
+// trailing`,
+		`let people = [{"name": "Alice", "age": 24}, {"name": "Anna", "age": 28}, {"name": "Bob"}, [fn(x) { x }]];`,
+		`let newAdder = fn(x) {
+	fn(y) { x + y } // closure
+};
+let addTwo = newAdder(2); addTwo(3)`,
+		`let describe = fn(x) { match (x) { 0 => "zero", [first, ...others] => first, n if n > 10 => "big", _ => "other" } };
+
+describe(11)`,
+		`let greet = fn(name) { "Hello, ${name}! You have ${len([1, 2])} new ${"messages"}." }; greet("Anna")`,
+	}
+
+	for _, input := range inputs {
+		first, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("unexpected error %s", err)
+		}
+
+		second, err := Source(first)
+		if err != nil {
+			t.Fatalf("unexpected error formatting output %q: %s", first, err)
+		}
+
+		if string(first) != string(second) {
+			t.Errorf("formatting not idempotent.\nfirst=%q\nsecond=%q", first, second)
+		}
+
+		if program(t, input) != program(t, string(first)) {
+			t.Errorf("formatting changed the program.\nwant=%q\ngot=%q",
+				program(t, input), program(t, string(first)))
+		}
+	}
+}
+
+func program(t *testing.T, input string) string {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return Node(program)
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source([]byte("let x = (1 + 2;"))
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "1:15: expected next token to be )") {
+		t.Errorf("wrong error, got %q", err.Error())
+	}
+}
+
+func TestNode(t *testing.T) {
+	p := parser.New(lexer.New("let f = fn(x) { x * (2 + 3) }; f(1)"))
+	program := p.ParseProgram()
+
+	expected := "let f = fn(x) {\n    x * (2 + 3)\n};\nf(1);"
+	if Node(program) != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, Node(program))
+	}
+
+	if Node(program.Statements[1]) != "f(1);" {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", "f(1);", Node(program.Statements[1]))
+	}
+}
+
+func TestSourceCommentInsideExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [\n    1, // one\n    2\n];", "2:8: cannot format a comment inside an expression"},
+		{"let a = [\n    1,\n    2 // two\n];", "3:7: cannot format a comment inside an expression"},
+		{"let h = {\n    // key\n    \"a\": 1\n};", "2:5: cannot format a comment inside an expression"},
+		{"f(1,\n    // second\n    2);", "2:5: cannot format a comment inside an expression"},
+		{"let f = fn(a,\n    // b\n    b) { a };", "2:5: cannot format a comment inside an expression"},
+		{"let x = fn() {\n    [1, // one\n    2]\n};", "2:9: cannot format a comment inside an expression"},
+	}
+
+	for _, tt := range tests {
+		_, err := Source([]byte(tt.input))
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestStringWithoutEscapes(t *testing.T) {
+	p := &printer{}
+	p.expression(&ast.StringLiteral{Token: token.Token{Pos: token.Position{Line: 1, Column: 1}}, Value: `say "hi"`})
+	if p.err == nil || p.err.Error() != `1:1: cannot format string "say \"hi\"", which holds a quote or ${` {
+		t.Errorf("wrong error, got %v", p.err)
+	}
+
+	p = &printer{}
+	p.expression(&ast.StringLiteral{Value: "line\nbreak $ {}"})
+	if p.err != nil {
+		t.Errorf("unexpected error %s", p.err)
+	}
+}
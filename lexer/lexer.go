@@ -1,21 +1,40 @@
 package lexer
 
-import "interpreter/token"
+import (
+	"interpreter/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
 	ch           byte
+
+	line   int
+	column int
+
+	comments []token.Token
+
+	// templates holds, for each interpolation being lexed, the number of
+	// braces opened inside it that are not closed yet.
+	templates []int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -29,6 +48,8 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := token.Position{Line: l.line, Column: l.column}
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -36,6 +57,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ARROW, Literal: literal}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -67,8 +93,19 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		if n := len(l.templates); n > 0 && l.templates[n-1] == 0 {
+			l.templates = l.templates[:n-1]
+			tok = l.readTemplate(token.TEMPLATE_TAIL, token.TEMPLATE_MIDDLE)
+			break
+		}
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
@@ -78,20 +115,29 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COMMA, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readTemplate(token.STRING, token.TEMPLATE_HEAD)
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookUpIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -99,6 +145,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
@@ -119,9 +166,35 @@ func isLetter(ch byte) bool {
 }
 
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	pos := token.Position{Line: l.line, Column: l.column}
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	l.comments = append(l.comments, token.Token{
+		Type:    token.COMMENT,
+		Literal: strings.TrimRight(l.input[position:l.position], " \t\r"),
+		Pos:     pos,
+	})
+}
+
+// Comments returns the `//` comments the lexer has skipped so far, in
+// source order.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 func isDigit(ch byte) bool {
@@ -136,15 +209,35 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
+// readTemplate reads the text that follows the current character up to
+// the closing quote, giving a token of type end, or up to the next "${",
+// giving a token of type interpolated.
+func (l *Lexer) readTemplate(end, interpolated token.TokenType) token.Token {
+	text, ok := l.readString()
+	if ok {
+		l.templates = append(l.templates, 0)
+		return token.Token{Type: interpolated, Literal: text}
+	}
+	return token.Token{Type: end, Literal: text}
+}
+
+// readString reads a string up to the closing quote, or up to and
+// including the "$" of an interpolation, which it reports. The closing
+// quote and the "{" are left for NextToken to skip.
+func (l *Lexer) readString() (string, bool) {
 	position := l.position + 1
 	for {
 		l.readChar()
+		if l.ch == '$' && l.peekChar() == '{' {
+			text := l.input[position:l.position]
+			l.readChar()
+			return text, true
+		}
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
 	}
-	return l.input[position:l.position]
+	return l.input[position:l.position], false
 }
 
 func (l *Lexer) peekChar() byte {
@@ -154,3 +247,12 @@ func (l *Lexer) peekChar() byte {
 		return l.input[l.readPosition]
 	}
 }
+
+// peekCharAt returns the character n places after the one peekChar
+// returns.
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.readPosition+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+n]
+}
@@ -35,6 +35,115 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+func TestEllipsis(t *testing.T) {
+	input := `f(...xs) .. .`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "xs"},
+		{token.RPAREN, ")"},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.ILLEGAL, "."},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d] - token wrong. Expected %q got %q", i,
+				tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] literal wrong. Expected %q got %q", i,
+				tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	input := `match (x) { 0 => a, _ => = > }`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.INT, "0"},
+		{token.ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.ARROW, "=>"},
+		{token.ASSIGN, "="},
+		{token.GT, ">"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d] - token wrong. Expected %q got %q", i,
+				tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] literal wrong. Expected %q got %q", i,
+				tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	input := `"a ${b + {"c": 1}["c"]} d ${"e ${f}"}" "g" "$ {}"`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_HEAD, "a "},
+		{token.IDENT, "b"},
+		{token.PLUS, "+"},
+		{token.LBRACE, "{"},
+		{token.STRING, "c"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "c"},
+		{token.RBRACKET, "]"},
+		{token.TEMPLATE_MIDDLE, " d "},
+		{token.TEMPLATE_HEAD, "e "},
+		{token.IDENT, "f"},
+		{token.TEMPLATE_TAIL, ""},
+		{token.TEMPLATE_TAIL, ""},
+		{token.STRING, "g"},
+		{token.STRING, "$ {}"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d] - token wrong. Expected %q got %q", i,
+				tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("test[%d] literal wrong. Expected %q got %q", i,
+				tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
 func TestNextTokenWithFunction(t *testing.T) {
 	input := `let five = 5;
 		let ten = 10;
@@ -157,3 +266,79 @@ func TestNextTokenWithFunction(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  "foo" + x`
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.STRING, 2, 3},
+		{token.PLUS, 2, 9},
+		{token.IDENT, 2, 11},
+		{token.EOF, 2, 12},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("test[%d] - token wrong. Expected %q got %q", i,
+				tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("test[%d] position wrong. Expected %d:%d got %s", i,
+				tt.expectedLine, tt.expectedColumn, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// first
+let x = 5; // five
+x / 2 //last`
+
+	expectedTypes := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH, token.INT, token.EOF,
+	}
+
+	l := New(input)
+	for i, expected := range expectedTypes {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("test[%d] - token wrong. Expected %q got %q", i, expected, tok.Type)
+		}
+	}
+
+	expectedComments := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"// first", 1, 1},
+		{"// five", 2, 12},
+		{"//last", 3, 7},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expectedComments) {
+		t.Fatalf("comments, expected %d got %d", len(expectedComments), len(comments))
+	}
+	for i, tt := range expectedComments {
+		c := comments[i]
+		if c.Type != token.COMMENT || c.Literal != tt.literal ||
+			c.Pos.Line != tt.line || c.Pos.Column != tt.column {
+			t.Errorf("comment[%d], expected %q at %d:%d got %q at %s", i,
+				tt.literal, tt.line, tt.column, c.Literal, c.Pos)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"interpreter/lint"
+	"io"
+	"os"
+)
+
+// runLint implements `lint [files]`. Without files it lints standard input.
+// The exit status is 1 when any diagnostic is reported and 2 on errors.
+func runLint(args []string) int {
+	if len(args) == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return lintSource("<stdin>", src)
+	}
+
+	status := 0
+	for _, name := range args {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+		if s := lintSource(name, src); s > status {
+			status = s
+		}
+	}
+	return status
+}
+
+func lintSource(name string, src []byte) int {
+	diagnostics, err := lint.Source(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 2
+	}
+
+	for _, d := range diagnostics {
+		fmt.Printf("%s:%s\n", name, d)
+	}
+	if len(diagnostics) != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,402 @@
+// Package lint reports likely mistakes in scripts before they run.
+package lint
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"interpreter/token"
+	"sort"
+	"strings"
+)
+
+// Rule IDs, as used in diagnostics and suppression comments.
+const (
+	UnusedBinding     = "unused-binding"
+	UnusedParameter   = "unused-parameter"
+	ShadowedBuiltin   = "shadowed-builtin"
+	UnreachableCode   = "unreachable-code"
+	BuiltinArity      = "builtin-arity"
+	ConstantCondition = "constant-condition"
+)
+
+const ignoreDirective = "lint:ignore"
+
+type Diagnostic struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Source parses and lints src. Diagnostics on a line that carries, or
+// directly follows a line that carries, a `// lint:ignore` comment are
+// dropped. The comment may name the rules to ignore, separated by commas;
+// without names it ignores every rule.
+func Source(src []byte) ([]Diagnostic, error) {
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		errs := []error{}
+		for _, err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	ignored := ignoredRules(l.Comments())
+
+	diagnostics := []Diagnostic{}
+	for _, d := range Program(program) {
+		if suppressed(ignored[d.Pos.Line], d.Rule) ||
+			suppressed(ignored[d.Pos.Line-1], d.Rule) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics, nil
+}
+
+// Program lints an already parsed program, sorted by position.
+func Program(program *ast.Program) []Diagnostic {
+	l := &linter{}
+	l.scope = newScope(nil)
+	l.statements(program.Statements)
+	l.closeScope()
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i].Pos, l.diagnostics[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return l.diagnostics
+}
+
+func ignoredRules(comments []token.Token) map[int][]string {
+	ignored := make(map[int][]string)
+	for _, c := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(c.Literal, "//"))
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+
+		rules := []string{}
+		for _, r := range strings.Split(strings.TrimPrefix(text, ignoreDirective), ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				rules = append(rules, r)
+			}
+		}
+		if len(rules) == 0 {
+			rules = []string{"*"}
+		}
+		ignored[c.Pos.Line] = append(ignored[c.Pos.Line], rules...)
+	}
+	return ignored
+}
+
+func suppressed(rules []string, rule string) bool {
+	for _, r := range rules {
+		if r == "*" || r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+type binding struct {
+	name string
+	pos  token.Position
+	rule string
+	used bool
+}
+
+// scope tracks the bindings of the program or of one function. Top-level
+// bindings are never reported as unused, since other scripts (and the test
+// runner) may call into them.
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+	all      []*binding
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, bindings: make(map[string]*binding)}
+}
+
+func (s *scope) resolve(name string) (*binding, bool) {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.bindings[name]; ok {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+type linter struct {
+	scope       *scope
+	diagnostics []Diagnostic
+}
+
+func (l *linter) report(pos token.Position, rule, format string, a ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Pos:     pos,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+func (l *linter) openScope() {
+	l.scope = newScope(l.scope)
+}
+
+func (l *linter) closeScope() {
+	if l.scope.outer != nil {
+		for _, b := range l.scope.all {
+			if !b.used && b.rule != "" && !strings.HasPrefix(b.name, "_") {
+				kind := "binding"
+				if b.rule == UnusedParameter {
+					kind = "parameter"
+				}
+				l.report(b.pos, b.rule, "%s %s is never used", kind, b.name)
+			}
+		}
+	}
+	l.scope = l.scope.outer
+}
+
+// define adds a binding to the current scope. An empty rule means the
+// binding is never reported as unused.
+func (l *linter) define(ident *ast.Identifier, rule string) {
+	if object.GetBuiltinByName(ident.Value) != nil {
+		l.report(ident.Token.Pos, ShadowedBuiltin,
+			"%s shadows the builtin function %s", ident.Value, ident.Value)
+	}
+
+	b := &binding{name: ident.Value, pos: ident.Token.Pos, rule: rule}
+	l.scope.bindings[ident.Value] = b
+	l.scope.all = append(l.scope.all, b)
+}
+
+func (l *linter) statements(statements []ast.Statement) {
+	returned := false
+	for _, s := range statements {
+		if returned {
+			l.report(ast.Pos(s), UnreachableCode, "unreachable code after return")
+			returned = false
+		}
+		l.statement(s)
+		if _, ok := s.(*ast.ReturnStatement); ok {
+			returned = true
+		}
+	}
+}
+
+func (l *linter) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		if s.Pattern != nil {
+			l.expression(s.Value)
+			l.pattern(s.Pattern, UnusedBinding)
+			return
+		}
+		l.define(s.Name, UnusedBinding)
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok && fn.Name == s.Name.Value {
+			l.function(fn.Parameters, fn.Defaults, fn.Patterns, fn.Body, fn.Name)
+			return
+		}
+		l.expression(s.Value)
+	case *ast.ReturnStatement:
+		l.expression(s.ReturnValue)
+	case *ast.ExpressionStatement:
+		l.expression(s.Expression)
+	}
+}
+
+// function lints a function or macro body in a new scope. A named function
+// can refer to itself; like the compiler, that reference resolves to the
+// function itself and does not count as a use of the outer binding. Default
+// values see the parameters before their own, but not the names bound by
+// patterns, which are destructured last.
+func (l *linter) function(params []*ast.Identifier, defaults, patterns []ast.Expression, body *ast.BlockStatement, name string) {
+	l.openScope()
+	if name != "" {
+		self := &binding{name: name}
+		l.scope.bindings[name] = self
+	}
+	for i, p := range params {
+		if i < len(defaults) {
+			l.expression(defaults[i])
+		}
+		if i < len(patterns) && patterns[i] != nil {
+			continue
+		}
+		l.define(p, UnusedParameter)
+	}
+	for _, pattern := range patterns {
+		if pattern != nil {
+			l.pattern(pattern, UnusedParameter)
+		}
+	}
+	if body != nil {
+		l.statements(body.Statements)
+	}
+	l.closeScope()
+}
+
+// pattern defines the identifiers bound by a destructuring pattern.
+func (l *linter) pattern(pattern ast.Expression, rule string) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		l.define(pattern, rule)
+	case *ast.ArrayPattern:
+		for _, e := range pattern.Elements {
+			l.pattern(e, rule)
+		}
+		if pattern.Rest != nil {
+			l.define(pattern.Rest, rule)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			l.expression(pair.Key)
+			l.pattern(pair.Pattern, rule)
+		}
+	}
+}
+
+// arms lints the arms of a match expression. Their bindings belong to the
+// enclosing scope, like those of a let statement in an if branch. An arm
+// after one that matches anything can never run.
+func (l *linter) arms(arms []*ast.MatchArm) {
+	catchAll := false
+	for _, arm := range arms {
+		if catchAll {
+			l.report(ast.Pos(arm.Pattern), UnreachableCode, "unreachable match arm after a catch-all arm")
+			catchAll = false
+		}
+		l.pattern(arm.Pattern, UnusedBinding)
+		l.expression(arm.Guard)
+		l.expression(arm.Body)
+		if _, ok := arm.Pattern.(*ast.Identifier); ok && arm.Guard == nil {
+			catchAll = true
+		}
+	}
+}
+
+func (l *linter) block(b *ast.BlockStatement) {
+	if b != nil {
+		l.statements(b.Statements)
+	}
+}
+
+func (l *linter) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if b, ok := l.scope.resolve(e.Value); ok {
+			b.used = true
+		}
+	case *ast.PrefixExpression:
+		l.expression(e.Right)
+	case *ast.InfixExpression:
+		l.expression(e.Left)
+		l.expression(e.Right)
+	case *ast.IfExpression:
+		if isConstant(e.Condition) {
+			l.report(ast.Pos(e.Condition), ConstantCondition,
+				"condition is always %s", truthiness(e.Condition))
+		}
+		l.expression(e.Condition)
+		l.block(e.Consequence)
+		l.block(e.Alternative)
+	case *ast.MatchExpression:
+		l.expression(e.Value)
+		l.arms(e.Arms)
+	case *ast.FunctionLiteral:
+		l.function(e.Parameters, e.Defaults, e.Patterns, e.Body, e.Name)
+	case *ast.MacroLiteral:
+		l.function(e.Parameters, nil, nil, e.Body, "")
+	case *ast.CallExpression:
+		l.call(e)
+	case *ast.SpreadExpression:
+		l.expression(e.Value)
+	case *ast.TemplateLiteral:
+		for _, v := range e.Values {
+			l.expression(v)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			l.expression(el)
+		}
+	case *ast.IndexExpression:
+		l.expression(e.Left)
+		l.expression(e.Index)
+	case *ast.SliceExpression:
+		l.expression(e.Left)
+		l.expression(e.Start)
+		l.expression(e.End)
+		l.expression(e.Step)
+	case *ast.HashLiteral:
+		for _, key := range ast.SortedKeys(e) {
+			l.expression(key)
+			l.expression(e.Pairs[key])
+		}
+	}
+}
+
+func (l *linter) call(call *ast.CallExpression) {
+	l.expression(call.Function)
+	for _, arg := range call.Arguments {
+		l.expression(arg)
+	}
+
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return
+	}
+	if _, ok := l.scope.resolve(ident.Value); ok {
+		return
+	}
+
+	// Spread arguments are only counted at runtime.
+	for _, arg := range call.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return
+		}
+	}
+
+	builtin := object.GetBuiltinByName(ident.Value)
+	if builtin != nil && !builtin.Arity.Accepts(len(call.Arguments)) {
+		want := builtin.Arity
+		l.report(ast.Pos(call), BuiltinArity,
+			"%s expects %s argument%s, got %d", ident.Value, want,
+			plural(want), len(call.Arguments))
+	}
+}
+
+func isConstant(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.Boolean, *ast.IntegerLiteral, *ast.StringLiteral,
+		*ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral:
+		return true
+	}
+	return false
+}
+
+func truthiness(e ast.Expression) string {
+	if b, ok := e.(*ast.Boolean); ok && !b.Value {
+		return "false"
+	}
+	return "true"
+}
+
+func plural(a object.Arity) string {
+	if a.Required+a.Optional == 1 && !a.Variadic {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,157 @@
+package lint
+
+import (
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let x = 1; let f = fn(a, b) { let y = a; 1 }; f(1, 2);",
+			[]string{
+				"1:26: parameter b is never used (unused-parameter)",
+				"1:35: binding y is never used (unused-binding)",
+			},
+		},
+		{
+			"fn(_a) { let _b = 1; 2 }",
+			[]string{},
+		},
+		{
+			"let len = fn(first) { first }; len(1);",
+			[]string{
+				"1:5: len shadows the builtin function len (shadowed-builtin)",
+				"1:14: first shadows the builtin function first (shadowed-builtin)",
+			},
+		},
+		{
+			"fn() {\n  return 1;\n  let x = 2;\n  x\n}",
+			[]string{
+				"3:3: unreachable code after return (unreachable-code)",
+			},
+		},
+		{
+			"len(); first([1], 2); push([1]); len([1]); rest([1]);",
+			[]string{
+				"1:1: len expects 1 argument, got 0 (builtin-arity)",
+				"1:8: first expects 1 argument, got 2 (builtin-arity)",
+				"1:23: push expects 2 arguments, got 1 (builtin-arity)",
+			},
+		},
+		{
+			`substr("a"); format(); range(1, 2, 3, 4); puts(); sort([1], 1)`,
+			[]string{
+				"1:1: substr expects 2 to 3 arguments, got 1 (builtin-arity)",
+				"1:14: format expects 1 or more arguments, got 0 (builtin-arity)",
+				"1:24: range expects 1 to 3 arguments, got 4 (builtin-arity)",
+			},
+		},
+		{
+			"let f = fn(len) { len() }; f(1);",
+			[]string{
+				"1:12: len shadows the builtin function len (shadowed-builtin)",
+			},
+		},
+		{
+			"if (true) { 1 }; if (false) { 2 }; if (1) { 3 }; let x = true; if (x) { 4 };",
+			[]string{
+				"1:5: condition is always true (constant-condition)",
+				"1:22: condition is always false (constant-condition)",
+				"1:40: condition is always true (constant-condition)",
+			},
+		},
+		{
+			"let outer = fn() { let fib = fn(n) { fib(n - 1) }; 1 }; outer();",
+			[]string{
+				"1:24: binding fib is never used (unused-binding)",
+			},
+		},
+		{
+			"let unused = 1; let g = fn(x) { x };",
+			[]string{},
+		},
+		{
+			"fn(a, b = a, ...others) { b }; len(...[[1]]);",
+			[]string{
+				"1:17: parameter others is never used (unused-parameter)",
+			},
+		},
+		{
+			"let f = fn({x, y: z}) { let [a, ...others] = x; a }; f(1);",
+			[]string{
+				"1:19: parameter z is never used (unused-parameter)",
+				"1:36: binding others is never used (unused-binding)",
+			},
+		},
+		{
+			"fn(x) { match (x) { [a, b] => a, _ => 0, n => n } }",
+			[]string{
+				"1:25: binding b is never used (unused-binding)",
+				"1:42: unreachable match arm after a catch-all arm (unreachable-code)",
+			},
+		},
+		{
+			`let f = fn(a, b) { "${a}: ${len()}" }; f(1, 2);`,
+			[]string{
+				"1:15: parameter b is never used (unused-parameter)",
+				"1:29: len expects 1 argument, got 0 (builtin-arity)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Source([]byte(tt.input))
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want=%d, got=%d (%v)",
+				tt.input, len(tt.expected), len(diagnostics), diagnostics)
+			continue
+		}
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("diagnostic %d wrong. want=%q, got=%q", i, tt.expected[i], d.String())
+			}
+		}
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	input := `fn() {
+    let a = 1; // lint:ignore unused-binding
+    // lint:ignore
+    let b = 2;
+    let c = 3; // lint:ignore shadowed-builtin, constant-condition
+    let d = 4;
+}`
+
+	diagnostics, err := Source([]byte(input))
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+
+	expected := []string{
+		"5:9: binding c is never used (unused-binding)",
+		"6:9: binding d is never used (unused-binding)",
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d (%v)",
+			len(expected), len(diagnostics), diagnostics)
+	}
+	for i, d := range diagnostics {
+		if d.String() != expected[i] {
+			t.Errorf("diagnostic %d wrong. want=%q, got=%q", i, expected[i], d.String())
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source([]byte("let = 1;")); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
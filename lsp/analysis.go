@@ -0,0 +1,280 @@
+package lsp
+
+import (
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/object"
+	"interpreter/token"
+)
+
+// definition is a name introduced by a let statement or a function
+// parameter.
+type definition struct {
+	name  *ast.Identifier
+	value ast.Expression // nil for parameters, the pattern for destructured names, the match for arm bindings
+	scope compiler.SymbolScope
+}
+
+func (d *definition) isParameter() bool {
+	return d.value == nil
+}
+
+// reference is an occurrence of an identifier, including the one in its
+// own definition. def is nil for builtins and unresolved names.
+type reference struct {
+	ident  *ast.Identifier
+	def    *definition
+	symbol compiler.Symbol
+	found  bool
+}
+
+// scope mirrors a compiler.SymbolTable and remembers where each of its
+// names was defined. An invalid end means the scope is not closed.
+type scope struct {
+	outer      *scope
+	table      *compiler.SymbolTable
+	defs       map[string]*definition
+	ordered    []*definition
+	start, end token.Position
+}
+
+func (s *scope) contains(pos token.Position) bool {
+	if before(pos, s.start) {
+		return false
+	}
+	return !s.end.IsValid() || !before(s.end, pos)
+}
+
+// analysis resolves every identifier of a program the same way the
+// compiler would.
+type analysis struct {
+	refs   []*reference
+	scopes []*scope
+}
+
+func analyze(program *ast.Program) *analysis {
+	a := &analysis{}
+
+	table := compiler.NewSymbolTable()
+	for i, b := range object.Builtins {
+		table.DefineBuiltin(i, b.Name)
+	}
+	a.openScope(table, token.Position{Line: 1, Column: 1}, token.Position{})
+	a.statements(a.scopes[0], program.Statements)
+	return a
+}
+
+func (a *analysis) openScope(table *compiler.SymbolTable, start, end token.Position) *scope {
+	s := &scope{table: table, defs: make(map[string]*definition), start: start, end: end}
+	if len(a.scopes) != 0 {
+		s.outer = a.scopes[len(a.scopes)-1]
+	}
+	a.scopes = append(a.scopes, s)
+	return s
+}
+
+func (a *analysis) define(s *scope, name *ast.Identifier, value ast.Expression) *definition {
+	symbol := s.table.Define(name.Value)
+	def := &definition{name: name, value: value, scope: symbol.Scope}
+	s.defs[name.Value] = def
+	s.ordered = append(s.ordered, def)
+	a.refs = append(a.refs, &reference{ident: name, def: def, symbol: symbol, found: true})
+	return def
+}
+
+func (a *analysis) resolve(s *scope, ident *ast.Identifier) {
+	ref := &reference{ident: ident}
+	ref.symbol, ref.found = s.table.Resolve(ident.Value)
+	if ref.found && ref.symbol.Scope != compiler.BuiltinScope {
+		for sc := s; sc != nil; sc = sc.outer {
+			if def, ok := sc.defs[ident.Value]; ok {
+				ref.def = def
+				break
+			}
+		}
+	}
+	a.refs = append(a.refs, ref)
+}
+
+func (a *analysis) statements(s *scope, statements []ast.Statement) {
+	for _, stmt := range statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			if stmt.Pattern != nil {
+				a.expression(s, stmt.Value)
+				a.pattern(s, stmt.Pattern, stmt.Pattern)
+				continue
+			}
+			if stmt.Name == nil {
+				continue
+			}
+			def := a.define(s, stmt.Name, stmt.Value)
+			if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && fn.Name != "" {
+				a.function(s, fn.Token.Pos, fn.Parameters, fn.Defaults, fn.Patterns, fn.Body, def)
+				continue
+			}
+			a.expression(s, stmt.Value)
+		case *ast.ReturnStatement:
+			a.expression(s, stmt.ReturnValue)
+		case *ast.ExpressionStatement:
+			a.expression(s, stmt.Expression)
+		}
+	}
+}
+
+// function analyses a function body in a new scope. self is the let
+// binding a named function can refer to itself through. Default values are
+// resolved before the parameter they belong to is defined, and the names
+// bound by parameter patterns are defined after every parameter.
+func (a *analysis) function(outer *scope, start token.Position, params []*ast.Identifier, defaults, patterns []ast.Expression, body *ast.BlockStatement, self *definition) {
+	end := token.Position{}
+	if body != nil {
+		end = body.Rbrace
+	}
+
+	s := a.openScope(compiler.NewEnclosedSymbolTable(outer.table), start, end)
+	if self != nil {
+		s.table.DefineFunctionName(self.name.Value)
+		s.defs[self.name.Value] = self
+	}
+	for i, p := range params {
+		if i < len(defaults) {
+			a.expression(s, defaults[i])
+		}
+		if i < len(patterns) && patterns[i] != nil {
+			s.table.Define(p.Value)
+			continue
+		}
+		a.define(s, p, nil)
+	}
+	for _, pattern := range patterns {
+		if pattern != nil {
+			a.pattern(s, pattern, nil)
+		}
+	}
+	if body != nil {
+		a.statements(s, body.Statements)
+	}
+}
+
+// pattern defines the identifiers bound by a destructuring pattern, with
+// value as their value.
+func (a *analysis) pattern(s *scope, pattern, value ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		a.define(s, pattern, value)
+	case *ast.ArrayPattern:
+		for _, e := range pattern.Elements {
+			a.pattern(s, e, value)
+		}
+		if pattern.Rest != nil {
+			a.define(s, pattern.Rest, value)
+		}
+	case *ast.HashPattern:
+		for _, pair := range pattern.Pairs {
+			a.expression(s, pair.Key)
+			a.pattern(s, pair.Pattern, value)
+		}
+	}
+}
+
+func (a *analysis) expression(s *scope, e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		a.resolve(s, e)
+	case *ast.PrefixExpression:
+		a.expression(s, e.Right)
+	case *ast.InfixExpression:
+		a.expression(s, e.Left)
+		a.expression(s, e.Right)
+	case *ast.IfExpression:
+		a.expression(s, e.Condition)
+		if e.Consequence != nil {
+			a.statements(s, e.Consequence.Statements)
+		}
+		if e.Alternative != nil {
+			a.statements(s, e.Alternative.Statements)
+		}
+	case *ast.MatchExpression:
+		a.expression(s, e.Value)
+		for _, arm := range e.Arms {
+			a.pattern(s, arm.Pattern, e)
+			a.expression(s, arm.Guard)
+			a.expression(s, arm.Body)
+		}
+	case *ast.FunctionLiteral:
+		a.function(s, e.Token.Pos, e.Parameters, e.Defaults, e.Patterns, e.Body, nil)
+	case *ast.MacroLiteral:
+		a.function(s, e.Token.Pos, e.Parameters, nil, nil, e.Body, nil)
+	case *ast.SpreadExpression:
+		a.expression(s, e.Value)
+	case *ast.TemplateLiteral:
+		for _, v := range e.Values {
+			a.expression(s, v)
+		}
+	case *ast.CallExpression:
+		a.expression(s, e.Function)
+		for _, arg := range e.Arguments {
+			a.expression(s, arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			a.expression(s, el)
+		}
+	case *ast.IndexExpression:
+		a.expression(s, e.Left)
+		a.expression(s, e.Index)
+	case *ast.SliceExpression:
+		a.expression(s, e.Left)
+		a.expression(s, e.Start)
+		a.expression(s, e.End)
+		a.expression(s, e.Step)
+	case *ast.HashLiteral:
+		for _, key := range ast.SortedKeys(e) {
+			a.expression(s, key)
+			a.expression(s, e.Pairs[key])
+		}
+	}
+}
+
+// referenceAt returns the identifier under pos, allowing pos to be just
+// past its last character.
+func (a *analysis) referenceAt(pos token.Position) *reference {
+	for _, ref := range a.refs {
+		start := ref.ident.Token.Pos
+		if start.Line == pos.Line && start.Column <= pos.Column &&
+			pos.Column <= start.Column+len(ref.ident.Value) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// visible returns the definitions that can be referred to at pos,
+// innermost first. Shadowed names are left out.
+func (a *analysis) visible(pos token.Position) []*definition {
+	var inner *scope
+	for _, s := range a.scopes {
+		if s.contains(pos) {
+			inner = s
+		}
+	}
+
+	seen := make(map[string]bool)
+	defs := []*definition{}
+	for s := inner; s != nil; s = s.outer {
+		for i := len(s.ordered) - 1; i >= 0; i-- {
+			def := s.ordered[i]
+			if seen[def.name.Value] || !before(def.name.Token.Pos, pos) {
+				continue
+			}
+			seen[def.name.Value] = true
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
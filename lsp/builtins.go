@@ -0,0 +1,25 @@
+package lsp
+
+import "interpreter/object"
+
+type builtinDoc struct {
+	signature string
+	doc       string
+}
+
+// builtinSignature describes a function in object.Builtins for hover and
+// completion.
+func builtinSignature(name string) builtinDoc {
+	if b := object.GetBuiltinByName(name); b != nil && b.Signature != "" {
+		return builtinDoc{signature: b.Signature, doc: b.Doc}
+	}
+	return builtinDoc{signature: name + "(...)"}
+}
+
+func builtinNames() []string {
+	names := []string{}
+	for _, b := range object.Builtins {
+		names = append(names, b.Name)
+	}
+	return names
+}
@@ -0,0 +1,92 @@
+package lsp
+
+import (
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"interpreter/token"
+	"strings"
+	"unicode/utf8"
+)
+
+// document is an open file. It is re-parsed on every change.
+type document struct {
+	uri      string
+	text     string
+	lines    []string
+	program  *ast.Program
+	errors   []*parser.ParseError
+	analysis *analysis
+}
+
+func newDocument(uri, text string) *document {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	return &document{
+		uri:      uri,
+		text:     text,
+		lines:    strings.Split(text, "\n"),
+		program:  program,
+		errors:   p.Errors(),
+		analysis: analyze(program),
+	}
+}
+
+func (d *document) line(n int) string {
+	if n < 0 || n >= len(d.lines) {
+		return ""
+	}
+	return strings.TrimSuffix(d.lines[n], "\r")
+}
+
+// position converts a lexer position, which counts bytes, to an LSP
+// position, which counts UTF-16 code units.
+func (d *document) position(pos token.Position) Position {
+	text := d.line(pos.Line - 1)
+	col := pos.Column - 1
+	if col < 0 {
+		col = 0
+	}
+	if col > len(text) {
+		col = len(text)
+	}
+	return Position{Line: pos.Line - 1, Character: utf16Len(text[:col])}
+}
+
+func (d *document) tokenPosition(p Position) token.Position {
+	text := d.line(p.Line)
+	units, offset := 0, 0
+	for offset < len(text) && units < p.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += utf16Len(string(r))
+		offset += size
+	}
+	return token.Position{Line: p.Line + 1, Column: offset + 1}
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	start := ident.Token.Pos
+	end := token.Position{Line: start.Line, Column: start.Column + len(ident.Value)}
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+func (d *document) endOfLine(line int) Position {
+	return Position{Line: line - 1, Character: utf16Len(d.line(line - 1))}
+}
+
+func (d *document) end() Position {
+	return d.endOfLine(len(d.lines))
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,390 @@
+// Package lsp implements a Language Server Protocol server for scripts,
+// speaking JSON-RPC over a pair of streams.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/format"
+	"interpreter/lint"
+	"interpreter/transport"
+	"io"
+	"strings"
+)
+
+// ErrExitWithoutShutdown is returned by Run when the client sends exit
+// without asking the server to shut down first.
+var ErrExitWithoutShutdown = errors.New("lsp: exit without shutdown")
+
+type Server struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends exit or closes its end of the
+// connection.
+func (s *Server) Run() error {
+	for {
+		msg, err := transport.ReadMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()})
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		result, rerr := s.handle(&req)
+		if req.ID != nil {
+			s.reply(req.ID, result, rerr)
+		}
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		result := initializeResult{ServerInfo: serverInfo{Name: "monkey-lsp"}}
+		result.Capabilities.TextDocumentSync = textDocumentSyncFull
+		result.Capabilities.DefinitionProvider = true
+		result.Capabilities.HoverProvider = true
+		result.Capabilities.DocumentSymbolProvider = true
+		result.Capabilities.DocumentFormattingProvider = true
+		return result, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(s.docs, params.TextDocument.URI)
+		s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/definition":
+		return s.withPosition(req, s.definition)
+	case "textDocument/hover":
+		return s.withPosition(req, s.hover)
+	case "textDocument/completion":
+		return s.withPosition(req, s.completion)
+	case "textDocument/documentSymbol":
+		return s.withDocument(req, s.documentSymbols)
+	case "textDocument/formatting":
+		return s.withDocument(req, s.formatting)
+	}
+
+	if req.ID == nil {
+		// Unknown notifications, including "initialized" and "$/" ones,
+		// are ignored.
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+func (s *Server) document(uri string) (*document, *responseError) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown document: %s", uri)}
+	}
+	return doc, nil
+}
+
+func (s *Server) withDocument(req *request, fn func(*document) interface{}) (interface{}, *responseError) {
+	var params documentParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, invalidParams(err)
+	}
+	doc, rerr := s.document(params.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return fn(doc), nil
+}
+
+func (s *Server) withPosition(req *request, fn func(*document, Position) interface{}) (interface{}, *responseError) {
+	var params textDocumentPositionParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return nil, invalidParams(err)
+	}
+	doc, rerr := s.document(params.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	return fn(doc, params.Position), nil
+}
+
+func (s *Server) update(uri, text string) {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics(doc),
+	})
+}
+
+// diagnostics reports parse errors, or lint warnings when the document
+// parses.
+func diagnostics(doc *document) []Diagnostic {
+	result := []Diagnostic{}
+	for _, err := range doc.errors {
+		end := err.Pos
+		if n := len(err.Found.Literal); n > 0 {
+			end.Column += n
+		} else {
+			end.Column++
+		}
+		result = append(result, Diagnostic{
+			Range:    Range{Start: doc.position(err.Pos), End: doc.position(end)},
+			Severity: SeverityError,
+			Source:   "parser",
+			Message:  err.Message,
+		})
+	}
+	if len(result) != 0 {
+		return result
+	}
+
+	warnings, err := lint.Source([]byte(doc.text))
+	if err != nil {
+		return result
+	}
+	for _, w := range warnings {
+		end := w.Pos
+		end.Column++
+		if ref := doc.analysis.referenceAt(w.Pos); ref != nil {
+			end.Column = w.Pos.Column + len(ref.ident.Value)
+		}
+		result = append(result, Diagnostic{
+			Range:    Range{Start: doc.position(w.Pos), End: doc.position(end)},
+			Severity: SeverityWarning,
+			Code:     w.Rule,
+			Source:   "lint",
+			Message:  w.Message,
+		})
+	}
+	return result
+}
+
+func (s *Server) definition(doc *document, pos Position) interface{} {
+	ref := doc.analysis.referenceAt(doc.tokenPosition(pos))
+	if ref == nil || ref.def == nil {
+		return nil
+	}
+	return Location{URI: doc.uri, Range: doc.identRange(ref.def.name)}
+}
+
+func (s *Server) hover(doc *document, pos Position) interface{} {
+	ref := doc.analysis.referenceAt(doc.tokenPosition(pos))
+	if ref == nil || !ref.found {
+		return nil
+	}
+
+	var value string
+	if ref.def == nil {
+		b := builtinSignature(ref.ident.Value)
+		value = fmt.Sprintf("```monkey\n%s\n```\n\nbuiltin function", b.signature)
+		if b.doc != "" {
+			value += "\n\n" + b.doc
+		}
+	} else {
+		value = fmt.Sprintf("```monkey\n%s\n```\n\n%s %s",
+			describe(ref.def), strings.ToLower(string(ref.symbol.Scope)), kind(ref.def))
+	}
+
+	return Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: value},
+		Range:    doc.identRange(ref.ident),
+	}
+}
+
+func kind(def *definition) string {
+	if def.isParameter() {
+		return "parameter"
+	}
+	return "binding"
+}
+
+// describe renders a definition as it would be declared, e.g. "let x" or
+// "fn add(a, b)".
+func describe(def *definition) string {
+	if _, ok := def.value.(*ast.MatchExpression); ok || def.isParameter() {
+		return def.name.Value
+	}
+	if fn, ok := def.value.(*ast.FunctionLiteral); ok {
+		return fmt.Sprintf("fn %s(%s)", def.name.Value, parameters(fn))
+	}
+	return "let " + def.name.Value
+}
+
+func parameters(fn *ast.FunctionLiteral) string {
+	names := []string{}
+	for i, p := range fn.Parameters {
+		name := p.Value
+		if fn.Variadic && i == len(fn.Parameters)-1 {
+			name = "..." + name
+		} else if def := fn.Default(i); def != nil {
+			name += " = " + def.String()
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (s *Server) completion(doc *document, pos Position) interface{} {
+	items := []CompletionItem{}
+	seen := make(map[string]bool)
+
+	for _, def := range doc.analysis.visible(doc.tokenPosition(pos)) {
+		item := CompletionItem{Label: def.name.Value, Kind: CompletionVariable, Detail: describe(def)}
+		if _, ok := def.value.(*ast.FunctionLiteral); ok {
+			item.Kind = CompletionFunction
+		}
+		seen[def.name.Value] = true
+		items = append(items, item)
+	}
+
+	for _, name := range builtinNames() {
+		if seen[name] {
+			continue
+		}
+		items = append(items, CompletionItem{
+			Label:  name,
+			Kind:   CompletionFunction,
+			Detail: builtinSignature(name).signature,
+		})
+	}
+	return items
+}
+
+func (s *Server) documentSymbols(doc *document) interface{} {
+	return symbols(doc, doc.program.Statements)
+}
+
+func symbols(doc *document, statements []ast.Statement) []DocumentSymbol {
+	result := []DocumentSymbol{}
+	for _, stmt := range statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if let.Pattern != nil {
+			for _, ident := range ast.Bindings(let.Pattern) {
+				result = append(result, DocumentSymbol{
+					Name:           ident.Value,
+					Kind:           SymbolVariable,
+					Range:          Range{Start: doc.position(let.Token.Pos), End: doc.endOfLine(ast.EndLine(let))},
+					SelectionRange: doc.identRange(ident),
+				})
+			}
+			continue
+		}
+		if let.Name == nil {
+			continue
+		}
+
+		sym := DocumentSymbol{
+			Name:           let.Name.Value,
+			Kind:           SymbolVariable,
+			Range:          Range{Start: doc.position(let.Token.Pos), End: doc.endOfLine(ast.EndLine(let))},
+			SelectionRange: doc.identRange(let.Name),
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			sym.Kind = SymbolFunction
+			sym.Detail = fmt.Sprintf("fn(%s)", parameters(fn))
+			if fn.Body != nil {
+				sym.Children = symbols(doc, fn.Body.Statements)
+			}
+		}
+		result = append(result, sym)
+	}
+	return result
+}
+
+func (s *Server) formatting(doc *document) interface{} {
+	res, err := format.Source([]byte(doc.text))
+	if err != nil || string(res) == doc.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: doc.end()},
+		NewText: string(res),
+	}}
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, rerr *responseError) {
+	resp := response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &responseError{Code: codeInternalError, Message: err.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	s.send(resp)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) send(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	transport.WriteMessage(s.out, data)
+}
@@ -0,0 +1,407 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"interpreter/transport"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.monkey"
+
+// client drives a Server over in-memory pipes the way an editor would.
+type client struct {
+	t      *testing.T
+	in     *bufio.Reader
+	out    io.WriteCloser
+	nextID int
+	done   chan error
+}
+
+type message struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:    t,
+		in:   bufio.NewReader(clientIn),
+		out:  clientOut,
+		done: make(chan error, 1),
+	}
+	go func() {
+		err := NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+
+	c.call("initialize", map[string]interface{}{}, nil)
+	c.notify("initialized", map[string]interface{}{})
+	return c
+}
+
+func (c *client) write(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.t.Fatalf("marshal: %s", err)
+	}
+	if err := transport.WriteMessage(c.out, data); err != nil {
+		c.t.Fatalf("write: %s", err)
+	}
+}
+
+func (c *client) read() message {
+	data, err := transport.ReadMessage(c.in)
+	if err != nil {
+		c.t.Fatalf("read: %s", err)
+	}
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.t.Fatalf("unmarshal %s: %s", data, err)
+	}
+	return msg
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// call sends a request and decodes its result into result.
+func (c *client) call(method string, params interface{}, result interface{}) *responseError {
+	c.nextID++
+	c.write(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+
+	msg := c.read()
+	if msg.ID == nil || *msg.ID != c.nextID {
+		c.t.Fatalf("expected response to request %d, got %+v", c.nextID, msg)
+	}
+	if msg.Error == nil && result != nil {
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			c.t.Fatalf("unmarshal result %s: %s", msg.Result, err)
+		}
+	}
+	return msg.Error
+}
+
+// open opens the test document and returns the diagnostics published for
+// it.
+func (c *client) open(text string) []Diagnostic {
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI, "languageId": "monkey", "version": 1, "text": text},
+	})
+	return c.diagnostics()
+}
+
+func (c *client) diagnostics() []Diagnostic {
+	msg := c.read()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %+v", msg)
+	}
+	var params publishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatalf("unmarshal diagnostics: %s", err)
+	}
+	if params.URI != testURI {
+		c.t.Fatalf("diagnostics for wrong document: %s", params.URI)
+	}
+	return params.Diagnostics
+}
+
+func (c *client) close() {
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatalf("shutdown failed: %s", err.Message)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("Run returned error: %s", err)
+	}
+}
+
+func position(line, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+		"position":     map[string]interface{}{"line": line, "character": character},
+	}
+}
+
+func textDocument() map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": testURI},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	diags := c.open("let x = ;\nlet y 5;")
+	want := []Range{
+		{Start: Position{0, 8}, End: Position{0, 9}},
+		{Start: Position{1, 6}, End: Position{1, 7}},
+	}
+	if len(diags) != len(want) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%d (%+v)", len(want), len(diags), diags)
+	}
+	for i, d := range diags {
+		if d.Severity != SeverityError || d.Source != "parser" {
+			t.Errorf("diagnostic %d has wrong severity or source: %+v", i, d)
+		}
+		if d.Range != want[i] {
+			t.Errorf("diagnostic %d has wrong range. want=%+v, got=%+v", i, want[i], d.Range)
+		}
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": testURI, "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": "let f = fn(x) { 1 };\nf(2);"}},
+	})
+	diags = c.diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("wrong number of diagnostics. want=1, got=%d (%+v)", len(diags), diags)
+	}
+	d := diags[0]
+	if d.Severity != SeverityWarning || d.Code != "unused-parameter" {
+		t.Errorf("wrong lint diagnostic: %+v", d)
+	}
+	if d.Range != (Range{Start: Position{0, 11}, End: Position{0, 12}}) {
+		t.Errorf("wrong lint range: %+v", d.Range)
+	}
+
+	c.notify("textDocument/didClose", textDocument())
+	if diags := c.diagnostics(); len(diags) != 0 {
+		t.Errorf("expected diagnostics to be cleared, got %+v", diags)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	c.open(`let a = 1;
+let add = fn(x, y) {
+    let z = x + a;
+    z + y
+};
+add(a, 2);`)
+
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		{2, 12, &Range{Start: Position{1, 13}, End: Position{1, 14}}}, // x
+		{2, 16, &Range{Start: Position{0, 4}, End: Position{0, 5}}},   // a inside fn
+		{3, 4, &Range{Start: Position{2, 8}, End: Position{2, 9}}},    // z
+		{3, 9, &Range{Start: Position{1, 16}, End: Position{1, 17}}},  // y
+		{5, 1, &Range{Start: Position{1, 4}, End: Position{1, 7}}},    // add
+		{5, 4, &Range{Start: Position{0, 4}, End: Position{0, 5}}},    // a
+		{0, 4, &Range{Start: Position{0, 4}, End: Position{0, 5}}},    // a's own definition
+		{5, 7, nil}, // literal
+	}
+
+	for _, tt := range tests {
+		var loc *Location
+		if err := c.call("textDocument/definition", position(tt.line, tt.character), &loc); err != nil {
+			t.Fatalf("definition failed: %s", err.Message)
+		}
+		if tt.expected == nil {
+			if loc != nil {
+				t.Errorf("expected no definition at %d:%d, got %+v", tt.line, tt.character, loc)
+			}
+			continue
+		}
+		if loc == nil {
+			t.Errorf("no definition at %d:%d", tt.line, tt.character)
+			continue
+		}
+		if loc.URI != testURI || loc.Range != *tt.expected {
+			t.Errorf("wrong definition at %d:%d. want=%+v, got=%+v",
+				tt.line, tt.character, *tt.expected, loc.Range)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	c.open(`let n = len("abc");
+let f = fn(x) { x + n };
+let g = fn(a, b = a, ...more) { b };
+let [p, {q}] = [1, {"q": 2}];
+let h = fn([u]) { u + q };
+let k = fn(v) { match (v) { [w] => w, _ => 0 } };
+let s = "${n}!";`)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{0, 9, "```monkey\nlen(value)\n```\n\nbuiltin function\n\nReturns the length of a string, an array or a hash."},
+		{0, 4, "```monkey\nlet n\n```\n\nglobal binding"},
+		{1, 16, "```monkey\nx\n```\n\nlocal parameter"},
+		{1, 20, "```monkey\nlet n\n```\n\nglobal binding"},
+		{1, 4, "```monkey\nfn f(x)\n```\n\nglobal binding"},
+		{2, 4, "```monkey\nfn g(a, b = a, ...more)\n```\n\nglobal binding"},
+		{2, 18, "```monkey\na\n```\n\nlocal parameter"},
+		{3, 5, "```monkey\nlet p\n```\n\nglobal binding"},
+		{4, 18, "```monkey\nu\n```\n\nlocal parameter"},
+		{4, 22, "```monkey\nlet q\n```\n\nglobal binding"},
+		{5, 35, "```monkey\nw\n```\n\nlocal binding"},
+		{6, 11, "```monkey\nlet n\n```\n\nglobal binding"},
+	}
+
+	for _, tt := range tests {
+		var hover *Hover
+		if err := c.call("textDocument/hover", position(tt.line, tt.character), &hover); err != nil {
+			t.Fatalf("hover failed: %s", err.Message)
+		}
+		if hover == nil {
+			t.Errorf("no hover at %d:%d", tt.line, tt.character)
+			continue
+		}
+		if hover.Contents.Value != tt.expected {
+			t.Errorf("wrong hover at %d:%d. want=%q, got=%q",
+				tt.line, tt.character, tt.expected, hover.Contents.Value)
+		}
+	}
+
+	var hover *Hover
+	c.call("textDocument/hover", position(0, 14), &hover)
+	if hover != nil {
+		t.Errorf("expected no hover on a literal, got %+v", hover)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	c.open(`let a = 1;
+let f = fn(len) {
+    let b = 2;
+    
+};
+let c = 3;`)
+
+	var items []CompletionItem
+	if err := c.call("textDocument/completion", position(3, 4), &items); err != nil {
+		t.Fatalf("completion failed: %s", err.Message)
+	}
+
+	labels := []string{}
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	got := strings.Join(labels, " ")
+	want := "b len f a puts first last rest push assert assertEqual assertError name arity split join trim upper lower replace contains startsWith endsWith indexOf substr repeat format chars str int map filter reduce sort reverse slice concat range zip keys values has delete merge"
+	if got != want {
+		t.Errorf("wrong completion items. want=%q, got=%q", want, got)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	c.open(`let a = 1;
+let f = fn(x) {
+    let inner = x;
+    inner
+};
+f(a);`)
+
+	var syms []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", textDocument(), &syms); err != nil {
+		t.Fatalf("documentSymbol failed: %s", err.Message)
+	}
+
+	if len(syms) != 2 {
+		t.Fatalf("wrong number of symbols. want=2, got=%d", len(syms))
+	}
+	if syms[0].Name != "a" || syms[0].Kind != SymbolVariable {
+		t.Errorf("wrong first symbol: %+v", syms[0])
+	}
+	f := syms[1]
+	if f.Name != "f" || f.Kind != SymbolFunction || f.Detail != "fn(x)" {
+		t.Errorf("wrong second symbol: %+v", f)
+	}
+	if f.Range != (Range{Start: Position{1, 0}, End: Position{4, 2}}) {
+		t.Errorf("wrong range: %+v", f.Range)
+	}
+	if len(f.Children) != 1 || f.Children[0].Name != "inner" {
+		t.Errorf("wrong children: %+v", f.Children)
+	}
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	c.open("let x=1;\nif(x){x}")
+
+	var edits []TextEdit
+	if err := c.call("textDocument/formatting", textDocument(), &edits); err != nil {
+		t.Fatalf("formatting failed: %s", err.Message)
+	}
+	if len(edits) != 1 {
+		t.Fatalf("wrong number of edits. want=1, got=%d", len(edits))
+	}
+	want := "let x = 1;\nif (x) {\n    x\n};\n"
+	if edits[0].NewText != want {
+		t.Errorf("wrong formatted text. want=%q, got=%q", want, edits[0].NewText)
+	}
+	if edits[0].Range != (Range{Start: Position{0, 0}, End: Position{1, 8}}) {
+		t.Errorf("wrong edit range: %+v", edits[0].Range)
+	}
+}
+
+func TestUnicodePositions(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	// The emoji is 4 bytes but 2 UTF-16 code units.
+	c.open("let s = \"\U0001F600\"; let t = s;")
+
+	var loc *Location
+	if err := c.call("textDocument/definition", position(0, 22), &loc); err != nil {
+		t.Fatalf("definition failed: %s", err.Message)
+	}
+	if loc == nil || loc.Range != (Range{Start: Position{0, 4}, End: Position{0, 5}}) {
+		t.Errorf("wrong definition: %+v", loc)
+	}
+
+	var hover *Hover
+	c.call("textDocument/hover", position(0, 18), &hover)
+	if hover == nil || hover.Range != (Range{Start: Position{0, 18}, End: Position{0, 19}}) {
+		t.Errorf("wrong hover: %+v", hover)
+	}
+}
+
+func TestProtocolErrors(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+
+	if err := c.call("textDocument/unknown", nil, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", err)
+	}
+	if err := c.call("textDocument/hover", position(0, 0), nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("expected invalid params for unknown document, got %+v", err)
+	}
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrExitWithoutShutdown {
+		t.Errorf("expected ErrExitWithoutShutdown, got %v", err)
+	}
+}
@@ -1,10 +1,37 @@
 package main
 
 import (
+	"fmt"
+	"interpreter/lsp"
 	"interpreter/repl"
 	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		case "debug":
+			os.Exit(runDebug(os.Args[2:]))
+		case "profile":
+			os.Exit(runProfile(os.Args[2:]))
+		case "test":
+			os.Exit(runTest(os.Args[2:]))
+		case "cover":
+			os.Exit(runCover(os.Args[2:]))
+		case "dap":
+			os.Exit(runDAP())
+		case "lsp":
+			if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	repl.Start(os.Stdin, os.Stdout)
 }
@@ -0,0 +1,97 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Arity describes the number of arguments a function accepts.
+type Arity struct {
+	Required int
+	Optional int
+	Variadic bool
+}
+
+// Accepts reports whether a call with n arguments fits the arity.
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Required && (a.Variadic || n <= a.Required+a.Optional)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Variadic:
+		return fmt.Sprintf("%d or more", a.Required)
+	case a.Optional > 0:
+		return fmt.Sprintf("%d to %d", a.Required, a.Required+a.Optional)
+	}
+	return fmt.Sprint(a.Required)
+}
+
+// ArityError returns the message for calling the function with the given
+// signature with n arguments it does not accept.
+func ArityError(signature string, arity Arity, n int) string {
+	return fmt.Sprintf("wrong number of arguments to %s: want=%s, got=%d", signature, arity, n)
+}
+
+// signature formats a function the way it is declared, without its
+// default values, as in "fn f(a, b, ...rest)".
+func signature(name string, params []string, variadic bool) string {
+	if variadic && len(params) > 0 {
+		params = append(params[:len(params)-1:len(params)-1], "..."+params[len(params)-1])
+	}
+	if name != "" {
+		name = " " + name
+	}
+	return fmt.Sprintf("fn%s(%s)", name, strings.Join(params, ", "))
+}
+
+func (f *Function) Arity() Arity {
+	arity := Arity{Variadic: f.Variadic}
+	for i := range f.Parameters {
+		switch {
+		case f.Variadic && i == len(f.Parameters)-1:
+		case i < len(f.Defaults) && f.Defaults[i] != nil:
+			arity.Optional++
+		default:
+			arity.Required++
+		}
+	}
+	return arity
+}
+
+func (f *Function) Signature() string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.Value)
+	}
+	return signature(f.Name, params, f.Variadic)
+}
+
+func (cf *CompiledFunction) Arity() Arity {
+	arity := Arity{
+		Required: cf.NumParameters - cf.NumDefaults,
+		Optional: cf.NumDefaults,
+		Variadic: cf.Variadic,
+	}
+	if cf.Variadic {
+		arity.Required--
+	}
+	return arity
+}
+
+// ParameterNames returns the names of cf's parameters, which are its
+// first locals. A parameter that is a pattern is named after it.
+func (cf *CompiledFunction) ParameterNames() []string {
+	if len(cf.LocalNames) < cf.NumParameters {
+		return nil
+	}
+	names := make([]string, cf.NumParameters)
+	for i, name := range cf.LocalNames[:cf.NumParameters] {
+		names[i] = strings.TrimPrefix(name, HiddenPrefix)
+	}
+	return names
+}
+
+func (cf *CompiledFunction) Signature() string {
+	return signature(cf.Name, cf.ParameterNames(), cf.Variadic)
+}
@@ -1,6 +1,10 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -8,107 +12,523 @@ var Builtins = []struct {
 }{
 	{
 		"len",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments, got %d wanted 1", len(args))
-			}
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, got %d wanted 1", len(args))
+				}
 
-			switch arg := args[0].(type) {
-			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
-			case *Array:
-				return &Integer{Value: int64(len(arg.Elements))}
-			default:
-				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		},
+				switch arg := args[0].(type) {
+				case *String:
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				case *Hash:
+					return &Integer{Value: int64(len(arg.Pairs))}
+				default:
+					return newError("argument to `len` not supported, got %s", args[0].Type())
+				}
+			},
+			Arity:     Arity{Required: 1},
+			Signature: "len(value)",
+			Doc:       "Returns the length of a string, an array or a hash.",
 		},
 	},
 	{
 		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return nil
-		},
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprintln(ctx.Host().Output(), arg.Inspect())
+				}
+				return nil
+			},
+			Arity:     Arity{Variadic: true},
+			Signature: "puts(values...)",
+			Doc:       "Prints each value on its own line and returns null.",
 		},
 	},
 	{
 		"first",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments, got %d wanted 1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
-			}
-			arr := args[0].(*Array)
-			if len(arr.Elements) > 0 {
-				return arr.Elements[0]
-			}
-			return nil
-		},
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, got %d wanted 1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+				}
+				arr := args[0].(*Array)
+				if len(arr.Elements) > 0 {
+					return arr.Elements[0]
+				}
+				return nil
+			},
+			Arity:     Arity{Required: 1},
+			Signature: "first(array)",
+			Doc:       "Returns the first element of an array, or null if it is empty.",
 		},
 	},
 	{
 		"last",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments, got %d wanted 1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
-			}
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				return arr.Elements[length-1]
-			}
-			return nil
-		},
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, got %d wanted 1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+				}
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					return arr.Elements[length-1]
+				}
+				return nil
+			},
+			Arity:     Arity{Required: 1},
+			Signature: "last(array)",
+			Doc:       "Returns the last element of an array, or null if it is empty.",
 		},
 	},
 	{
 		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 1 {
-				return newError("wrong number of arguments, got %d wanted 1", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
-			}
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-			if length > 0 {
-				newElements := make([]Object, length-1, length-1)
-				copy(newElements, arr.Elements[1:length])
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, got %d wanted 1", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+				}
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					newElements := make([]Object, length-1, length-1)
+					copy(newElements, arr.Elements[1:length])
+					return &Array{Elements: newElements}
+				}
+				return &Array{Elements: []Object{}}
+			},
+			Arity:     Arity{Required: 1},
+			Signature: "rest(array)",
+			Doc:       "Returns a new array with every element but the first.",
+		},
+	},
+	{
+		"push",
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments, got %d wanted 2", len(args))
+				}
+				if args[0].Type() != ARRAY_OBJ {
+					return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+				}
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				newElements := make([]Object, length+1, length+1)
+				copy(newElements, arr.Elements)
+				newElements[length] = args[1]
 				return &Array{Elements: newElements}
-			}
-			return nil
+			},
+			Arity:     Arity{Required: 2},
+			Signature: "push(array, value)",
+			Doc:       "Returns a new array with value appended.",
 		},
+	},
+	{
+		"assert",
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newFailure("wrong number of arguments to `assert`, got %d wanted 1 or 2", len(args))
+				}
+				switch cond := args[0].(type) {
+				case *Null:
+				case *Boolean:
+					if cond.Value {
+						return nil
+					}
+				default:
+					return nil
+				}
+				if len(args) == 2 {
+					return newFailure("assertion failed: %s", message(args[1]))
+				}
+				return newFailure("assertion failed")
+			},
+			Arity:     Arity{Required: 1, Optional: 1},
+			Signature: "assert(condition, message?)",
+			Doc:       "Stops the program with a failure unless condition is truthy.",
 		},
 	},
 	{
-		"push",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) != 2 {
-				return newError("wrong number of arguments, got %d wanted 2", len(args))
-			}
-			if args[0].Type() != ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
-			}
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-			newElements := make([]Object, length+1, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-			return &Array{Elements: newElements}
+		"assertEqual",
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 2 {
+					return newFailure("wrong number of arguments to `assertEqual`, got %d wanted 2", len(args))
+				}
+				if !Equal(args[0], args[1]) {
+					return newFailure("assertEqual failed: want=%s, got=%s", inspect(args[1]), inspect(args[0]))
+				}
+				return nil
+			},
+			Arity:     Arity{Required: 2},
+			Signature: "assertEqual(actual, expected)",
+			Doc:       "Stops the program with a failure unless actual equals expected, comparing arrays and hashes element by element.",
 		},
+	},
+	{
+		"assertError",
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 && len(args) != 2 {
+					return newFailure("wrong number of arguments to `assertError`, got %d wanted 1 or 2", len(args))
+				}
+				err, ok := args[0].(*Error)
+				if !ok {
+					return newFailure("assertError failed: want an error, got=%s", inspect(args[0]))
+				}
+				if len(args) == 2 && !strings.Contains(err.Message, message(args[1])) {
+					return newFailure("assertError failed: want an error containing %q, got=%q", message(args[1]), err.Message)
+				}
+				return nil
+			},
+			Arity:     Arity{Required: 1, Optional: 1},
+			Signature: "assertError(value, substring?)",
+			Doc:       "Stops the program with a failure unless value is an error whose message contains substring.",
+		},
+	},
+	{
+		"name",
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, got %d wanted 1", len(args))
+				}
+				switch fn := args[0].(type) {
+				case *Closure:
+					return functionName(fn.Fn.Name)
+				case *Function:
+					return functionName(fn.Name)
+				case *Builtin:
+					return &String{Value: BuiltinName(fn)}
+				default:
+					return newError("argument to `name` must be FUNCTION, got %s", args[0].Type())
+				}
+			},
+			Arity:     Arity{Required: 1},
+			Signature: "name(f)",
+			Doc:       "Returns the name of function f, or null if f is anonymous.",
+		},
+	},
+	{
+		"arity",
+		&Builtin{
+			Fn: func(ctx Context, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, got %d wanted 1", len(args))
+				}
+				switch fn := args[0].(type) {
+				case *Closure:
+					return &Integer{Value: int64(fn.Fn.Arity().Required)}
+				case *Function:
+					return &Integer{Value: int64(fn.Arity().Required)}
+				case *Builtin:
+					return &Integer{Value: int64(fn.Arity.Required)}
+				default:
+					return newError("argument to `arity` must be FUNCTION, got %s", args[0].Type())
+				}
+			},
+			Arity:     Arity{Required: 1},
+			Signature: "arity(f)",
+			Doc:       "Returns the number of arguments function f requires, not counting parameters with a default value or the rest parameter.",
+		},
+	},
+	{
+		"split",
+		&Builtin{
+			Fn:        builtinSplit,
+			Arity:     Arity{Required: 2},
+			Signature: "split(s, separator)",
+			Doc:       "Returns an array of the parts of string s between each separator, or of its characters if separator is empty.",
+		},
+	},
+	{
+		"join",
+		&Builtin{
+			Fn:        builtinJoin,
+			Arity:     Arity{Required: 2},
+			Signature: "join(array, separator)",
+			Doc:       "Returns the elements of an array joined into a string with separator between them, converting them as str does.",
+		},
+	},
+	{
+		"trim",
+		&Builtin{
+			Fn:        builtinTrim,
+			Arity:     Arity{Required: 1},
+			Signature: "trim(s)",
+			Doc:       "Returns string s without its leading and trailing whitespace.",
+		},
+	},
+	{
+		"upper",
+		&Builtin{
+			Fn:        builtinUpper,
+			Arity:     Arity{Required: 1},
+			Signature: "upper(s)",
+			Doc:       "Returns string s in upper case.",
+		},
+	},
+	{
+		"lower",
+		&Builtin{
+			Fn:        builtinLower,
+			Arity:     Arity{Required: 1},
+			Signature: "lower(s)",
+			Doc:       "Returns string s in lower case.",
+		},
+	},
+	{
+		"replace",
+		&Builtin{
+			Fn:        builtinReplace,
+			Arity:     Arity{Required: 3},
+			Signature: "replace(s, old, new)",
+			Doc:       "Returns string s with every occurrence of old replaced by new.",
+		},
+	},
+	{
+		"contains",
+		&Builtin{
+			Fn:        builtinContains,
+			Arity:     Arity{Required: 2},
+			Signature: "contains(collection, value)",
+			Doc:       "Reports whether a string contains a substring, or an array an element equal to value.",
+		},
+	},
+	{
+		"startsWith",
+		&Builtin{
+			Fn:        builtinStartsWith,
+			Arity:     Arity{Required: 2},
+			Signature: "startsWith(s, prefix)",
+			Doc:       "Reports whether string s begins with prefix.",
+		},
+	},
+	{
+		"endsWith",
+		&Builtin{
+			Fn:        builtinEndsWith,
+			Arity:     Arity{Required: 2},
+			Signature: "endsWith(s, suffix)",
+			Doc:       "Reports whether string s ends with suffix.",
+		},
+	},
+	{
+		"indexOf",
+		&Builtin{
+			Fn:        builtinIndexOf,
+			Arity:     Arity{Required: 2},
+			Signature: "indexOf(s, substring)",
+			Doc:       "Returns the index of the first occurrence of substring in string s, or -1 if there is none.",
+		},
+	},
+	{
+		"substr",
+		&Builtin{
+			Fn:        builtinSubstr,
+			Arity:     Arity{Required: 2, Optional: 1},
+			Signature: "substr(s, start, length?)",
+			Doc:       "Returns length characters of string s from start on, or the rest of s without a length.",
+		},
+	},
+	{
+		"repeat",
+		&Builtin{
+			Fn:        builtinRepeat,
+			Arity:     Arity{Required: 2},
+			Signature: "repeat(s, count)",
+			Doc:       "Returns string s repeated count times.",
+		},
+	},
+	{
+		"format",
+		&Builtin{
+			Fn:        builtinFormat,
+			Arity:     Arity{Required: 1, Variadic: true},
+			Signature: "format(template, values...)",
+			Doc:       "Returns template with %s, %v, %q and %d replaced by the values in turn, and %% by a percent sign.",
+		},
+	},
+	{
+		"chars",
+		&Builtin{
+			Fn:        builtinChars,
+			Arity:     Arity{Required: 1},
+			Signature: "chars(s)",
+			Doc:       "Returns an array of the characters of string s.",
+		},
+	},
+	{
+		"str",
+		&Builtin{
+			Fn:        builtinStr,
+			Arity:     Arity{Required: 1},
+			Signature: "str(value)",
+			Doc:       "Converts a value to a string, the way it is printed.",
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn:        builtinInt,
+			Arity:     Arity{Required: 1},
+			Signature: "int(value)",
+			Doc:       "Converts a string of decimal digits, an integer or a boolean to an integer.",
+		},
+	},
+	{
+		"map",
+		&Builtin{
+			Fn:        builtinMap,
+			Arity:     Arity{Required: 2},
+			Signature: "map(array, f)",
+			Doc:       "Returns an array of the results of calling f with each element.",
+		},
+	},
+	{
+		"filter",
+		&Builtin{
+			Fn:        builtinFilter,
+			Arity:     Arity{Required: 2},
+			Signature: "filter(array, f)",
+			Doc:       "Returns an array of the elements for which f returns a truthy value.",
+		},
+	},
+	{
+		"reduce",
+		&Builtin{
+			Fn:        builtinReduce,
+			Arity:     Arity{Required: 2, Optional: 1},
+			Signature: "reduce(array, f, initial?)",
+			Doc:       "Calls f with the value so far and each element in turn, starting from initial or the first element, and returns the last result.",
+		},
+	},
+	{
+		"sort",
+		&Builtin{
+			Fn:        builtinSort,
+			Arity:     Arity{Required: 1, Optional: 1},
+			Signature: "sort(array, less?)",
+			Doc:       "Returns the elements sorted, in ascending order for integers or strings, or by less, which returns whether its first argument comes before its second or an integer that is negative when it does.",
+		},
+	},
+	{
+		"reverse",
+		&Builtin{
+			Fn:        builtinReverse,
+			Arity:     Arity{Required: 1},
+			Signature: "reverse(array)",
+			Doc:       "Returns the elements of an array in reverse order.",
+		},
+	},
+	{
+		"slice",
+		&Builtin{
+			Fn:        builtinSlice,
+			Arity:     Arity{Required: 2, Optional: 1},
+			Signature: "slice(value, start, end?)",
+			Doc:       "Returns the part of an array or a string from start up to but not including end, or to its end.",
+		},
+	},
+	{
+		"concat",
+		&Builtin{
+			Fn:        builtinConcat,
+			Arity:     Arity{Variadic: true},
+			Signature: "concat(arrays...)",
+			Doc:       "Returns an array of the elements of all the arrays.",
+		},
+	},
+	{
+		"range",
+		&Builtin{
+			Fn:        builtinRange,
+			Arity:     Arity{Required: 1, Optional: 2},
+			Signature: "range(start?, end, step?)",
+			Doc:       "Returns an array of the integers from start, or 0, up to but not including end, counting by step.",
+		},
+	},
+	{
+		"zip",
+		&Builtin{
+			Fn:        builtinZip,
+			Arity:     Arity{Required: 2},
+			Signature: "zip(a, b)",
+			Doc:       "Returns an array of pairs of the elements of arrays a and b, as long as the shorter one.",
+		},
+	},
+	{
+		"keys",
+		&Builtin{
+			Fn:        builtinKeys,
+			Arity:     Arity{Required: 1},
+			Signature: "keys(hash)",
+			Doc:       "Returns the keys of a hash, booleans first, then integers, then strings, each in order.",
+		},
+	},
+	{
+		"values",
+		&Builtin{
+			Fn:        builtinValues,
+			Arity:     Arity{Required: 1},
+			Signature: "values(hash)",
+			Doc:       "Returns the values of a hash, in the order of its keys.",
+		},
+	},
+	{
+		"has",
+		&Builtin{
+			Fn:        builtinHas,
+			Arity:     Arity{Required: 2},
+			Signature: "has(hash, key)",
+			Doc:       "Reports whether a hash holds key.",
+		},
+	},
+	{
+		"delete",
+		&Builtin{
+			Fn:        builtinDelete,
+			Arity:     Arity{Required: 2},
+			Signature: "delete(hash, key)",
+			Doc:       "Returns a new hash without key.",
+		},
+	},
+	{
+		"merge",
+		&Builtin{
+			Fn:        builtinMerge,
+			Arity:     Arity{Variadic: true},
+			Signature: "merge(hashes...)",
+			Doc:       "Returns a new hash with the pairs of all the hashes, later ones taking precedence.",
 		},
 	},
 }
 
+// builtinNames maps the builtins back to their names. It is filled in by
+// init, as the builtins cannot refer to Builtins themselves.
+var builtinNames = map[*Builtin]string{}
+
+func init() {
+	for _, b := range Builtins {
+		builtinNames[b.Builtin] = b.Name
+	}
+}
+
 func GetBuiltinByName(name string) *Builtin {
 	for _, b := range Builtins {
 		if b.Name == name {
@@ -118,6 +538,88 @@ func GetBuiltinByName(name string) *Builtin {
 	return nil
 }
 
+// BuiltinName returns the name of builtin, or "" if it is not one of
+// Builtins.
+func BuiltinName(builtin *Builtin) string {
+	return builtinNames[builtin]
+}
+
+// functionName returns the name of a function, or null for an anonymous
+// one.
+func functionName(name string) Object {
+	if name == "" {
+		return nil
+	}
+	return &String{Value: name}
+}
+
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
+
+func newFailure(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Fatal: true}
+}
+
+// message is the text of an assertion message: strings as they are,
+// anything else inspected.
+func message(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return s.Value
+	}
+	return inspect(obj)
+}
+
+func inspect(obj Object) string {
+	if obj == nil {
+		return "null"
+	}
+	return obj.Inspect()
+}
+
+// Equal reports whether a and b are the same value, comparing arrays and
+// hashes element by element.
+func Equal(a, b Object) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *Array:
+		other := b.(*Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i, el := range a.Elements {
+			if !Equal(el, other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		other := b.(*Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			otherPair, ok := other.Pairs[key]
+			if !ok || !Equal(pair.Value, otherPair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
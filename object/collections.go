@@ -0,0 +1,485 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+// The array and hash builtins return new arrays and hashes rather than
+// changing the ones they are passed, like push.
+
+func builtinMap(ctx Context, args ...Object) Object {
+	if err := checkArgs("map", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+		return err
+	}
+	elements := args[0].(*Array).Elements
+	mapped := make([]Object, len(elements))
+	for i, el := range elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		mapped[i] = result
+	}
+	return &Array{Elements: mapped}
+}
+
+func builtinFilter(ctx Context, args ...Object) Object {
+	if err := checkArgs("filter", args, ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+		return err
+	}
+	filtered := []Object{}
+	for _, el := range args[0].(*Array).Elements {
+		result := ctx.Call(args[1], el)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			filtered = append(filtered, el)
+		}
+	}
+	return &Array{Elements: filtered}
+}
+
+// builtinReduce folds an array into a value by calling a function with
+// the value so far and each element. Without an initial value it starts
+// from the first element.
+func builtinReduce(ctx Context, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments, got %d wanted 2 or 3", len(args))
+	}
+	if err := checkArgs("reduce", args[:2], ARRAY_OBJ, FUNCTION_OBJ); err != nil {
+		return err
+	}
+
+	elements := args[0].(*Array).Elements
+	var acc Object
+	if len(args) == 3 {
+		acc = args[2]
+	} else if len(elements) > 0 {
+		acc, elements = elements[0], elements[1:]
+	} else {
+		return newError("reduce of an empty array without an initial value")
+	}
+
+	for _, el := range elements {
+		acc = ctx.Call(args[1], acc, el)
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// builtinSort sorts integers or strings in ascending order, or any values
+// by a comparator called with two of them. The comparator returns whether
+// the first comes before the second, or an integer that is negative when
+// it does. The sort is stable.
+func builtinSort(ctx Context, args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments, got %d wanted 1 or 2", len(args))
+	}
+	types := []ObjectType{ARRAY_OBJ, FUNCTION_OBJ}
+	if err := checkArgs("sort", args, types[:len(args)]...); err != nil {
+		return err
+	}
+
+	sorted := append([]Object{}, args[0].(*Array).Elements...)
+	var failure Object
+	less := func(a, b Object) bool {
+		switch {
+		case a.Type() == INTEGER_OBJ && b.Type() == INTEGER_OBJ:
+			return a.(*Integer).Value < b.(*Integer).Value
+		case a.Type() == STRING_OBJ && b.Type() == STRING_OBJ:
+			return a.(*String).Value < b.(*String).Value
+		}
+		failure = newError("cannot compare %s and %s in `sort` without a comparator", a.Type(), b.Type())
+		return false
+	}
+	if len(args) == 2 {
+		less = func(a, b Object) bool {
+			switch result := ctx.Call(args[1], a, b).(type) {
+			case *Boolean:
+				return result.Value
+			case *Integer:
+				return result.Value < 0
+			case *Error:
+				failure = result
+			case nil:
+				failure = newError("comparator of `sort` must return BOOLEAN or INTEGER, got %s", NULL_OBJ)
+			default:
+				failure = newError("comparator of `sort` must return BOOLEAN or INTEGER, got %s", result.Type())
+			}
+			return false
+		}
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return failure == nil && less(sorted[i], sorted[j])
+	})
+	if failure != nil {
+		return failure
+	}
+	return &Array{Elements: sorted}
+}
+
+func builtinReverse(ctx Context, args ...Object) Object {
+	if err := checkArgs("reverse", args, ARRAY_OBJ); err != nil {
+		return err
+	}
+	elements := args[0].(*Array).Elements
+	reversed := make([]Object, len(elements))
+	for i, el := range elements {
+		reversed[len(elements)-1-i] = el
+	}
+	return &Array{Elements: reversed}
+}
+
+// builtinSlice returns the part of an array or a string from start up to
+// but not including end, or to the end without one, like a[start:end].
+// Negative bounds count from the end.
+func builtinSlice(ctx Context, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments, got %d wanted 2 or 3", len(args))
+	}
+	for _, bound := range args[1:] {
+		if bound.Type() != INTEGER_OBJ {
+			return newError("argument to `slice` must be INTEGER, got %s", bound.Type())
+		}
+	}
+	switch args[0].(type) {
+	case *Array, *String:
+	default:
+		return newError("argument to `slice` not supported, got %s", args[0].Type())
+	}
+
+	var end Object
+	if len(args) == 3 {
+		end = args[2]
+	}
+	return Slice(args[0], args[1], end, nil)
+}
+
+func builtinConcat(ctx Context, args ...Object) Object {
+	elements := []Object{}
+	for _, arg := range args {
+		array, ok := arg.(*Array)
+		if !ok {
+			return newError("argument to `concat` must be ARRAY, got %s", arg.Type())
+		}
+		elements = append(elements, array.Elements...)
+	}
+	return &Array{Elements: elements}
+}
+
+// builtinContains reports whether a string contains a substring, or an
+// array an element equal to a value.
+func builtinContains(ctx Context, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments, got %d wanted 2", len(args))
+	}
+	if array, ok := args[0].(*Array); ok {
+		for _, el := range array.Elements {
+			if Equal(el, args[1]) {
+				return True
+			}
+		}
+		return False
+	}
+	if err := checkArgs("contains", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	return NativeBool(strings.Contains(args[0].(*String).Value, args[1].(*String).Value))
+}
+
+// builtinRange returns the integers from start up to but not including
+// end, counting by step. range(n) counts from 0 to n.
+func builtinRange(ctx Context, args ...Object) Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError("wrong number of arguments, got %d wanted 1 to 3", len(args))
+	}
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		integer, ok := arg.(*Integer)
+		if !ok {
+			return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[i] = integer.Value
+	}
+	if len(args) == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+
+	start, end, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		return newError("step of `range` must not be 0")
+	}
+	count := stepCount(start, end, step)
+	if count > maxArrayLength {
+		return newError("result of `range` too long: %d elements", count)
+	}
+	elements := make([]Object, count)
+	for i := range elements {
+		elements[i] = &Integer{Value: start}
+		start += step
+	}
+	return &Array{Elements: elements}
+}
+
+// maxArrayLength bounds the length of the arrays builtins build, like
+// maxStringLength does for strings.
+const maxArrayLength = 1 << 25
+
+// stepCount returns how many of start, start+step, start+2*step and so on
+// come before end in the direction of step. It works in uint64, where the
+// distance between any two int64s fits, so that it cannot overflow.
+func stepCount(start, end, step int64) uint64 {
+	switch {
+	case step > 0 && start < end:
+		return (uint64(end)-uint64(start)-1)/uint64(step) + 1
+	case step < 0 && start > end:
+		return (uint64(start)-uint64(end)-1)/-uint64(step) + 1
+	}
+	return 0
+}
+
+// builtinZip pairs up the elements of two arrays, as long as the shorter
+// one lasts.
+func builtinZip(ctx Context, args ...Object) Object {
+	if err := checkArgs("zip", args, ARRAY_OBJ, ARRAY_OBJ); err != nil {
+		return err
+	}
+	a, b := args[0].(*Array).Elements, args[1].(*Array).Elements
+	if len(b) < len(a) {
+		a = a[:len(b)]
+	}
+	pairs := make([]Object, len(a))
+	for i := range a {
+		pairs[i] = &Array{Elements: []Object{a[i], b[i]}}
+	}
+	return &Array{Elements: pairs}
+}
+
+// builtinKeys returns the keys of a hash in order: booleans, then
+// integers, then strings, each by their value.
+func builtinKeys(ctx Context, args ...Object) Object {
+	if err := checkArgs("keys", args, HASH_OBJ); err != nil {
+		return err
+	}
+	pairs := sortedPairs(args[0].(*Hash))
+	keys := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+	return &Array{Elements: keys}
+}
+
+// builtinValues returns the values of a hash in the order of their keys,
+// as returned by keys.
+func builtinValues(ctx Context, args ...Object) Object {
+	if err := checkArgs("values", args, HASH_OBJ); err != nil {
+		return err
+	}
+	pairs := sortedPairs(args[0].(*Hash))
+	values := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		values[i] = pair.Value
+	}
+	return &Array{Elements: values}
+}
+
+func builtinHas(ctx Context, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments, got %d wanted 2", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `has` must be HASH, got %s", args[0].Type())
+	}
+	key, ok := args[1].(HashTable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	_, ok = hash.Pairs[key.Hashkey()]
+	return NativeBool(ok)
+}
+
+func builtinDelete(ctx Context, args ...Object) Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments, got %d wanted 2", len(args))
+	}
+	hash, ok := args[0].(*Hash)
+	if !ok {
+		return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+	}
+	key, ok := args[1].(HashTable)
+	if !ok {
+		return newError("unusable as hash key: %s", args[1].Type())
+	}
+	pairs := make(map[Hashkey]HashPair, len(hash.Pairs))
+	for k, pair := range hash.Pairs {
+		pairs[k] = pair
+	}
+	delete(pairs, key.Hashkey())
+	return &Hash{Pairs: pairs}
+}
+
+// builtinMerge returns a hash with the pairs of all of its arguments. A
+// key in more than one of them takes its value from the last.
+func builtinMerge(ctx Context, args ...Object) Object {
+	pairs := map[Hashkey]HashPair{}
+	for _, arg := range args {
+		hash, ok := arg.(*Hash)
+		if !ok {
+			return newError("argument to `merge` must be HASH, got %s", arg.Type())
+		}
+		for k, pair := range hash.Pairs {
+			pairs[k] = pair
+		}
+	}
+	return &Hash{Pairs: pairs}
+}
+
+// Slice returns the part of a string or an array from start up to but not
+// including end, taking every step-th element, as left[start:end:step]
+// does. A bound that is nil or null is left out: step is then 1, and start
+// and end are the ends of left in the direction of step. Negative start
+// and end count from the end of left, and bounds past either end are
+// clamped, so slicing never fails for being out of range.
+func Slice(left, start, end, step Object) Object {
+	by, ok, err := sliceBound(step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		by = 1
+	}
+	if by == 0 {
+		return newError("slice step must not be 0")
+	}
+	from, hasFrom, err := sliceBound(start)
+	if err != nil {
+		return err
+	}
+	to, hasTo, err := sliceBound(end)
+	if err != nil {
+		return err
+	}
+
+	var length int64
+	var runes []rune
+	switch left := left.(type) {
+	case *String:
+		runes = []rune(left.Value)
+		length = int64(len(runes))
+	case *Array:
+		length = int64(len(left.Elements))
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+
+	// Going backwards, -1 stands for before the first element rather than
+	// for the last one.
+	lower, upper := int64(0), length
+	if by < 0 {
+		lower, upper = -1, length-1
+	}
+	clamp := func(i int64, given bool, fallback int64) int64 {
+		if !given {
+			return fallback
+		}
+		if i < 0 {
+			i += length
+			if i < lower {
+				return lower
+			}
+		} else if i > upper {
+			return upper
+		}
+		return i
+	}
+	if by > 0 {
+		from, to = clamp(from, hasFrom, lower), clamp(to, hasTo, upper)
+	} else {
+		from, to = clamp(from, hasFrom, upper), clamp(to, hasTo, lower)
+	}
+
+	// Counting the elements first keeps i from overflowing when by is
+	// huge: it only moves on while there is another element to take.
+	count := int(stepCount(from, to, by))
+	switch left := left.(type) {
+	case *String:
+		var out strings.Builder
+		for i, n := from, 0; n < count; i, n = i+by, n+1 {
+			out.WriteRune(runes[i])
+		}
+		return &String{Value: out.String()}
+	default:
+		elements := make([]Object, 0, count)
+		for i, n := from, 0; n < count; i, n = i+by, n+1 {
+			elements = append(elements, left.(*Array).Elements[i])
+		}
+		return &Array{Elements: elements}
+	}
+}
+
+// sliceBound returns the value of a bound of a slice and whether it was
+// given at all.
+func sliceBound(bound Object) (int64, bool, *Error) {
+	switch bound := bound.(type) {
+	case nil, *Null:
+		return 0, false, nil
+	case *Integer:
+		return bound.Value, true, nil
+	default:
+		return 0, false, newError("slice bounds must be INTEGER, got %s", bound.Type())
+	}
+}
+
+// sortedPairs returns the pairs of hash ordered by their keys, so that
+// keys and values list them the same way every time.
+func sortedPairs(hash *Hash) []HashPair {
+	pairs := make([]HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key.(HashTable).Hashkey(), pairs[j].Key.(HashTable).Hashkey()
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		switch key := pairs[i].Key.(type) {
+		case *Integer:
+			return key.Value < pairs[j].Key.(*Integer).Value
+		case *String:
+			return key.Value < pairs[j].Key.(*String).Value
+		case *Boolean:
+			return !key.Value && pairs[j].Key.(*Boolean).Value
+		}
+		return false
+	})
+	return pairs
+}
+
+func isFunction(obj Object) bool {
+	switch obj.(type) {
+	case *Closure, *Function, *Builtin:
+		return true
+	}
+	return false
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	}
+	return true
+}
+
+func isError(obj Object) bool {
+	_, ok := obj.(*Error)
+	return ok
+}
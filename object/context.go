@@ -0,0 +1,49 @@
+package object
+
+import (
+	"io"
+	"os"
+)
+
+// Context is what a builtin can reach of the engine running it.
+type Context interface {
+	// Call calls fn with args and returns its result, null if the
+	// function returns nothing. The VM runs the call on the stack of the
+	// builtin's caller, the evaluator in the function's environment. A
+	// failed call returns an *Error, which the builtin should return; the
+	// program stops with it either way.
+	Call(fn Object, args ...Object) Object
+	// Errorf reports an error that stops the program, whatever the
+	// builtin returns. Errors a builtin returns itself are values the
+	// program can inspect with assertError, in both engines.
+	Errorf(format string, a ...interface{}) *Error
+	// Host returns the services of the program running the engine. It may
+	// be nil.
+	Host() *Host
+}
+
+// Host holds the services a program embedding an engine provides to
+// builtins.
+type Host struct {
+	// Stdout receives the output of puts. It is os.Stdout if nil.
+	Stdout io.Writer
+	// Services holds anything else builtins may need from the host, by
+	// name.
+	Services map[string]interface{}
+}
+
+// Output returns the writer for the output of the program.
+func (h *Host) Output() io.Writer {
+	if h == nil || h.Stdout == nil {
+		return os.Stdout
+	}
+	return h.Stdout
+}
+
+// Service returns the service registered under name, or nil.
+func (h *Host) Service(name string) interface{} {
+	if h == nil {
+		return nil
+	}
+	return h.Services[name]
+}
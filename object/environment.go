@@ -1,8 +1,20 @@
 package object
 
+import "interpreter/ast"
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	outer  *Environment
+	host   *Host
+	tracer Tracer
+}
+
+// Tracer observes the evaluation of the code run in an environment. Enter
+// is called before a node is evaluated and Exit with its result
+// afterwards, so the calls nest like the tree.
+type Tracer interface {
+	Enter(node ast.Node, env *Environment)
+	Exit(node ast.Node, result Object)
 }
 
 func NewEnvironment() *Environment {
@@ -13,6 +25,7 @@ func NewEnvironment() *Environment {
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.tracer = outer.tracer
 	return env
 }
 
@@ -24,6 +37,36 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// SetHost gives the builtins called in the environment, and in those
+// enclosed by it, the services of host.
+func (e *Environment) SetHost(host *Host) {
+	e.host = host
+}
+
+// Host returns the host of the innermost environment that has one, or
+// nil.
+func (e *Environment) Host() *Host {
+	for env := e; env != nil; env = env.outer {
+		if env.host != nil {
+			return env.host
+		}
+	}
+	return nil
+}
+
+// SetTracer makes t observe the evaluations run in the environment and in
+// those enclosed by it from then on; a nil t turns tracing off. Each
+// environment keeps the tracer it was created with, so evaluations in
+// separate environments can be traced separately and at the same time.
+func (e *Environment) SetTracer(t Tracer) {
+	e.tracer = t
+}
+
+// Tracer returns the tracer of the environment, or nil.
+func (e *Environment) Tracer() Tracer {
+	return e.tracer
+}
+
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
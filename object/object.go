@@ -6,6 +6,7 @@ import (
 	"hash/fnv"
 	"interpreter/ast"
 	"interpreter/code"
+	"interpreter/token"
 	"strings"
 )
 
@@ -22,13 +23,16 @@ const (
 	HASH_OBJ              = "HASH"
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 	CLOSURE_OBJ           = "CLOSURE"
+	QUOTE_OBJ             = "QUOTE"
+	MACRO_OBJ             = "MACRO"
 )
 
 type HashTable interface {
 	Hashkey() Hashkey
 }
 
-type BuiltinFunction func(args ...Object) Object
+// BuiltinFunction implements a builtin. ctx is the engine calling it.
+type BuiltinFunction func(ctx Context, args ...Object) Object
 
 type ObjectType string
 
@@ -45,6 +49,21 @@ type Boolean struct {
 	Value bool
 }
 
+// True and False are the only booleans the engines produce, as they compare
+// booleans by identity. Builtins return them through NativeBool.
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+)
+
+// NativeBool returns True or False for b.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return True
+	}
+	return False
+}
+
 type Null struct {
 }
 
@@ -54,12 +73,49 @@ type ReturnValue struct {
 
 type Error struct {
 	Message string
+	// Fatal errors stop the program in both engines, as failed
+	// assertions and the evaluator's own errors do. Other errors
+	// builtins return are values, like in [int("x"), 1].
+	Fatal bool
+	// Trace lists the functions that were running when the error stopped
+	// the evaluator, innermost first.
+	Trace []Frame
+}
+
+// Frame is a function that was running when an error stopped a program,
+// and the line it had reached, or 0 if that is not known.
+type Frame struct {
+	Function string
+	Line     int
+}
+
+func (f Frame) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s (line %d)", f.Function, f.Line)
+	}
+	return f.Function
+}
+
+// FormatTrace returns trace one frame per line, as in "    at fib (line
+// 3)".
+func FormatTrace(trace []Frame) string {
+	var out bytes.Buffer
+	for _, f := range trace {
+		out.WriteString("    at " + f.String() + "\n")
+	}
+	return out.String()
 }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Patterns   []ast.Expression
+	Variadic   bool
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string
+	// Pos is the position of the fn keyword.
+	Pos token.Position
 }
 
 type String struct {
@@ -68,6 +124,13 @@ type String struct {
 
 type Builtin struct {
 	Fn BuiltinFunction
+	// Arity is the number of arguments Fn accepts, for tools that check
+	// calls before they run.
+	Arity Arity
+	// Signature shows how to call the builtin, as in "slice(value, start,
+	// end?)", and Doc says what it does, for editors.
+	Signature string
+	Doc       string
 }
 
 type Array struct {
@@ -92,6 +155,28 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	// NumDefaults counts the parameters with a default value, which come
+	// after the required ones. If Variadic is set, the last parameter
+	// collects the remaining arguments.
+	NumDefaults int
+	Variadic    bool
+	Name        string
+
+	// Debug information. Pos is the position of the fn keyword.
+	Pos        token.Position
+	Lines      code.LineTable
+	LocalNames []string
+	FreeNames  []string
+}
+
+// HiddenPrefix starts the names of the slots the compiler keeps values in
+// for itself, such as an array being destructured. No identifier starts
+// with it, so no code can refer to them, and debuggers leave them out.
+const HiddenPrefix = "#"
+
+// IsHidden reports whether name is the name of such a slot.
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, HiddenPrefix)
 }
 
 type Closure struct {
@@ -99,12 +184,52 @@ type Closure struct {
 	Free []Object
 }
 
+type Quote struct {
+	Node ast.Node
+}
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+func (q *Quote) Type() ObjectType {
+	return QUOTE_OBJ
+}
+
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
 func (c *Closure) Type() ObjectType {
 	return CLOSURE_OBJ
 }
 
 func (c *Closure) Inspect() string {
-	return fmt.Sprintf("Closure[%p]", c)
+	return c.Fn.Signature()
 }
 
 func (cf *CompiledFunction) Type() ObjectType {
@@ -112,7 +237,7 @@ func (cf *CompiledFunction) Type() ObjectType {
 }
 
 func (cf *CompiledFunction) Inspect() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	return cf.Signature()
 }
 
 func (h *Hash) Type() ObjectType {
@@ -200,15 +325,8 @@ func (f *Function) Type() ObjectType {
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
-
-	out.WriteString("fn")
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") {\n")
+	out.WriteString(f.Signature())
+	out.WriteString(" {\n")
 	out.WriteString(f.Body.String())
 	out.WriteString("\n}")
 
@@ -254,3 +372,12 @@ func (i *Integer) Inspect() string {
 func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
+
+// ToString converts obj to the text it stands for in a template literal:
+// a string is its own text, and any other value is its Inspect form.
+func ToString(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return s.Value
+	}
+	return obj.Inspect()
+}
@@ -1,6 +1,11 @@
 package object
 
-import "testing"
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
 
 func TestStringHashkey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +25,104 @@ func TestStringHashkey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestArity(t *testing.T) {
+	tests := []struct {
+		arity    Arity
+		accepts  []int
+		rejects  []int
+		expected string
+	}{
+		{Arity{Required: 1}, []int{1}, []int{0, 2}, "1"},
+		{Arity{Required: 1, Optional: 2}, []int{1, 2, 3}, []int{0, 4}, "1 to 3"},
+		{Arity{Required: 1, Optional: 1, Variadic: true}, []int{1, 2, 10}, []int{0}, "1 or more"},
+	}
+
+	for _, tt := range tests {
+		for _, n := range tt.accepts {
+			if !tt.arity.Accepts(n) {
+				t.Errorf("%+v does not accept %d", tt.arity, n)
+			}
+		}
+		for _, n := range tt.rejects {
+			if tt.arity.Accepts(n) {
+				t.Errorf("%+v accepts %d", tt.arity, n)
+			}
+		}
+		if tt.arity.String() != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, tt.arity.String())
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	var none *Host
+	if none.Output() != os.Stdout || none.Service("x") != nil {
+		t.Errorf("a nil host should write to os.Stdout and have no services")
+	}
+
+	var out bytes.Buffer
+	host := &Host{Stdout: &out, Services: map[string]interface{}{"x": 1}}
+	if host.Output() != &out || host.Service("x") != 1 || host.Service("y") != nil {
+		t.Errorf("wrong services for %+v", host)
+	}
+}
+
+// TestBuiltinArity checks the arity of each builtin against the number of
+// arguments it rejects, so that tools reading it do not drift from the
+// builtins.
+func TestBuiltinArity(t *testing.T) {
+	for _, b := range Builtins {
+		arity := b.Builtin.Arity
+		counts := []int{}
+		if arity.Required > 0 {
+			counts = append(counts, arity.Required-1)
+		}
+		if !arity.Variadic {
+			counts = append(counts, arity.Required+arity.Optional+1)
+		}
+
+		for _, n := range counts {
+			args := make([]Object, n)
+			for i := range args {
+				args[i] = &Null{}
+			}
+			result, ok := b.Builtin.Fn(nil, args...).(*Error)
+			if !ok || !strings.Contains(result.Message, "wrong number of arguments") {
+				t.Errorf("%s accepts %d arguments, but its arity is %s", b.Name, n, arity)
+			}
+		}
+	}
+}
+
+// TestBuiltinSignature checks that each builtin documents itself, with a
+// signature that names it and lists the parameters its arity accepts:
+// optional ones end in ? and a rest parameter in ....
+func TestBuiltinSignature(t *testing.T) {
+	for _, b := range Builtins {
+		signature := b.Builtin.Signature
+		if !strings.HasPrefix(signature, b.Name+"(") || !strings.HasSuffix(signature, ")") {
+			t.Errorf("wrong signature for %s, got %q", b.Name, signature)
+			continue
+		}
+		if b.Builtin.Doc == "" {
+			t.Errorf("no doc for %s", b.Name)
+		}
+
+		var arity Arity
+		params := strings.TrimSuffix(strings.TrimPrefix(signature, b.Name+"("), ")")
+		for _, param := range strings.Split(params, ", ") {
+			switch {
+			case strings.HasSuffix(param, "..."):
+				arity.Variadic = true
+			case strings.HasSuffix(param, "?"):
+				arity.Optional++
+			default:
+				arity.Required++
+			}
+		}
+		if arity != b.Builtin.Arity {
+			t.Errorf("signature %q has arity %s, want=%s", signature, arity, b.Builtin.Arity)
+		}
+	}
+}
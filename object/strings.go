@@ -0,0 +1,261 @@
+package object
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The string builtins count in UTF-8 characters, like len, indexing and
+// slicing, so their results can be used with each other.
+
+// maxStringLength bounds the length in bytes of the strings builtins
+// build, so that asking for a huge one is an error rather than running
+// out of memory.
+const maxStringLength = 1 << 30
+
+func builtinSplit(ctx Context, args ...Object) Object {
+	if err := checkArgs("split", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	parts := strings.Split(args[0].(*String).Value, args[1].(*String).Value)
+	elements := make([]Object, len(parts))
+	for i, part := range parts {
+		elements[i] = &String{Value: part}
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinJoin(ctx Context, args ...Object) Object {
+	if err := checkArgs("join", args, ARRAY_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	elements := args[0].(*Array).Elements
+	parts := make([]string, len(elements))
+	for i, el := range elements {
+		parts[i] = ToString(el)
+	}
+	return &String{Value: strings.Join(parts, args[1].(*String).Value)}
+}
+
+func builtinTrim(ctx Context, args ...Object) Object {
+	if err := checkArgs("trim", args, STRING_OBJ); err != nil {
+		return err
+	}
+	return &String{Value: strings.TrimSpace(args[0].(*String).Value)}
+}
+
+func builtinUpper(ctx Context, args ...Object) Object {
+	if err := checkArgs("upper", args, STRING_OBJ); err != nil {
+		return err
+	}
+	return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+}
+
+func builtinLower(ctx Context, args ...Object) Object {
+	if err := checkArgs("lower", args, STRING_OBJ); err != nil {
+		return err
+	}
+	return &String{Value: strings.ToLower(args[0].(*String).Value)}
+}
+
+func builtinReplace(ctx Context, args ...Object) Object {
+	if err := checkArgs("replace", args, STRING_OBJ, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	s, old, new := args[0].(*String).Value, args[1].(*String).Value, args[2].(*String).Value
+	return &String{Value: strings.ReplaceAll(s, old, new)}
+}
+
+func builtinStartsWith(ctx Context, args ...Object) Object {
+	if err := checkArgs("startsWith", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	return NativeBool(strings.HasPrefix(args[0].(*String).Value, args[1].(*String).Value))
+}
+
+func builtinEndsWith(ctx Context, args ...Object) Object {
+	if err := checkArgs("endsWith", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	return NativeBool(strings.HasSuffix(args[0].(*String).Value, args[1].(*String).Value))
+}
+
+func builtinIndexOf(ctx Context, args ...Object) Object {
+	if err := checkArgs("indexOf", args, STRING_OBJ, STRING_OBJ); err != nil {
+		return err
+	}
+	s := args[0].(*String).Value
+	i := strings.Index(s, args[1].(*String).Value)
+	if i > 0 {
+		i = utf8.RuneCountInString(s[:i])
+	}
+	return &Integer{Value: int64(i)}
+}
+
+// builtinSubstr returns length characters of a string from start on, or
+// all of them without a length. The part past the end of the string is
+// left out.
+func builtinSubstr(ctx Context, args ...Object) Object {
+	if len(args) != 2 && len(args) != 3 {
+		return newError("wrong number of arguments, got %d wanted 2 or 3", len(args))
+	}
+	types := []ObjectType{STRING_OBJ, INTEGER_OBJ, INTEGER_OBJ}
+	if err := checkArgs("substr", args, types[:len(args)]...); err != nil {
+		return err
+	}
+
+	s := []rune(args[0].(*String).Value)
+	start := args[1].(*Integer).Value
+	length := int64(len(s))
+	if len(args) == 3 {
+		length = args[2].(*Integer).Value
+	}
+	if start < 0 || length < 0 {
+		return newError("negative argument to `substr`")
+	}
+
+	if start > int64(len(s)) {
+		start = int64(len(s))
+	}
+	// Comparing with what is left rather than adding length to start
+	// keeps huge lengths from overflowing.
+	if length > int64(len(s))-start {
+		length = int64(len(s)) - start
+	}
+	return &String{Value: string(s[start : start+length])}
+}
+
+func builtinRepeat(ctx Context, args ...Object) Object {
+	if err := checkArgs("repeat", args, STRING_OBJ, INTEGER_OBJ); err != nil {
+		return err
+	}
+	s := args[0].(*String).Value
+	count := args[1].(*Integer).Value
+	if count < 0 {
+		return newError("negative count to `repeat`: %d", count)
+	}
+	if len(s) > 0 && count > maxStringLength/int64(len(s)) {
+		return newError("result of `repeat` too long: %d times %d bytes", count, len(s))
+	}
+	return &String{Value: strings.Repeat(s, int(count))}
+}
+
+// builtinFormat replaces the verbs in its first argument with the
+// arguments after it: %s and %v with a value as by ToString, %q with it
+// quoted, and %d with an integer. %% is a percent sign.
+func builtinFormat(ctx Context, args ...Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments, got 0 wanted 1 or more")
+	}
+	template, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `format` must be STRING, got %s", args[0].Type())
+	}
+
+	values := args[1:]
+	used := 0
+	var out strings.Builder
+	for i := 0; i < len(template.Value); i++ {
+		if template.Value[i] != '%' {
+			out.WriteByte(template.Value[i])
+			continue
+		}
+		i++
+		if i == len(template.Value) {
+			return newError("format ends with %%: %q", template.Value)
+		}
+		verb := template.Value[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if used == len(values) {
+			return newError("missing argument for %%%c in `format`", verb)
+		}
+		value := values[used]
+		used++
+
+		switch verb {
+		case 's', 'v':
+			out.WriteString(ToString(value))
+		case 'q':
+			out.WriteString(strconv.Quote(ToString(value)))
+		case 'd':
+			integer, ok := value.(*Integer)
+			if !ok {
+				return newError("%%d in `format` must be INTEGER, got %s", value.Type())
+			}
+			out.WriteString(strconv.FormatInt(integer.Value, 10))
+		default:
+			return newError("unknown verb %%%c in `format`", verb)
+		}
+	}
+	if used < len(values) {
+		return newError("too many arguments to `format`: want=%d, got=%d", used, len(values))
+	}
+	return &String{Value: out.String()}
+}
+
+func builtinChars(ctx Context, args ...Object) Object {
+	if err := checkArgs("chars", args, STRING_OBJ); err != nil {
+		return err
+	}
+	elements := []Object{}
+	for _, r := range args[0].(*String).Value {
+		elements = append(elements, &String{Value: string(r)})
+	}
+	return &Array{Elements: elements}
+}
+
+func builtinStr(ctx Context, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments, got %d wanted 1", len(args))
+	}
+	if s, ok := args[0].(*String); ok {
+		return s
+	}
+	return &String{Value: ToString(args[0])}
+}
+
+// builtinInt converts a string of decimal digits, an integer or a boolean
+// to an integer.
+func builtinInt(ctx Context, args ...Object) Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments, got %d wanted 1", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}
+		}
+		return &Integer{Value: 0}
+	case *String:
+		value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+		if err != nil {
+			return newError("could not convert %q to INTEGER", arg.Value)
+		}
+		return &Integer{Value: value}
+	default:
+		return newError("argument to `int` not supported, got %s", args[0].Type())
+	}
+}
+
+// checkArgs returns an error unless args holds exactly one argument of each
+// of types, in order. FUNCTION_OBJ stands for any kind of function.
+func checkArgs(name string, args []Object, types ...ObjectType) *Error {
+	if len(args) != len(types) {
+		return newError("wrong number of arguments, got %d wanted %d", len(args), len(types))
+	}
+	for i, t := range types {
+		if t == FUNCTION_OBJ && isFunction(args[i]) {
+			continue
+		}
+		if args[i].Type() != t {
+			return newError("argument to `%s` must be %s, got %s", name, t, args[i].Type())
+		}
+	}
+	return nil
+}
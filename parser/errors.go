@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"fmt"
+	"interpreter/token"
+	"strings"
+)
+
+// DefaultMaxErrors is the number of errors a parser collects before it
+// stops parsing.
+const DefaultMaxErrors = 10
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ParseError describes a single problem found while parsing. Expected is
+// empty when the parser had no particular token in mind, e.g. when it found
+// a token that cannot start an expression.
+type ParseError struct {
+	Pos      token.Position
+	Expected []token.TokenType
+	Found    token.Token
+	Severity Severity
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// ExpectedString lists the expected token types, e.g. ") or ,".
+func (e *ParseError) ExpectedString() string {
+	expected := []string{}
+	for _, t := range e.Expected {
+		expected = append(expected, string(t))
+	}
+	return strings.Join(expected, " or ")
+}
+
+var statementKeywords = map[token.TokenType]bool{
+	token.LET:    true,
+	token.RETURN: true,
+	token.IF:     true,
+}
+
+// addError records a diagnostic unless the parser is already recovering
+// from an earlier error in the same statement, or the error cap has been
+// reached. Either way the parser enters panic mode until the next
+// synchronize.
+func (p *Parser) addError(err *ParseError) {
+	if p.panicking || p.full() {
+		p.panicking = true
+		return
+	}
+	p.errors = append(p.errors, err)
+	p.panicking = true
+}
+
+func (p *Parser) full() bool {
+	return p.maxErrors > 0 && len(p.errors) >= p.maxErrors
+}
+
+// synchronize skips the remainder of a broken statement. It stops on a
+// semicolon, before a closing brace or a token that starts a new statement,
+// or after a brace-delimited block that was opened inside the statement.
+// Nested blocks are skipped as a whole. It reports true when it stopped on
+// a closing brace that belongs to an enclosing block, in which case the
+// current token must not be skipped.
+func (p *Parser) synchronize() bool {
+	p.panicking = false
+
+	depth := 0
+	for !p.currentTokenIs(token.EOF) {
+		switch p.currentToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return true
+			}
+			depth--
+			if depth == 0 && !p.peekTokenIs(token.ELSE) {
+				if p.peekTokenIs(token.SEMICOLON) {
+					p.nextToken()
+				}
+				return false
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		}
+
+		if depth == 0 && (p.peekTokenIs(token.RBRACE) ||
+			p.peekTokenIs(token.EOF) || statementKeywords[p.peekToken.Type]) {
+			return false
+		}
+		p.nextToken()
+	}
+	return false
+}
@@ -40,7 +40,14 @@ type (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []*ParseError
+
+	maxErrors int
+	panicking bool
+
+	// matching is set while parsing the pattern of a match arm, which may
+	// contain literals.
+	matching bool
 
 	currentToken token.Token
 	peekToken    token.Token
@@ -51,8 +58,9 @@ type Parser struct {
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:         l,
+		errors:    []*ParseError{},
+		maxErrors: DefaultMaxErrors,
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
@@ -66,8 +74,11 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_HEAD, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -91,10 +102,16 @@ func (p *Parser) nextToken() {
 	p.peekToken = p.l.NextToken()
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
+// SetMaxErrors changes how many errors are collected before the parser
+// gives up. Zero or less means no limit.
+func (p *Parser) SetMaxErrors(n int) {
+	p.maxErrors = n
+}
+
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -106,16 +123,24 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s got %s",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(&ParseError{
+		Pos:      p.peekToken.Pos,
+		Expected: []token.TokenType{t},
+		Found:    p.peekToken,
+		Severity: SeverityError,
+		Message:  msg,
+	})
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	for !p.currentTokenIs(token.EOF) {
+	for !p.currentTokenIs(token.EOF) && !p.full() {
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicking {
+			p.synchronize()
+		} else if statement != nil {
 			program.Statements = append(program.Statements, statement)
 		}
 		p.nextToken()
@@ -137,13 +162,20 @@ func (p *Parser) parseStatement() ast.Statement {
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	statement := &ast.LetStatement{Token: p.currentToken}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		statement.Pattern = p.parsePattern()
+		if statement.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		statement.Name = &ast.Identifier{Token: p.currentToken,
+			Value: p.currentToken.Literal}
 	}
 
-	statement.Name = &ast.Identifier{Token: p.currentToken,
-		Value: p.currentToken.Literal}
-
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -152,11 +184,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	statement.Value = p.parseExpression(LOWEST)
 
-	if fl, ok := statement.Value.(*ast.FunctionLiteral); ok {
+	if fl, ok := statement.Value.(*ast.FunctionLiteral); ok && statement.Name != nil {
 		fl.Name = statement.Name.Value
 	}
 
-	for p.peekTokenIs(token.SEMICOLON) {
+	for p.peekTokenIs(token.SEMICOLON) && !p.panicking {
 		p.nextToken()
 	}
 
@@ -169,7 +201,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	p.nextToken()
 	statement.ReturnValue = p.parseExpression(LOWEST)
 
-	for p.peekTokenIs(token.SEMICOLON) {
+	for p.peekTokenIs(token.SEMICOLON) && !p.panicking {
 		p.nextToken()
 	}
 
@@ -198,7 +230,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 	statement.Expression = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
 		p.nextToken()
 	}
 
@@ -214,7 +246,8 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	leftExpression := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() &&
+		!p.panicking {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExpression
@@ -262,7 +295,12 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer",
 			p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(&ParseError{
+			Pos:      p.currentToken.Pos,
+			Found:    p.currentToken,
+			Severity: SeverityError,
+			Message:  msg,
+		})
 		return nil
 	}
 
@@ -279,12 +317,20 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for !p.currentTokenIs(token.RBRACE) && !p.currentTokenIs(token.EOF) {
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicking {
+			if p.synchronize() {
+				break
+			}
+		} else if statement != nil {
 			block.Statements = append(block.Statements, statement)
 		}
 		p.nextToken()
 	}
 
+	if p.currentTokenIs(token.RBRACE) {
+		block.Rbrace = p.currentToken.Pos
+	}
+
 	return block
 }
 
@@ -328,7 +374,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.Defaults, lit.Patterns, lit.Variadic = p.parseFunctionParameters()
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -339,42 +385,103 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// parseFunctionParameters parses a parameter list. Parameters may be
+// patterns and have a default value, after which every parameter needs
+// one, and the last may be prefixed with "..." to collect the remaining
+// arguments.
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []ast.Expression, []ast.Expression, bool) {
 	identifiers := []*ast.Identifier{}
+	var defaults, patterns []ast.Expression
+	variadic := false
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return identifiers, nil, nil, false
 	}
 
-	p.nextToken()
+	for {
+		p.nextToken()
 
-	ident := &ast.Identifier{Token: p.currentToken,
-		Value: p.currentToken.Literal}
-	identifiers = append(identifiers, ident)
+		if variadic {
+			p.parameterError("the rest parameter must be the last parameter")
+			return nil, nil, nil, false
+		}
+		if p.currentTokenIs(token.ELLIPSIS) {
+			variadic = true
+			if !p.expectPeek(token.IDENT) {
+				return nil, nil, nil, false
+			}
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
-		ident := &ast.Identifier{Token: p.currentToken,
-			Value: p.currentToken.Literal}
+		var ident *ast.Identifier
+		if p.currentTokenIs(token.LBRACKET) || p.currentTokenIs(token.LBRACE) {
+			tok := p.currentToken
+			pattern := p.parsePattern()
+			if pattern == nil {
+				return nil, nil, nil, false
+			}
+			ident = &ast.Identifier{Token: tok, Value: pattern.String()}
+			if patterns == nil {
+				patterns = make([]ast.Expression, len(identifiers))
+			}
+			patterns = append(patterns, pattern)
+		} else {
+			ident = &ast.Identifier{Token: p.currentToken,
+				Value: p.currentToken.Literal}
+			if patterns != nil {
+				patterns = append(patterns, nil)
+			}
+		}
 		identifiers = append(identifiers, ident)
+
+		var value ast.Expression
+		if !variadic && p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parseExpression(LOWEST)
+			if defaults == nil {
+				defaults = make([]ast.Expression, len(identifiers)-1)
+			}
+		}
+		if defaults != nil {
+			if value == nil && !variadic {
+				p.parameterError(fmt.Sprintf("parameter %s needs a default value, it follows a parameter with one", ident.Value))
+				return nil, nil, nil, false
+			}
+			defaults = append(defaults, value)
+		}
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, nil, nil, false
 	}
 
-	return identifiers
+	return identifiers, defaults, patterns, variadic
+}
+
+func (p *Parser) parameterError(msg string) {
+	p.addError(&ParseError{
+		Pos:      p.currentToken.Pos,
+		Found:    p.currentToken,
+		Severity: SeverityError,
+		Message:  msg,
+	})
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	expression := &ast.CallExpression{Token: p.currentToken, Function: function}
-	expression.Arguments = p.parseExpressionList(token.RPAREN)
+	expression.Arguments = p.parseCallArguments()
 
 	return expression
 }
 
+// parseCallArguments parses the arguments of a call, where "..." spreads
+// an array into separate arguments.
 func (p *Parser) parseCallArguments() []ast.Expression {
 	args := []ast.Expression{}
 
@@ -384,12 +491,12 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseCallArgument())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseCallArgument())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -399,9 +506,24 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 	return args
 }
 
+func (p *Parser) parseCallArgument() ast.Expression {
+	if !p.currentTokenIs(token.ELLIPSIS) {
+		return p.parseExpression(LOWEST)
+	}
+	spread := &ast.SpreadExpression{Token: p.currentToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LOWEST)
+	return spread
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(&ParseError{
+		Pos:      p.currentToken.Pos,
+		Found:    p.currentToken,
+		Severity: SeverityError,
+		Message:  msg,
+	})
 }
 
 func (p *Parser) currentTokenIs(t token.TokenType) bool {
@@ -412,6 +534,15 @@ func (p *Parser) peekTokenIs(t token.TokenType) bool {
 	return p.peekToken.Type == t
 }
 
+// Precedence returns the binding power of t when it appears as an infix
+// operator, or LOWEST if it is not one.
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -444,10 +575,43 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 		Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+// parseTemplateLiteral parses the values interpolated into a string and
+// the text around them, which the lexer splits into a head, middles and a
+// tail.
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{
+		Token:    p.currentToken,
+		Segments: []string{p.currentToken.Literal},
+	}
+
+	for {
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		template.Values = append(template.Values, value)
+
+		if p.peekTokenIs(token.TEMPLATE_MIDDLE) {
+			p.nextToken()
+			template.Segments = append(template.Segments, p.currentToken.Literal)
+			continue
+		}
+		if !p.expectPeek(token.TEMPLATE_TAIL) {
+			return nil
+		}
+		template.Segments = append(template.Segments, p.currentToken.Literal)
+		return template
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.currentToken}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.currentTokenIs(token.RBRACKET) {
+		array.Rbracket = p.currentToken.Pos
+	}
 
 	return array
 }
@@ -480,8 +644,35 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.currentToken, Left: left}
 
 	p.nextToken()
+	if p.currentTokenIs(token.COLON) {
+		return p.parseSliceExpression(exp)
+	}
 	exp.Index = p.parseExpression(LOWEST)
 
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(exp)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseSliceExpression finishes left[start:end:step] once the index
+// expression has been parsed up to its first colon. Any of start, end and
+// step may be left out.
+func (p *Parser) parseSliceExpression(index *ast.IndexExpression) ast.Expression {
+	exp := &ast.SliceExpression{Token: index.Token, Left: index.Left, Start: index.Index}
+
+	exp.End = p.parseSliceBound()
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Step = p.parseSliceBound()
+	}
+
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
@@ -489,6 +680,16 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseSliceBound parses the bound of a slice after a colon, or returns nil
+// when it is left out.
+func (p *Parser) parseSliceBound() ast.Expression {
+	if p.peekTokenIs(token.COLON) || p.peekTokenIs(token.RBRACKET) {
+		return nil
+	}
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currentToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
@@ -513,6 +714,36 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.currentToken.Pos
 
 	return hash
 }
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	var defaults, patterns []ast.Expression
+	var variadic bool
+	lit.Parameters, defaults, patterns, variadic = p.parseFunctionParameters()
+	if defaults != nil || patterns != nil || variadic {
+		p.addError(&ParseError{
+			Pos:      lit.Token.Pos,
+			Found:    lit.Token,
+			Severity: SeverityError,
+			Message:  "macro parameters cannot have default values, be patterns or collect the rest",
+		})
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"interpreter/ast"
 	"interpreter/lexer"
+	"interpreter/token"
+	"strings"
 	"testing"
 )
 
@@ -701,6 +703,328 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestDefaultAndRestParameterParsing(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+		expectedVariadic bool
+	}{
+		{"fn(a, b = 2) {};", []string{"a", "b"}, []string{"", "2"}, false},
+		{"fn(a = 1, b = a + 1) {};", []string{"a", "b"}, []string{"1", "(a + 1)"}, false},
+		{"fn(...rest) {};", []string{"rest"}, nil, true},
+		{"fn(a, b = [], ...rest) {};", []string{"a", "b", "rest"}, []string{"", "[]", ""}, true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("parameters, expected %d got %d", len(tt.expectedParams),
+				len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+
+		if len(function.Defaults) != len(tt.expectedDefaults) {
+			t.Fatalf("defaults, expected %d got %d", len(tt.expectedDefaults),
+				len(function.Defaults))
+		}
+		for i, expected := range tt.expectedDefaults {
+			got := ""
+			if function.Defaults[i] != nil {
+				got = function.Defaults[i].String()
+			}
+			if got != expected {
+				t.Errorf("default %d, expected %q got %q", i, expected, got)
+			}
+		}
+
+		if function.Variadic != tt.expectedVariadic {
+			t.Errorf("variadic, expected %t got %t", tt.expectedVariadic, function.Variadic)
+		}
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn(a = 1, b) {}", "1:11: parameter b needs a default value, it follows a parameter with one"},
+		{"fn(...a, b) {}", "1:10: the rest parameter must be the last parameter"},
+		{"fn(...1) {}", "1:7: expected next token to be IDENT got INT"},
+		{"macro(...a) {}", "1:1: macro parameters cannot have default values, be patterns or collect the rest"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("input %q: expected %q got %q", tt.input, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedPattern  string
+		expectedBindings []string
+	}{
+		{"let [a, b] = x;", "[a, b]", []string{"a", "b"}},
+		{"let [a, ...others] = x;", "[a, ...others]", []string{"a", "others"}},
+		{"let [a, [b, c],] = x;", "[a, [b, c]]", []string{"a", "b", "c"}},
+		{"let [] = x;", "[]", []string{}},
+		{"let {name, age: years} = x;", "{name, age:years}", []string{"name", "years"}},
+		{`let {"first name": first, 1: one} = x;`, "{first name:first, 1:one}", []string{"first", "one"}},
+		{"let {address: {city}, tags: [tag]} = x;", "{address:{city}, tags:[tag]}", []string{"city", "tag"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("statement not LetStatement, got %T", program.Statements[0])
+		}
+		if stmt.Name != nil {
+			t.Errorf("input %q: name, expected nil got %s", tt.input, stmt.Name)
+		}
+		if stmt.Pattern == nil || stmt.Pattern.String() != tt.expectedPattern {
+			t.Errorf("input %q: pattern, expected %q got %v", tt.input, tt.expectedPattern, stmt.Pattern)
+		}
+		testIdentifier(t, stmt.Value, "x")
+
+		bindings := []string{}
+		for _, ident := range stmt.Bindings() {
+			bindings = append(bindings, ident.Value)
+		}
+		if strings.Join(bindings, " ") != strings.Join(tt.expectedBindings, " ") {
+			t.Errorf("input %q: bindings, expected %v got %v", tt.input, tt.expectedBindings, bindings)
+		}
+	}
+}
+
+func TestPatternParameters(t *testing.T) {
+	input := "fn(a, [b, c], {d} = {}) {};"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	expectedParams := []string{"a", "[b, c]", "{d}"}
+	expectedPatterns := []string{"", "[b, c]", "{d}"}
+	if len(function.Parameters) != len(expectedParams) || len(function.Patterns) != len(expectedPatterns) {
+		t.Fatalf("expected %d parameters and patterns, got %d and %d", len(expectedParams),
+			len(function.Parameters), len(function.Patterns))
+	}
+	for i := range expectedParams {
+		if function.Parameters[i].Value != expectedParams[i] {
+			t.Errorf("parameter %d, expected %q got %q", i, expectedParams[i], function.Parameters[i].Value)
+		}
+		got := ""
+		if function.Patterns[i] != nil {
+			got = function.Patterns[i].String()
+		}
+		if got != expectedPatterns[i] {
+			t.Errorf("pattern %d, expected %q got %q", i, expectedPatterns[i], got)
+		}
+	}
+	if function.Default(2) == nil {
+		t.Errorf("expected a default value for parameter 2")
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let [a, 1] = x;", "1:9: expected an identifier, an array or a hash pattern, got INT"},
+		{"let [...a, b] = x;", "1:12: the rest element must be the last element of a pattern"},
+		{"let {a + 1} = x;", "1:8: expected next token to be , got +"},
+		{`let {"a"} = x;`, "1:9: expected next token to be : got }"},
+		{"fn([a) {}", "1:6: expected next token to be , got )"},
+		{"macro([a]) {}", "1:1: macro parameters cannot have default values, be patterns or collect the rest"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("input %q: expected %q got %q", tt.input, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedSegments []string
+		expectedValues   []string
+	}{
+		{`"Hello ${name}!"`, []string{"Hello ", "!"}, []string{"name"}},
+		{`"${a}${b + 1}"`, []string{"", "", ""}, []string{"a", "(b + 1)"}},
+		{`"a ${"b ${c}"} d"`, []string{"a ", " d"}, []string{"b ${c}"}},
+		{`"${ {"k": 1}["k"] }"`, []string{"", ""}, []string{"({k:1}[k])"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		template, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.TemplateLiteral)
+		if !ok {
+			t.Fatalf("expression not TemplateLiteral, got %T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+		}
+		if strings.Join(template.Segments, "|") != strings.Join(tt.expectedSegments, "|") {
+			t.Errorf("input %q: segments, expected %q got %q", tt.input, tt.expectedSegments, template.Segments)
+		}
+		values := []string{}
+		for _, v := range template.Values {
+			values = append(values, v.String())
+		}
+		if strings.Join(values, "|") != strings.Join(tt.expectedValues, "|") {
+			t.Errorf("input %q: values, expected %q got %q", tt.input, tt.expectedValues, values)
+		}
+	}
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"a ${}"`, "1:6: no prefix parse function for TEMPLATE_TAIL found"},
+		{`"a ${b c}"`, "1:8: expected next token to be TEMPLATE_TAIL got IDENT"},
+		{`"a ${b`, "1:7: expected next token to be TEMPLATE_TAIL got EOF"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("input %q: expected %q got %q", tt.input, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x) { 0 => "zero", [first, ...others] => first, {"type": "user", name} => name, n if n > 10 => n, -1 => 1, true => 2, _ => x, }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	match, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("expression not MatchExpression, got %T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	testIdentifier(t, match.Value, "x")
+
+	expectedArms := []string{
+		"0 => zero",
+		"[first, ...others] => first",
+		"{type:user, name} => name",
+		"n if (n > 10) => n",
+		"(-1) => 1",
+		"true => 2",
+		"_ => x",
+	}
+	if len(match.Arms) != len(expectedArms) {
+		t.Fatalf("arms, expected %d got %d", len(expectedArms), len(match.Arms))
+	}
+	for i, arm := range match.Arms {
+		if arm.String() != expectedArms[i] {
+			t.Errorf("arm %d, expected %q got %q", i, expectedArms[i], arm.String())
+		}
+	}
+	if match.Rbrace.Column != len(input) {
+		t.Errorf("rbrace, expected column %d got %d", len(input), match.Rbrace.Column)
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"match x { _ => 1 }", "1:7: expected next token to be ( got IDENT"},
+		{"match (x) { _ -> 1 }", "1:15: expected next token to be => got -"},
+		{"match (x) { a + 1 => 1 }", "1:15: expected next token to be => got +"},
+		{"match (x) { 1 => 1 2 => 2 }", "1:20: expected next token to be , got INT"},
+		{"match (x) { fn() {} => 1 }", "1:13: expected an identifier, an array or a hash pattern, got FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("input %q: expected an error", tt.input)
+			continue
+		}
+		if errors[0].Error() != tt.expectedError {
+			t.Errorf("input %q: expected %q got %q", tt.input, tt.expectedError, errors[0].Error())
+		}
+	}
+}
+
+func TestSpreadArguments(t *testing.T) {
+	input := "f(1, ...xs, ...[2, 3])"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	call := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+	if len(call.Arguments) != 3 {
+		t.Fatalf("arguments, expected 3 got %d", len(call.Arguments))
+	}
+	testLiteralExpression(t, call.Arguments[0], 1)
+
+	spread, ok := call.Arguments[1].(*ast.SpreadExpression)
+	if !ok {
+		t.Fatalf("argument 1 not SpreadExpression, got %T", call.Arguments[1])
+	}
+	testIdentifier(t, spread.Value, "xs")
+
+	if call.String() != "f(1,...xs,...[2, 3])" {
+		t.Errorf("String, got %q", call.String())
+	}
+}
+
 func TestCallExpression(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -799,6 +1123,60 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpression(t *testing.T) {
+	input := "foo[1:n + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	sliceExp, ok := statement.Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not SliceExpression, got %T", statement.Expression)
+	}
+	if !testIdentifier(t, sliceExp.Left, "foo") {
+		return
+	}
+	if !testIntegerLiteral(t, sliceExp.Start, 1) {
+		return
+	}
+	if !testInfixExpression(t, sliceExp.End, "n", "+", 1) {
+		return
+	}
+	if sliceExp.String() != "(foo[1:(n + 1)])" {
+		t.Errorf("wrong string. got=%q", sliceExp.String())
+	}
+}
+
+func TestParsingSliceExpressionOptionalBounds(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:]", "(a[1:])"},
+		{"a[:2]", "(a[:2])"},
+		{"a[:]", "(a[:])"},
+		{"a[::-1]", "(a[::(-1)])"},
+		{"a[1:5:2]", "(a[1:5:2])"},
+		{"a[-2::]", "(a[(-2):])"},
+		{"a[:-1][0]", "((a[:(-1)])[0])"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -927,3 +1305,166 @@ func TestFunctionLiteralName(t *testing.T) {
 		t.Fatalf("function name, expected myFunction got %s", function.Name)
 	}
 }
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements []string
+	}{
+		{
+			"let x = add(1, 2; let y = 3; y",
+			[]string{"1:17: expected next token to be ) got ;"},
+			[]string{"let y = 3;", "y"},
+		},
+		{
+			"let a = 1 +; let b = ); let c = 3",
+			[]string{
+				"1:12: no prefix parse function for ; found",
+				"1:22: no prefix parse function for ) found",
+			},
+			[]string{"let c = 3;"},
+		},
+		{
+			"if (x { let y = 1; } let z = 2;",
+			[]string{"1:7: expected next token to be ) got {"},
+			[]string{"let z = 2;"},
+		},
+		{
+			"let f = fn(a) { let = 5; a }; f(1)",
+			[]string{"1:21: expected next token to be IDENT got ="},
+			[]string{"let f = fn<f>(a) a;", "f(1)"},
+		},
+		{
+			"let g = fn() { x + }; g()",
+			[]string{"1:20: no prefix parse function for } found"},
+			[]string{"let g = fn<g>() ;", "g()"},
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("input %q: expected %d errors got %d: %v", tt.input,
+				len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, err := range errors {
+			if err.Error() != tt.expectedErrors[i] {
+				t.Errorf("input %q: error %d, expected %q got %q", tt.input, i,
+					tt.expectedErrors[i], err.Error())
+			}
+		}
+
+		if len(program.Statements) != len(tt.expectedStatements) {
+			t.Errorf("input %q: expected %d statements got %d", tt.input,
+				len(tt.expectedStatements), len(program.Statements))
+			continue
+		}
+		for i, statement := range program.Statements {
+			if statement.String() != tt.expectedStatements[i] {
+				t.Errorf("input %q: statement %d, expected %q got %q", tt.input,
+					i, tt.expectedStatements[i], statement.String())
+			}
+		}
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	input := `let x = 1;
+let y = (2 + 3;`
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error got %d", len(errors))
+	}
+
+	err := errors[0]
+	if err.Pos != (token.Position{Line: 2, Column: 15}) {
+		t.Errorf("position, expected 2:15 got %s", err.Pos)
+	}
+	if err.Severity != SeverityError {
+		t.Errorf("severity, expected error got %s", err.Severity)
+	}
+	if err.ExpectedString() != ")" {
+		t.Errorf("expected, expected %q got %q", ")", err.ExpectedString())
+	}
+	if err.Found.Type != token.SEMICOLON {
+		t.Errorf("found, expected %s got %s", token.SEMICOLON, err.Found.Type)
+	}
+}
+
+func TestParserMaxErrors(t *testing.T) {
+	input := "let = 1; let = 2; let = 3; let = 4; let ok = 5;"
+
+	p := New(lexer.New(input))
+	p.SetMaxErrors(2)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 2 {
+		t.Fatalf("expected 2 errors got %d", len(p.Errors()))
+	}
+	if len(program.Statements) != 0 {
+		t.Fatalf("expected parsing to stop, got %d statements",
+			len(program.Statements))
+	}
+
+	p = New(lexer.New(input))
+	p.SetMaxErrors(0)
+	program = p.ParseProgram()
+
+	if len(p.Errors()) != 4 {
+		t.Fatalf("expected 4 errors got %d", len(p.Errors()))
+	}
+	if len(program.Statements) != 1 {
+		t.Fatalf("expected 1 statement got %d", len(program.Statements))
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("statements, expected 1 got %d", len(program.Statements))
+	}
+
+	statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement not ExpressionStatement, got %T", program.Statements[0])
+	}
+
+	macro, ok := statement.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("expression not MacroLiteral, got %T", statement.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("parameters, expected 2 got %d", len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("body statements, expected 1 got %d", len(macro.Body.Statements))
+	}
+
+	bodyStatement, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("body statement not ExpressionStatement, got %T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStatement.Expression, "x", "+", "y")
+}
@@ -0,0 +1,188 @@
+package parser
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/token"
+)
+
+// parsePattern parses the target of a destructuring binding starting at
+// the current token: an identifier, an array pattern such as
+// [a, [b, c], ...rest] or a hash pattern such as {name, "age": years}.
+// In a match arm it also parses literals.
+func (p *Parser) parsePattern() ast.Expression {
+	if p.matching {
+		switch {
+		case p.currentTokenIs(token.INT):
+			return p.parseIntegerLiteral()
+		case p.currentTokenIs(token.STRING):
+			return p.parseStringLiteral()
+		case p.currentTokenIs(token.TRUE), p.currentTokenIs(token.FALSE):
+			return p.parseBoolean()
+		case p.currentTokenIs(token.MINUS) && p.peekTokenIs(token.INT):
+			return p.parsePrefixExpression()
+		}
+	}
+
+	switch p.currentToken.Type {
+	case token.IDENT:
+		return p.parseIdentifier()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+
+	msg := fmt.Sprintf("expected an identifier, an array or a hash pattern, got %s", p.currentToken.Type)
+	p.addError(&ParseError{
+		Pos:      p.currentToken.Pos,
+		Expected: []token.TokenType{token.IDENT, token.LBRACKET, token.LBRACE},
+		Found:    p.currentToken,
+		Severity: SeverityError,
+		Message:  msg,
+	})
+	return nil
+}
+
+func (p *Parser) parseArrayPattern() ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.currentToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		if pattern.Rest != nil {
+			p.parameterError("the rest element must be the last element of a pattern")
+			return nil
+		}
+		if p.currentTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		} else {
+			element := p.parsePattern()
+			if element == nil {
+				return nil
+			}
+			pattern.Elements = append(pattern.Elements, element)
+		}
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseHashPattern parses a hash pattern. A key that is an identifier
+// stands for the string of its name, and without a pattern of its own it
+// binds the variable of that name.
+func (p *Parser) parseHashPattern() ast.Expression {
+	pattern := &ast.HashPattern{Token: p.currentToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		pair := &ast.PatternPair{}
+		if p.currentTokenIs(token.IDENT) {
+			pair.Key = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+			pair.Pattern = p.parseIdentifier()
+		} else {
+			pair.Key = p.parseExpression(LOWEST)
+			if !p.peekTokenIs(token.COLON) {
+				p.peekError(token.COLON)
+				return nil
+			}
+		}
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			pair.Pattern = p.parsePattern()
+		}
+		if pair.Key == nil || pair.Pattern == nil {
+			return nil
+		}
+		pattern.Pairs = append(pattern.Pairs, pair)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	expression.Rbrace = p.currentToken.Pos
+
+	return expression
+}
+
+// parseMatchArm parses an arm of the form pattern [if guard] => body.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{}
+
+	p.matching = true
+	arm.Pattern = p.parsePattern()
+	p.matching = false
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+	arm.Body = p.parseExpression(LOWEST)
+	if arm.Body == nil {
+		return nil
+	}
+
+	return arm
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"interpreter/object"
+	"interpreter/script"
+	"interpreter/vm"
+	"os"
+)
+
+// runProfile implements `profile [-O0] [-o file] [-interval d] <file>`. It runs
+// the script on the VM and prints its function and opcode profile; with -o
+// it also writes the sampled call stacks for `go tool pprof`.
+func runProfile(args []string) int {
+	flags := flag.NewFlagSet("profile", flag.ContinueOnError)
+	output := flags.String("o", "", "write a pprof profile to `file`")
+	interval := flags.Duration("interval", vm.DefaultSampleInterval, "sampling interval")
+	noOptimize := flags.Bool("O0", false, "disable optimizations")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: profile [-O0] [-o file] [-interval d] <file>")
+		return 2
+	}
+	name := flags.Arg(0)
+
+	src, err := os.ReadFile(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	bytecode, err := script.Compile(string(src), !*noOptimize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 2
+	}
+
+	profiler := vm.NewProfiler(*interval)
+	profiler.Filename = name
+	machine := vm.New(bytecode)
+	machine.SetProfiler(profiler)
+
+	status := 0
+	if err := machine.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		if err, ok := err.(*vm.RuntimeError); ok {
+			fmt.Fprint(os.Stderr, object.FormatTrace(err.Trace))
+		}
+		status = 1
+	}
+
+	profiler.WriteReport(os.Stdout)
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer f.Close()
+		if err := profiler.WritePprof(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	return status
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"interpreter/compiler"
+	"interpreter/evaluator"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
@@ -22,6 +23,7 @@ func Start(in io.Reader, out io.Writer) {
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
+	macroEnv := object.NewEnvironment()
 
 	for {
 		fmt.Fprintf(out, prompt)
@@ -41,8 +43,15 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			fmt.Fprintf(out, "Macro expansion failed:\n %s\n", err)
+			continue
+		}
+
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		err = comp.Compile(expanded)
 		if err != nil {
 			fmt.Fprintf(out, "Compilation failed:\n %s\n", err)
 			continue
@@ -55,17 +64,23 @@ func Start(in io.Reader, out io.Writer) {
 		err = machine.Run()
 		if err != nil {
 			fmt.Fprintf(out, "Executing bytecode failed:\n %s\n", err)
+			if err, ok := err.(*vm.RuntimeError); ok {
+				io.WriteString(out, object.FormatTrace(err.Trace))
+			}
 			continue
 		}
 
 		stackTop := machine.LastPoppedStackElem()
+		if stackTop == nil {
+			continue
+		}
 		io.WriteString(out, stackTop.Inspect())
 		io.WriteString(out, "\n")
 	}
 }
 
-func printParseErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParseErrors(out io.Writer, errors []*parser.ParseError) {
+	for _, err := range errors {
+		io.WriteString(out, "\t"+err.Error()+"\n")
 	}
 }
@@ -0,0 +1,47 @@
+// Package script compiles whole source files for the tools that run them
+// outside the REPL.
+package script
+
+import (
+	"errors"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+)
+
+// Compile parses src, expands its macros and compiles the result. With
+// optimize false the compiler emits the program as written, as -O0 asks.
+func Compile(src string, optimize bool) (*compiler.Bytecode, error) {
+	program, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	comp.SetOptimizations(optimize)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return comp.Bytecode(), nil
+}
+
+// Parse parses src and expands its macros, returning the program that is
+// ready to be compiled or evaluated.
+func Parse(src string) (ast.Node, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		errs := []error{}
+		for _, err := range p.Errors() {
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	return evaluator.ExpandMacros(program, macroEnv)
+}
@@ -0,0 +1,119 @@
+package script
+
+import (
+	"interpreter/evaluator"
+	"interpreter/object"
+	"interpreter/vm"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	src := `let unless = macro(cond, cons, alt) { quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) }) };
+let double = fn(x) { x * 2 };
+unless(false, double(21), 0);`
+
+	bytecode, err := Compile(src, true)
+	if err != nil {
+		t.Fatalf("Compile returned error: %s", err)
+	}
+
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	result, ok := machine.LastPoppedStackElem().(*object.Integer)
+	if !ok || result.Value != 42 {
+		t.Errorf("wrong result. want=42, got=%v", machine.LastPoppedStackElem())
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 1;", "1:5: expected next token to be IDENT got ="},
+		{"let m = macro(a) { quote(a) }; m(1, 2);", "wrong number of arguments"},
+		{"x;", "undefined variable x"},
+	}
+
+	for _, tt := range tests {
+		_, err := Compile(tt.input, true)
+		if err == nil {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestEnginesAgree(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"ab" == "a" + "b"`, "true"},
+		{`"ab" != "a" + "b"`, "false"},
+		{`let a = "x"; let b = "x"; a == b`, "true"},
+		{`let a = "x"; [a == "${a}", a == "y", "a" == 1]`, "[true, false, false]"},
+		{`["héllo"[1], "héllo"[-1], len("héllo"), "héllo"[1:3]]`, "[é, o, 5, él]"},
+		{`[int("abc"), 1]`, `[Error: could not convert "abc" to INTEGER, 1]`},
+		{`let x = int("abc"); assertError(x, "convert"); 2`, "2"},
+		{`repeat("ab", 9223372036854775807)`, "Error: result of `repeat` too long: 9223372036854775807 times 2 bytes"},
+		{`let f = fn(x) { x[0] }; f(1)`, "Error: index operator not supported: INTEGER"},
+		{`let f = fn(b, a = match (1) { 1 => 10, _ => 0 }) { [b, a] }; [f(7, 3), f(7)]`, "[[7, 3], [7, 10]]"},
+		{`let a = 1; let f = fn(b = a, a = 2) { [b, a] }; f()`, "[1, 2]"},
+		{`[[1, 2, 3][0::9223372036854775807], [1, 2, 3][::-9223372036854775807 - 1], slice("héllo", 1, 99)]`, "[[1], [3], éllo]"},
+	}
+
+	for _, tt := range tests {
+		for engine, result := range results(t, tt.input) {
+			if result != tt.expected {
+				t.Errorf("wrong result for %q with %s. want=%q, got=%q", tt.input, engine, tt.expected, result)
+			}
+		}
+	}
+}
+
+// results runs input with the evaluator and with the VM, with and without
+// optimizations, and returns what each of them makes of it: the inspected
+// result, or the error that stopped the program.
+func results(t *testing.T, input string) map[string]string {
+	t.Helper()
+
+	program, err := Parse(input)
+	if err != nil {
+		t.Fatalf("parse error for %q: %s", input, err)
+	}
+	results := map[string]string{
+		"evaluator": inspect(evaluator.Eval(program, object.NewEnvironment())),
+	}
+
+	for _, optimize := range []bool{false, true} {
+		engine := "vm -O0"
+		if optimize {
+			engine = "vm"
+		}
+		bytecode, err := Compile(input, optimize)
+		if err != nil {
+			t.Fatalf("compile error for %q: %s", input, err)
+		}
+		machine := vm.New(bytecode)
+		if err := machine.Run(); err != nil {
+			results[engine] = "Error: " + err.Error()
+			continue
+		}
+		results[engine] = inspect(machine.LastPoppedStackElem())
+	}
+	return results
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "null"
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,99 @@
+package scripttest
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteTAP writes results in the Test Anything Protocol, with each
+// failure as a diagnostic line after its test.
+func WriteTAP(w io.Writer, results []Result) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "TAP version 13\n1..%d\n", len(results))
+	for i, r := range results {
+		status := "ok"
+		if !r.Passed() {
+			status = "not ok"
+		}
+		fmt.Fprintf(bw, "%s %d - %s %s\n", status, i+1, r.File, r.Name)
+		for _, line := range strings.Split(r.Failure, "\n") {
+			if line != "" {
+				fmt.Fprintf(bw, "# %s\n", line)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes results as JUnit XML with one test suite per file.
+func WriteJUnit(w io.Writer, results []Result) error {
+	suites := junitSuites{}
+	var total time.Duration
+	durations := []time.Duration{}
+
+	for _, r := range results {
+		if len(suites.Suites) == 0 || suites.Suites[len(suites.Suites)-1].Name != r.File {
+			suites.Suites = append(suites.Suites, junitSuite{Name: r.File})
+			durations = append(durations, 0)
+		}
+		suite := &suites.Suites[len(suites.Suites)-1]
+
+		c := junitCase{Name: r.Name, Classname: r.File, Time: seconds(r.Duration)}
+		if !r.Passed() {
+			c.Failure = &junitFailure{Message: r.Failure}
+			suite.Failures++
+			suites.Failures++
+		}
+		suite.Cases = append(suite.Cases, c)
+		suite.Tests++
+		suites.Tests++
+		durations[len(durations)-1] += r.Duration
+		total += r.Duration
+	}
+	for i := range suites.Suites {
+		suites.Suites[i].Time = seconds(durations[i])
+	}
+	suites.Time = seconds(total)
+
+	out, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
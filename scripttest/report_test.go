@@ -0,0 +1,56 @@
+package scripttest
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+var results = []Result{
+	{File: "a_test.monkey", Name: "test_one", Duration: 1500 * time.Microsecond},
+	{File: "a_test.monkey", Name: "test_two", Duration: time.Millisecond,
+		Failure: `a_test.monkey:3: assertEqual failed: want="<a>", got=1`},
+	{File: "b_test.monkey", Name: "test_three", Duration: 2 * time.Millisecond},
+}
+
+func TestWriteTAP(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteTAP(&out, results); err != nil {
+		t.Fatalf("WriteTAP returned error: %s", err)
+	}
+
+	expected := `TAP version 13
+1..3
+ok 1 - a_test.monkey test_one
+not ok 2 - a_test.monkey test_two
+# a_test.monkey:3: assertEqual failed: want="<a>", got=1
+ok 3 - b_test.monkey test_three
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var out bytes.Buffer
+	if err := WriteJUnit(&out, results); err != nil {
+		t.Fatalf("WriteJUnit returned error: %s", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites tests="3" failures="1" time="0.004">
+  <testsuite name="a_test.monkey" tests="2" failures="1" time="0.003">
+    <testcase name="test_one" classname="a_test.monkey" time="0.002"></testcase>
+    <testcase name="test_two" classname="a_test.monkey" time="0.001">
+      <failure message="a_test.monkey:3: assertEqual failed: want=&#34;&lt;a&gt;&#34;, got=1"></failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="b_test.monkey" tests="1" failures="0" time="0.002">
+    <testcase name="test_three" classname="b_test.monkey" time="0.002"></testcase>
+  </testsuite>
+</testsuites>
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,161 @@
+// Package scripttest runs the tests in *_test.monkey files. A test is a
+// top-level function whose name starts with test_; it fails when it stops
+// with an error, such as a failed assertion.
+package scripttest
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/ast"
+	"interpreter/compiler"
+	"interpreter/script"
+	"interpreter/vm"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// FileSuffix marks the files that hold tests.
+	FileSuffix = "_test.monkey"
+	// TestPrefix marks the functions that are tests.
+	TestPrefix = "test_"
+)
+
+type Options struct {
+	// Run selects the tests to run by name; nil runs all of them.
+	Run *regexp.Regexp
+	// Timeout bounds the time of each test; zero means no limit.
+	Timeout time.Duration
+	// NoOptimize compiles the tests without optimizations.
+	NoOptimize bool
+}
+
+type Result struct {
+	File     string
+	Name     string
+	Duration time.Duration
+	// Failure says why the test failed, starting with the position of the
+	// failure when it is known. It is empty when the test passed.
+	Failure string
+}
+
+func (r Result) Passed() bool {
+	return r.Failure == ""
+}
+
+// Discover returns the test files among paths, looking through
+// directories recursively. Files named explicitly are returned whatever
+// their name.
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(name, FileSuffix) {
+				files = append(files, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// RunFile runs the tests in src, each in a fresh VM that first runs the
+// top-level statements of the file. The error reports a file that does not
+// compile.
+func RunFile(name string, src []byte, opts Options) ([]Result, error) {
+	node, err := script.Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	program := node.(*ast.Program)
+	if err := compiler.New().Compile(program); err != nil {
+		return nil, err
+	}
+
+	results := []Result{}
+	for _, test := range tests(program) {
+		if opts.Run != nil && !opts.Run.MatchString(test.Value) {
+			continue
+		}
+		result, err := run(name, program, test, opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// tests returns the names of the tests defined in program, in order.
+func tests(program *ast.Program) []*ast.Identifier {
+	names := []*ast.Identifier{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil || !strings.HasPrefix(let.Name.Value, TestPrefix) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name)
+		}
+	}
+	return names
+}
+
+// run calls test after the rest of program. The call is attributed to the
+// test's definition, where errors calling it are reported.
+func run(file string, program *ast.Program, test *ast.Identifier, opts Options) (Result, error) {
+	call := &ast.ExpressionStatement{
+		Token:      test.Token,
+		Expression: &ast.CallExpression{Token: test.Token, Function: test},
+	}
+	statements := append(append([]ast.Statement{}, program.Statements...), call)
+
+	comp := compiler.New()
+	comp.SetOptimizations(!opts.NoOptimize)
+	if err := comp.Compile(&ast.Program{Statements: statements}); err != nil {
+		return Result{}, err
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetLimits(vm.Limits{Timeout: opts.Timeout})
+
+	start := time.Now()
+	err := machine.Run()
+	result := Result{File: file, Name: test.Value, Duration: time.Since(start)}
+	if err != nil {
+		result.Failure = failure(file, machine, err, opts)
+	}
+	return result, nil
+}
+
+// failure describes err at the line the VM stopped at.
+func failure(file string, machine *vm.VM, err error, opts Options) string {
+	message := err.Error()
+	if errors.Is(err, vm.ErrTimeout) {
+		message = fmt.Sprintf("test timed out after %s", opts.Timeout)
+	}
+
+	if line := machine.Backtrace()[0].Line; line > 0 {
+		return fmt.Sprintf("%s:%d: %s", file, line, message)
+	}
+	return fmt.Sprintf("%s: %s", file, message)
+}
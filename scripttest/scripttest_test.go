@@ -0,0 +1,118 @@
+package scripttest
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+const input = `let double = fn(x) { x * 2 };
+let test_double = fn() {
+  assertEqual(double(2), 4);
+};
+let test_failing = fn() {
+  let helper = fn(x) {
+    assertEqual(double(x), 5);
+  };
+  helper(2);
+};
+let test_runtime_error = fn() {
+  double(true)
+};
+let test_forever = fn() {
+  let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } };
+  f(40);
+};
+let test_arguments = fn(x) { x };
+let not_a_test = fn() { assert(false) };
+let test_value = 1;`
+
+func TestRunFile(t *testing.T) {
+	results, err := RunFile("a_test.monkey", []byte(input), Options{Timeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+
+	expected := []Result{
+		{File: "a_test.monkey", Name: "test_double"},
+		{File: "a_test.monkey", Name: "test_failing",
+			Failure: "a_test.monkey:7: assertEqual failed: want=5, got=4"},
+		{File: "a_test.monkey", Name: "test_runtime_error",
+			Failure: "a_test.monkey:1: unsupported types for binary operation: BOOLEAN INTEGER"},
+		{File: "a_test.monkey", Name: "test_forever",
+			Failure: "a_test.monkey:15: test timed out after 20ms"},
+		{File: "a_test.monkey", Name: "test_arguments",
+			Failure: "a_test.monkey:18: wrong number of arguments to fn test_arguments(x): want=1, got=0"},
+	}
+	for i := range results {
+		results[i].Duration = 0
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("wrong results.\nwant=%+v\ngot=%+v", expected, results)
+	}
+}
+
+func TestRunFileFilter(t *testing.T) {
+	results, err := RunFile("a_test.monkey", []byte(input), Options{Run: regexp.MustCompile("double|error")})
+	if err != nil {
+		t.Fatalf("RunFile returned error: %s", err)
+	}
+
+	names := []string{}
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"test_double", "test_runtime_error"}) {
+		t.Errorf("wrong tests run. got=%v", names)
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let test_a = fn() { ;", "1:21: no prefix parse function for ; found"},
+		{"let test_a = fn() { b };", "undefined variable b"},
+	}
+
+	for _, tt := range tests {
+		_, err := RunFile("a_test.monkey", []byte(tt.input), Options{})
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.monkey", "b.monkey", "sub/c_test.monkey", "sub/d_test.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := Discover([]string{dir, filepath.Join(dir, "b.monkey")})
+	if err != nil {
+		t.Fatalf("Discover returned error: %s", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "a_test.monkey"),
+		filepath.Join(dir, "sub/c_test.monkey"),
+		filepath.Join(dir, "b.monkey"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("wrong files.\nwant=%v\ngot=%v", expected, files)
+	}
+
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected error for missing path")
+	}
+}
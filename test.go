@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"interpreter/scripttest"
+	"io"
+	"os"
+	"regexp"
+	"time"
+)
+
+// runTest implements `test [-O0] [-run regexp] [-format tap|junit]
+// [-timeout d] [-o file] [<path>...]`. It runs the test functions of every
+// *_test.monkey file under the paths, the current directory by default,
+// and reports the results. The exit status is 1 if any test failed or any
+// file could not be run.
+func runTest(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	run := flags.String("run", "", "run only the tests whose name matches `regexp`")
+	format := flags.String("format", "tap", "report format: tap or junit")
+	timeout := flags.Duration("timeout", 10*time.Second, "fail a test that runs longer than `d`, 0 for no limit")
+	output := flags.String("o", "", "write the report to `file` instead of stdout")
+	noOptimize := flags.Bool("O0", false, "disable optimizations")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var write func(io.Writer, []scripttest.Result) error
+	switch *format {
+	case "tap":
+		write = scripttest.WriteTAP
+	case "junit":
+		write = scripttest.WriteJUnit
+	default:
+		fmt.Fprintf(os.Stderr, "unknown report format %q\n", *format)
+		return 2
+	}
+
+	opts := scripttest.Options{Timeout: *timeout, NoOptimize: *noOptimize}
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		opts.Run = re
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := scripttest.Discover(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	status := 0
+	results := []scripttest.Result{}
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		rs, err := scripttest.RunFile(name, src, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+			status = 1
+			continue
+		}
+		for _, r := range rs {
+			if !r.Passed() {
+				status = 1
+			}
+		}
+		results = append(results, rs...)
+	}
+
+	if *output != "" {
+		err = writeFile(*output, func(w io.Writer) error { return write(w, results) })
+	} else {
+		err = write(os.Stdout, results)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return status
+}
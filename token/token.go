@@ -1,21 +1,50 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is a 1-based line and column in the source. The zero value
+// means the position is unknown.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	// Identifiers + literals
 	IDENT  = "IDENT"
 	INT    = "INT"
 	STRING = "STRING"
 
+	// A string literal with interpolated values is lexed as a head, up to
+	// the first "${", a middle between each "}" and the next "${", and a
+	// tail after the last "}".
+	TEMPLATE_HEAD   = "TEMPLATE_HEAD"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_TAIL   = "TEMPLATE_TAIL"
+
 	// Operators
 	ASSIGN  = "="
 	PLUS    = "+"
@@ -30,7 +59,9 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
-	COLON = ":"
+	COLON    = ":"
+	ELLIPSIS = "..."
+	ARROW    = "=>"
 
 	// Delimiters
 	COMMA     = ","
@@ -51,6 +82,8 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
+	MATCH    = "MATCH"
 )
 
 var keyword = map[string]TokenType{
@@ -61,6 +94,8 @@ var keyword = map[string]TokenType{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
+	"match":  MATCH,
 }
 
 func LookUpIdent(ident string) TokenType {
@@ -0,0 +1,63 @@
+// Package transport reads and writes messages framed with a Content-Length
+// header, the base protocol shared by LSP and DAP.
+package transport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const contentLength = "Content-Length"
+
+// ReadMessage reads the headers and body of the next message. It returns
+// io.EOF when r is exhausted between messages.
+func ReadMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), contentLength) {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid %s %q", contentLength, value)
+			}
+		}
+	}
+
+	if length == -1 {
+		return nil, fmt.Errorf("missing %s header", contentLength)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("reading body: %w", err)
+	}
+	return body, nil
+}
+
+// WriteMessage writes body preceded by its Content-Length header.
+func WriteMessage(w io.Writer, body []byte) error {
+	if _, err := fmt.Fprintf(w, "%s: %d\r\n\r\n", contentLength, len(body)); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	messages := []string{`{"a":1}`, ``, `{"text":"line\nline"}`}
+
+	var buf bytes.Buffer
+	for _, m := range messages {
+		if err := WriteMessage(&buf, []byte(m)); err != nil {
+			t.Fatalf("WriteMessage returned error: %s", err)
+		}
+	}
+
+	r := bufio.NewReader(&buf)
+	for _, want := range messages {
+		got, err := ReadMessage(r)
+		if err != nil {
+			t.Fatalf("ReadMessage returned error: %s", err)
+		}
+		if string(got) != want {
+			t.Errorf("wrong message. want=%q, got=%q", want, got)
+		}
+	}
+
+	if _, err := ReadMessage(r); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadMessageHeaders(t *testing.T) {
+	input := "Content-Type: application/vscode-jsonrpc; charset=utf-8\r\n" +
+		"content-length: 2\r\n\r\n{}"
+
+	got, err := ReadMessage(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("ReadMessage returned error: %s", err)
+	}
+	if string(got) != "{}" {
+		t.Errorf("wrong message. want=%q, got=%q", "{}", got)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []string{
+		"Content-Length: 10\r\n\r\n{}",
+		"Content-Length: x\r\n\r\n",
+		"Content-Type: text\r\n\r\n",
+		"nonsense\r\n\r\n",
+		"Content-Length: 2\r\n",
+	}
+
+	for _, input := range tests {
+		_, err := ReadMessage(bufio.NewReader(strings.NewReader(input)))
+		if err == nil || err == io.EOF {
+			t.Errorf("expected error for %q, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"interpreter/object"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTerminated is returned by Run when a debugger stops execution.
+var ErrTerminated = errors.New("execution terminated by debugger")
+
+type StopReason int
+
+const (
+	StopEntry StopReason = iota
+	StopBreakpoint
+	StopStep
+	StopPause
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopEntry:
+		return "entry"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopStep:
+		return "step"
+	case StopPause:
+		return "pause"
+	default:
+		return fmt.Sprintf("StopReason(%d)", int(r))
+	}
+}
+
+// Action tells a stopped VM how to resume.
+type Action int
+
+const (
+	// Continue runs until the next breakpoint.
+	Continue Action = iota
+	// StepIn stops at the next source line, entering calls.
+	StepIn
+	// StepOver stops at the next source line of the current function or
+	// of one of its callers.
+	StepOver
+	// StepOut stops once the current function returns.
+	StepOut
+	// Terminate makes Run return ErrTerminated.
+	Terminate
+)
+
+// Debugger stops a VM at breakpoints, given by source line, and after
+// steps. OnStop is called on the goroutine running the VM; the VM can be
+// inspected until it returns the Action to resume with.
+//
+// Breakpoints can be changed and Pause called from other goroutines while
+// the VM runs.
+type Debugger struct {
+	OnStop      func(vm *VM, reason StopReason) Action
+	StopOnEntry bool
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+	pause       atomic.Bool
+
+	started bool
+	action  Action
+	depth   int
+}
+
+func NewDebugger(onStop func(vm *VM, reason StopReason) Action) *Debugger {
+	return &Debugger{OnStop: onStop, breakpoints: make(map[int]bool)}
+}
+
+func (d *Debugger) SetBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[line] = true
+}
+
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, line)
+}
+
+func (d *Debugger) ClearBreakpoints() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints returns the lines with breakpoints in increasing order.
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := []int{}
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Pause stops the VM before its next instruction.
+func (d *Debugger) Pause() {
+	d.pause.Store(true)
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.breakpoints[line]
+}
+
+// instruction is called before the VM executes each instruction.
+func (d *Debugger) instruction(vm *VM) error {
+	frame := vm.currentFrame()
+	line := frame.cl.Fn.Lines.Line(frame.instructionPointer)
+	depth := vm.framesIndex
+
+	changed := line != 0 && line != frame.line
+	if line != 0 {
+		frame.line = line
+	}
+
+	reason, stop := d.shouldStop(line, depth, changed)
+	if !stop {
+		return nil
+	}
+
+	action := d.OnStop(vm, reason)
+	if action == Terminate {
+		return ErrTerminated
+	}
+	d.action = action
+	d.depth = depth
+	return nil
+}
+
+func (d *Debugger) shouldStop(line, depth int, changed bool) (StopReason, bool) {
+	if !d.started {
+		d.started = true
+		if d.StopOnEntry {
+			return StopEntry, true
+		}
+	}
+
+	if d.pause.Swap(false) {
+		return StopPause, true
+	}
+
+	switch d.action {
+	case StepIn:
+		if changed {
+			return StopStep, true
+		}
+	case StepOver:
+		if changed && depth <= d.depth {
+			return StopStep, true
+		}
+	case StepOut:
+		if depth < d.depth {
+			return StopStep, true
+		}
+	}
+
+	if changed && d.hasBreakpoint(line) {
+		return StopBreakpoint, true
+	}
+	return 0, false
+}
+
+// SetDebugger attaches d to the VM. It must be called before Run.
+func (vm *VM) SetDebugger(d *Debugger) {
+	vm.debugger = d
+}
+
+type Binding struct {
+	Name  string
+	Value object.Object
+}
+
+type StackFrame struct {
+	Function string
+	Line     int
+	Locals   []Binding
+	Free     []Binding
+}
+
+// Backtrace describes the active frames, innermost first. Locals that
+// have not been assigned yet and the compiler's hidden slots are left
+// out.
+func (vm *VM) Backtrace() []StackFrame {
+	frames := []StackFrame{}
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+
+		ip := frame.instructionPointer
+		if ip < 0 {
+			ip = 0
+		}
+		sf := StackFrame{Function: vm.functionName(fn), Line: fn.Lines.Line(ip)}
+
+		for j, name := range fn.LocalNames {
+			if object.IsHidden(name) {
+				continue
+			}
+			if value := vm.stack[frame.basePointer+j]; value != nil {
+				sf.Locals = append(sf.Locals, Binding{Name: name, Value: value})
+			}
+		}
+		for j, name := range fn.FreeNames {
+			sf.Free = append(sf.Free, Binding{Name: name, Value: frame.cl.Free[j]})
+		}
+		frames = append(frames, sf)
+	}
+	return frames
+}
+
+// Globals returns the global bindings that have been assigned, except for
+// the compiler's hidden slots. A name that was defined more than once
+// refers to its latest definition.
+func (vm *VM) Globals() []Binding {
+	latest := make(map[string]int)
+	for i, name := range vm.globalNames {
+		latest[name] = i
+	}
+
+	globals := []Binding{}
+	for i, name := range vm.globalNames {
+		if latest[name] != i || object.IsHidden(name) {
+			continue
+		}
+		if value := vm.globals[i]; value != nil {
+			globals = append(globals, Binding{Name: name, Value: value})
+		}
+	}
+	return globals
+}
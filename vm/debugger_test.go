@@ -0,0 +1,307 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/compiler"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const debuggerInput = `let a = 1;
+let add = fn(x, y) {
+    let z = x + y;
+    z
+};
+let b = add(a, 2);
+let c = add(b, 3);
+c`
+
+type stop struct {
+	reason StopReason
+	line   int
+	depth  int
+}
+
+// debug runs input, answering each stop with the next action and recording
+// where the VM stopped.
+func debug(t *testing.T, input string, breakpoints []int, entry bool, actions []Action) []stop {
+	program := parse(input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	stops := []stop{}
+	d := NewDebugger(func(vm *VM, reason StopReason) Action {
+		bt := vm.Backtrace()
+		stops = append(stops, stop{reason: reason, line: bt[0].Line, depth: len(bt)})
+		if len(stops) > len(actions) {
+			return Continue
+		}
+		return actions[len(stops)-1]
+	})
+	d.StopOnEntry = entry
+	for _, line := range breakpoints {
+		d.SetBreakpoint(line)
+	}
+
+	vm := New(comp.Bytecode())
+	vm.SetDebugger(d)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return stops
+}
+
+func TestDebuggerStops(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakpoints []int
+		entry       bool
+		actions     []Action
+		expected    []stop
+	}{
+		{
+			"breakpoints",
+			[]int{3, 7},
+			false,
+			nil,
+			[]stop{
+				{StopBreakpoint, 3, 2},
+				{StopBreakpoint, 7, 1},
+				{StopBreakpoint, 3, 2},
+			},
+		},
+		{
+			"step in",
+			nil,
+			true,
+			[]Action{StepIn, StepIn, StepIn, StepIn, StepIn, Continue},
+			[]stop{
+				{StopEntry, 1, 1},
+				{StopStep, 2, 1},
+				{StopStep, 6, 1},
+				{StopStep, 3, 2},
+				{StopStep, 4, 2},
+				{StopStep, 7, 1},
+			},
+		},
+		{
+			"step over",
+			[]int{6},
+			false,
+			[]Action{StepOver, StepOver, Continue},
+			[]stop{
+				{StopBreakpoint, 6, 1},
+				{StopStep, 7, 1},
+				{StopStep, 8, 1},
+			},
+		},
+		{
+			"step out",
+			[]int{3},
+			false,
+			[]Action{StepOut, Continue, StepOut, StepOver},
+			[]stop{
+				{StopBreakpoint, 3, 2},
+				{StopStep, 6, 1},
+				{StopBreakpoint, 3, 2},
+				{StopStep, 7, 1},
+				{StopStep, 8, 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		stops := debug(t, debuggerInput, tt.breakpoints, tt.entry, tt.actions)
+		if !reflect.DeepEqual(stops, tt.expected) {
+			t.Errorf("%s: wrong stops.\nwant=%v\ngot= %v", tt.name, tt.expected, stops)
+		}
+	}
+}
+
+func TestDebuggerInspection(t *testing.T) {
+	input := `let a = 10;
+let outer = fn(x) {
+    let inner = fn(y) {
+        let sum = x + y;
+        sum
+    };
+    inner(1)
+};
+outer(a);`
+
+	program := parse(input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var backtrace []StackFrame
+	var globals []Binding
+	d := NewDebugger(func(vm *VM, reason StopReason) Action {
+		backtrace = vm.Backtrace()
+		globals = vm.Globals()
+		return Continue
+	})
+	d.SetBreakpoint(5)
+
+	vm := New(comp.Bytecode())
+	vm.SetDebugger(d)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	got := []string{}
+	for _, f := range backtrace {
+		got = append(got, fmt.Sprintf("%s:%d locals=%s free=%s",
+			f.Function, f.Line, bindings(f.Locals), bindings(f.Free)))
+	}
+	expected := []string{
+		"inner:5 locals=[y=1 sum=11] free=[x=10]",
+		"outer:7 locals=[x=10 inner=fn inner(y)] free=[]",
+		"main:9 locals=[] free=[]",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong backtrace.\nwant=%q\ngot= %q", expected, got)
+	}
+
+	if b := bindings(globals); b != "[a=10 outer=fn outer(x)]" {
+		t.Errorf("wrong globals: %s", b)
+	}
+}
+
+func TestDebuggerHidesCompilerSlots(t *testing.T) {
+	input := `let [a, b] = [1, 2];
+let f = fn({k}) {
+    let [x, ...y] = [k, 3];
+    x
+};
+f({"k": 4});`
+
+	program := parse(input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var backtrace []StackFrame
+	var globals []Binding
+	d := NewDebugger(func(vm *VM, reason StopReason) Action {
+		backtrace = vm.Backtrace()
+		globals = vm.Globals()
+		return Continue
+	})
+	d.SetBreakpoint(4)
+
+	vm := New(comp.Bytecode())
+	vm.SetDebugger(d)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if b := bindings(backtrace[0].Locals); b != "[k=4 x=4 y=[3]]" {
+		t.Errorf("wrong locals: %s", b)
+	}
+	if b := bindings(globals); b != "[a=1 b=2 f=fn f({k})]" {
+		t.Errorf("wrong globals: %s", b)
+	}
+}
+
+func TestDebuggerHidesMatchSlots(t *testing.T) {
+	input := `let a = 1;
+let r = match (a) { n if n > 0 => n, _ => 0 };
+let f = fn(x) {
+    match (x) { [m, k] if m < k => m, _ => 0 }
+};
+f([1, 2]);`
+
+	program := parse(input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var locals, globals []Binding
+	d := NewDebugger(func(vm *VM, reason StopReason) Action {
+		locals = vm.Backtrace()[0].Locals
+		globals = vm.Globals()
+		return Continue
+	})
+	d.SetBreakpoint(4)
+
+	vm := New(comp.Bytecode())
+	vm.SetDebugger(d)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if b := bindings(locals); b != "[x=[1, 2]]" {
+		t.Errorf("wrong locals: %s", b)
+	}
+	if b := bindings(globals); b != "[a=1 r=1 n=1 f=fn f(x)]" {
+		t.Errorf("wrong globals: %s", b)
+	}
+}
+
+func bindings(bs []Binding) string {
+	out := []string{}
+	for _, b := range bs {
+		out = append(out, b.Name+"="+b.Value.Inspect())
+	}
+	return "[" + strings.Join(out, " ") + "]"
+}
+
+func TestDebuggerTerminate(t *testing.T) {
+	program := parse("let a = 1;\nlet b = 2;")
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	d := NewDebugger(func(vm *VM, reason StopReason) Action {
+		return Terminate
+	})
+	d.SetBreakpoint(2)
+
+	vm := New(comp.Bytecode())
+	vm.SetDebugger(d)
+	if err := vm.Run(); err != ErrTerminated {
+		t.Fatalf("expected ErrTerminated, got %v", err)
+	}
+	if globals := vm.Globals(); len(globals) != 1 {
+		t.Errorf("expected only a to be assigned, got %v", globals)
+	}
+}
+
+func TestDebuggerPause(t *testing.T) {
+	program := parse("let a = 1;\nlet b = 2;")
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	reasons := []StopReason{}
+	d := NewDebugger(func(vm *VM, reason StopReason) Action {
+		reasons = append(reasons, reason)
+		return Continue
+	})
+	d.Pause()
+
+	vm := New(comp.Bytecode())
+	vm.SetDebugger(d)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if !reflect.DeepEqual(reasons, []StopReason{StopPause}) {
+		t.Errorf("wrong stops: %v", reasons)
+	}
+
+	d.SetBreakpoint(1)
+	d.SetBreakpoint(2)
+	d.ClearBreakpoint(1)
+	if got := d.Breakpoints(); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("wrong breakpoints: %v", got)
+	}
+}
@@ -9,6 +9,11 @@ type Frame struct {
 	cl                 *object.Closure
 	instructionPointer int
 	basePointer        int
+	// numArgs is the number of arguments the call passed.
+	numArgs int
+
+	// line is the last source line the debugger saw this frame execute.
+	line int
 }
 
 func NewFrame(fn *object.Closure, basePointer int) *Frame {
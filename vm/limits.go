@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInstructionLimit is returned by Run when the VM executed more
+// instructions than its Limits allow.
+var ErrInstructionLimit = errors.New("instruction limit exceeded")
+
+// ErrTimeout is returned by Run when the VM ran for longer than its Limits
+// allow.
+var ErrTimeout = errors.New("time limit exceeded")
+
+// Limits bound how much work a single call of Run may do. Zero values
+// mean no limit.
+type Limits struct {
+	MaxInstructions int64
+	Timeout         time.Duration
+}
+
+type limiter struct {
+	Limits
+	executed  int64
+	deadline  time.Time
+	countdown int
+}
+
+// SetLimits makes Run stop with an error when it exceeds l. It must be
+// called before Run.
+func (vm *VM) SetLimits(l Limits) {
+	vm.limiter = &limiter{Limits: l}
+}
+
+func (l *limiter) start() {
+	l.executed = 0
+	l.countdown = sampleCheck
+	if l.Timeout > 0 {
+		l.deadline = time.Now().Add(l.Timeout)
+	}
+}
+
+func (l *limiter) instruction() error {
+	l.executed++
+	if l.MaxInstructions > 0 && l.executed > l.MaxInstructions {
+		return ErrInstructionLimit
+	}
+
+	if l.Timeout > 0 {
+		l.countdown--
+		if l.countdown == 0 {
+			l.countdown = sampleCheck
+			if time.Now().After(l.deadline) {
+				return ErrTimeout
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package vm
+
+import (
+	"errors"
+	"interpreter/compiler"
+	"testing"
+	"time"
+)
+
+func TestLimits(t *testing.T) {
+	// Takes 2^40 calls to finish.
+	loop := `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(40);`
+	// The same, called by a builtin.
+	mapped := `let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; map([40], f);`
+
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected error
+	}{
+		{`1 + 2`, Limits{MaxInstructions: 4}, nil},
+		{`1 + 2`, Limits{MaxInstructions: 3}, ErrInstructionLimit},
+		{loop, Limits{Timeout: 10 * time.Millisecond}, ErrTimeout},
+		{loop, Limits{MaxInstructions: 100000, Timeout: time.Minute}, ErrInstructionLimit},
+		{mapped, Limits{MaxInstructions: 100000}, ErrInstructionLimit},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		comp.SetOptimizations(false)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+		if err := vm.Run(); !errors.Is(err, tt.expected) {
+			t.Errorf("wrong error for %q with %+v. want=%v, got=%v", tt.input, tt.limits, tt.expected, err)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	inputs := []string{
+		`let f = fn() { f() }; f();`,
+		// Runs out of stack for its locals long before MaxFrames.
+		`let f = fn(n) { let a = 1; let b = 2; let c = 3; let d = 4; let e = 5; let g = 6; let h = 7; let i = 8; let j = 9; let k = 10; f(n + 1) }; f(0);`,
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err == nil || err.Error() != "stack overflow" {
+			t.Errorf("wrong error for %q. want=%q, got=%v", input, "stack overflow", err)
+		}
+	}
+}
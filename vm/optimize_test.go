@@ -0,0 +1,96 @@
+package vm
+
+import (
+	"interpreter/compiler"
+	"testing"
+)
+
+func TestOptimizationsPreserveResults(t *testing.T) {
+	inputs := []string{
+		"",
+		"// nothing but a comment",
+		"1 + 2 * 3 - 4 / 2",
+		"-(2 - 5) * -1",
+		"(10 / 3) * 3 + 10 - 10 / 3 * 3",
+		`"mon" + "key"`,
+		"!true; !!5; !\"\"",
+		"1 < 2 == true",
+		"(1 > 2) != (3 > 2)",
+		"true == false",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (2 > 1) { 10 }",
+		"if (false) { 10 }",
+		"if (0) { 1 } else { 2 }",
+		"let x = 5; if (true) { x * (2 + 3) }",
+		"let f = fn(n) { if (1 == 1) { n * (60 / 6) } else { 0 } }; f(4)",
+		"let a = [1 + 1, \"a\" + \"b\"]; a[3 - 2]",
+		"{1 + 1: 2 * 2}[2]",
+		"1 / 0",
+		"1 / (5 - 5)",
+		"-true",
+		`1 + "a"`,
+		`"a" - "b"`,
+		`"a" == "a"`,
+		`let a = "x"; let b = "x"; ["ab" == "a" + "b", "ab" != "a" + "b", a == b, "${a}" == b]`,
+		"true + false",
+		"1 == true",
+		"let f = fn(a, b) { if (a) { if (b) { 1 } else { 2 } } else { 3 } }; [f(true, true), f(true, false), f(false, true)]",
+		"let f = fn(x) { if (x > 1) { return x; 10 } x; 20 }; [f(2), f(0)]",
+		"let g = fn() { }; let f = fn() { 1; 2; g() }; f()",
+		"let fib = fn(x) { if (x < 2) { return x; } fib(x - 1) + fib(x - 2) }; fib(15)",
+		"let adder = fn(a) { fn(b) { if (true) { a + b } } }; adder(2)(3)",
+		"let f = fn() { if (false) { 1 }; }; f()",
+		"let x = 1; x; x; if (x) { 2 }",
+		"let f = fn(a = if (true) { 1 }, b = 2 + 3, ...c) { [a, b, c] }; [f(), f(4), f(4, 5, 6)]",
+		"let f = fn(a, b = a) { if (false) { b } }; f(1)",
+		"let f = fn(a, b) { a + b }; f(...[1 + 1], 3)",
+		"let [a, {b}, ...c] = [1 + 1, {\"b\": 2 * 3}, 4]; [a, b, c]",
+		"let f = fn([a, b] = [1, 2]) { a + b }; [f(), f([3, 4])]",
+		"let f = fn(b, a = match (1) { 1 => 10, _ => 0 }) { [b, a] }; [f(7, 3), f(7)]",
+		"let f = fn(b, [x, y] = match (b) { n => [n, n] }, c = 5) { [b, x, y, c] }; [f(7), f(7, [1, 2], 3)]",
+		"let [a] = 1 + 1; a",
+		"match (1 + 1) { -1 => 0, 2 if !false => 1 + 2, _ => 3 }",
+		"let f = fn(x) { match (x) { [2, y] => y * 2, {\"a\": [b]} => b } }; [f([2, 3]), f({\"a\": [4]})]",
+		"match (3) { x if x < 1 + 1 => x }",
+		`let x = 2; ["${1 + 1}", "${x} ${-x}", "${[1 + 1]}", "${"${true}"}"]`,
+		`let s = "mon" + "key"; [s[1 + 1], s[0:1 + 2], upper(s[3:10]), format("%s-%d", s, 2 * 3)]`,
+		`let a = [1, 2, 3, 4, 5]; [a[-1], a[:2 + 1], a[-2:], a[::1 + 1], a[::-1]]`,
+	}
+
+	for _, input := range inputs {
+		unoptimized, unoptimizedErr := runCompiled(t, input, false)
+		optimized, optimizedErr := runCompiled(t, input, true)
+
+		if unoptimizedErr != optimizedErr {
+			t.Errorf("different errors for %q. unoptimized=%q, optimized=%q", input, unoptimizedErr, optimizedErr)
+			continue
+		}
+		if unoptimized != optimized {
+			t.Errorf("different results for %q. unoptimized=%s, optimized=%s", input, unoptimized, optimized)
+		}
+	}
+}
+
+// runCompiled returns the inspected result of input, or the text of the
+// error or panic that stopped it.
+func runCompiled(t *testing.T, input string, optimize bool) (result string, err string) {
+	t.Helper()
+
+	comp := compiler.New()
+	comp.SetOptimizations(optimize)
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = "panic"
+		}
+	}()
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return "", err.Error()
+	}
+	return vm.LastPoppedStackElem().Inspect(), ""
+}
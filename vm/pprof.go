@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WritePprof writes the sampled call stacks as a gzipped profile.proto
+// message, the format read by `go tool pprof`. Each function of the script
+// becomes a pprof function, each line a location.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	stringTable := []string{""}
+	index := make(map[string]int)
+	str := func(s string) uint64 {
+		if i, ok := index[s]; ok {
+			return uint64(i)
+		}
+		index[s] = len(stringTable)
+		stringTable = append(stringTable, s)
+		return uint64(len(stringTable) - 1)
+	}
+
+	var profile protoBuffer
+
+	valueType := func(field int, typ, unit string) {
+		var vt protoBuffer
+		vt.uint64Field(1, str(typ))
+		vt.uint64Field(2, str(unit))
+		profile.messageField(field, &vt)
+	}
+	valueType(1, "samples", "count")
+	valueType(1, "cpu", "nanoseconds")
+
+	locations := make(map[location]uint64)
+	var locationBuf, functionBuf protoBuffer
+	functions := make(map[*FunctionProfile]bool)
+
+	for _, key := range p.order {
+		s := p.samples[key]
+
+		ids := []uint64{}
+		for _, loc := range s.locations {
+			id, ok := locations[loc]
+			if !ok {
+				id = uint64(len(locations) + 1)
+				locations[loc] = id
+
+				var line protoBuffer
+				line.uint64Field(1, uint64(loc.fn.id))
+				line.int64Field(2, int64(loc.line))
+				var l protoBuffer
+				l.uint64Field(1, id)
+				l.messageField(4, &line)
+				locationBuf.messageField(4, &l)
+			}
+			ids = append(ids, id)
+
+			if !functions[loc.fn] {
+				functions[loc.fn] = true
+				var f protoBuffer
+				f.uint64Field(1, uint64(loc.fn.id))
+				f.uint64Field(2, str(loc.fn.Name))
+				f.uint64Field(3, str(loc.fn.Name))
+				f.uint64Field(4, str(p.Filename))
+				f.int64Field(5, int64(loc.fn.Line))
+				functionBuf.messageField(5, &f)
+			}
+		}
+
+		var sample protoBuffer
+		sample.packedUint64Field(1, ids)
+		sample.packedInt64Field(2, []int64{s.count, s.elapsed.Nanoseconds()})
+		profile.messageField(2, &sample)
+	}
+
+	profile.data = append(profile.data, locationBuf.data...)
+	profile.data = append(profile.data, functionBuf.data...)
+
+	// The string table is written last because the fields above add to it.
+	for _, s := range stringTable {
+		profile.stringField(6, s)
+	}
+	profile.int64Field(9, p.started.UnixNano())
+	profile.int64Field(10, p.duration.Nanoseconds())
+	var period protoBuffer
+	period.uint64Field(1, str("cpu"))
+	period.uint64Field(2, str("nanoseconds"))
+	profile.messageField(11, &period)
+	profile.int64Field(12, p.interval.Nanoseconds())
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(profile.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes the protocol buffer wire format.
+type protoBuffer struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64Field(field int, x int64) {
+	b.uint64Field(field, uint64(x))
+}
+
+func (b *protoBuffer) stringField(field int, s string) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protoBuffer) messageField(field int, m *protoBuffer) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(m.data)))
+	b.data = append(b.data, m.data...)
+}
+
+func (b *protoBuffer) packedUint64Field(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.messageField(field, &packed)
+}
+
+func (b *protoBuffer) packedInt64Field(field int, xs []int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	b.messageField(field, &packed)
+}
@@ -0,0 +1,258 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/code"
+	"interpreter/object"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultSampleInterval is how often a Profiler samples the call stack
+// unless told otherwise.
+const DefaultSampleInterval = time.Millisecond
+
+// sampleCheck is how many instructions run between looks at the clock.
+const sampleCheck = 256
+
+// Profiler records how a VM spends its time. Every call and instruction is
+// instrumented to count calls, opcodes and the time spent in each function,
+// and the call stack is sampled periodically for pprof.
+type Profiler struct {
+	// Filename is reported as the source file of every function in pprof
+	// output.
+	Filename string
+
+	interval   time.Duration
+	countdown  int
+	lastSample time.Time
+
+	functions map[interface{}]*FunctionProfile
+	opcodes   [256]int64
+	stack     []activation
+	samples   map[string]*sample
+	order     []string
+
+	started  time.Time
+	duration time.Duration
+}
+
+type FunctionProfile struct {
+	Name string
+	// Line is the first line of the function's body, 0 for builtins.
+	Line int
+	// Calls counts calls, including recursive ones.
+	Calls int64
+	// Inclusive is the time spent in the function and its callees.
+	// Recursive calls are only counted once.
+	Inclusive time.Duration
+	// Exclusive is the time spent in the function itself.
+	Exclusive time.Duration
+
+	id     int
+	active int
+}
+
+type OpcodeCount struct {
+	Opcode code.Opcode
+	Count  int64
+}
+
+// activation is a function call in progress. frame is the index of the
+// VM frame of a closure call, and -1 for a builtin, which has none.
+type activation struct {
+	fn       *FunctionProfile
+	frame    int
+	start    time.Time
+	children time.Duration
+}
+
+// sample is a call stack seen while sampling, innermost first, with the
+// time since the previous sample.
+type sample struct {
+	locations []location
+	count     int64
+	elapsed   time.Duration
+}
+
+type location struct {
+	fn   *FunctionProfile
+	line int
+}
+
+// NewProfiler returns a profiler that samples every interval. An interval
+// of zero disables sampling.
+func NewProfiler(interval time.Duration) *Profiler {
+	return &Profiler{
+		interval:  interval,
+		functions: make(map[interface{}]*FunctionProfile),
+		samples:   make(map[string]*sample),
+	}
+}
+
+// SetProfiler attaches p to the VM. It must be called before Run.
+func (vm *VM) SetProfiler(p *Profiler) {
+	vm.profiler = p
+}
+
+func (p *Profiler) start(vm *VM) {
+	p.started = time.Now()
+	p.lastSample = p.started
+	p.countdown = sampleCheck
+	p.enter(vm.frames[0].cl.Fn, "main", 0, 0)
+}
+
+// stop ends the profile, closing the calls still in progress when Run
+// returned early with an error.
+func (p *Profiler) stop() {
+	for len(p.stack) > 0 {
+		p.exit()
+	}
+	p.duration += time.Since(p.started)
+}
+
+func (p *Profiler) function(key interface{}, name string, line int) *FunctionProfile {
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &FunctionProfile{Name: name, Line: line, id: len(p.functions) + 1}
+		p.functions[key] = fn
+	}
+	return fn
+}
+
+func (p *Profiler) enter(key interface{}, name string, line int, frame int) {
+	fn := p.function(key, name, line)
+	fn.Calls++
+	fn.active++
+	p.stack = append(p.stack, activation{fn: fn, frame: frame, start: time.Now()})
+}
+
+func (p *Profiler) exit() {
+	a := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+
+	elapsed := time.Since(a.start)
+	a.fn.Exclusive += elapsed - a.children
+	a.fn.active--
+	if a.fn.active == 0 {
+		a.fn.Inclusive += elapsed
+	}
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+func (p *Profiler) enterClosure(vm *VM, fn *object.CompiledFunction) {
+	line := fn.Pos.Line
+	if line == 0 && len(fn.Lines) > 0 {
+		line = fn.Lines[0].Line
+	}
+	p.enter(fn, vm.functionName(fn), line, vm.framesIndex-1)
+}
+
+func (p *Profiler) enterBuiltin(builtin *object.Builtin) {
+	name := object.BuiltinName(builtin)
+	if name == "" {
+		name = "<builtin>"
+	}
+	p.enter(builtin, name, 0, -1)
+}
+
+func (p *Profiler) instruction(vm *VM, op code.Opcode) {
+	p.opcodes[op]++
+
+	p.countdown--
+	if p.countdown > 0 || p.interval == 0 {
+		return
+	}
+	p.countdown = sampleCheck
+	if now := time.Now(); now.Sub(p.lastSample) >= p.interval {
+		p.sample(vm, now.Sub(p.lastSample))
+		p.lastSample = now
+	}
+}
+
+// sample records the current call stack. Closure calls take their line
+// from their VM frame; builtins, which have no frame, are listed without
+// one, between the caller and the closures they call back.
+func (p *Profiler) sample(vm *VM, elapsed time.Duration) {
+	locations := []location{}
+	var key strings.Builder
+	for i := len(p.stack) - 1; i >= 0; i-- {
+		a := p.stack[i]
+		loc := location{fn: a.fn}
+		if a.frame >= 0 {
+			frame := vm.frames[a.frame]
+			ip := frame.instructionPointer
+			if ip < 0 {
+				ip = 0
+			}
+			loc.line = frame.cl.Fn.Lines.Line(ip)
+		}
+		locations = append(locations, loc)
+		fmt.Fprintf(&key, "%d:%d;", loc.fn.id, loc.line)
+	}
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &sample{locations: locations}
+		p.samples[key.String()] = s
+		p.order = append(p.order, key.String())
+	}
+	s.count++
+	s.elapsed += elapsed
+}
+
+// Functions returns the profiled functions, most exclusive time first.
+func (p *Profiler) Functions() []*FunctionProfile {
+	fns := []*FunctionProfile{}
+	for _, fn := range p.functions {
+		fns = append(fns, fn)
+	}
+	sort.Slice(fns, func(i, j int) bool {
+		if fns[i].Exclusive != fns[j].Exclusive {
+			return fns[i].Exclusive > fns[j].Exclusive
+		}
+		return fns[i].id < fns[j].id
+	})
+	return fns
+}
+
+// Opcodes returns how often each opcode ran, most frequent first.
+func (p *Profiler) Opcodes() []OpcodeCount {
+	counts := []OpcodeCount{}
+	for op, n := range p.opcodes {
+		if n > 0 {
+			counts = append(counts, OpcodeCount{Opcode: code.Opcode(op), Count: n})
+		}
+	}
+	sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts
+}
+
+// WriteReport writes the function and opcode tables as text.
+func (p *Profiler) WriteReport(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Function\tLine\tCalls\tInclusive\tExclusive\t\n")
+	for _, fn := range p.Functions() {
+		line := "-"
+		if fn.Line > 0 {
+			line = fmt.Sprint(fn.Line)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t\n", fn.Name, line, fn.Calls,
+			fn.Inclusive.Round(time.Microsecond), fn.Exclusive.Round(time.Microsecond))
+	}
+	fmt.Fprintf(tw, "\t\t\t\t\t\n")
+	fmt.Fprintf(tw, "Opcode\tCount\t\t\t\t\n")
+	for _, c := range p.Opcodes() {
+		name := fmt.Sprintf("Opcode(%d)", c.Opcode)
+		if def, err := code.Lookup(byte(c.Opcode)); err == nil {
+			name = def.Name
+		}
+		fmt.Fprintf(tw, "%s\t%d\t\t\t\t\n", name, c.Count)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,211 @@
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"interpreter/code"
+	"interpreter/compiler"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func profile(t *testing.T, input string, interval time.Duration) (*Profiler, error) {
+	program := parse(input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	p := NewProfiler(interval)
+	p.Filename = "test.monkey"
+	vm := New(comp.Bytecode())
+	vm.SetProfiler(p)
+	return p, vm.Run()
+}
+
+const profilerInput = `let fibonacci = fn(x) {
+    if (x < 2) { return x; }
+    fibonacci(x - 1) + fibonacci(x - 2)
+};
+let size = fn(a) { len(a) };
+size([1, 2]);
+fibonacci(10);`
+
+func TestProfilerCounts(t *testing.T) {
+	p, err := profile(t, profilerInput, 0)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	calls := make(map[string]int64)
+	for _, fn := range p.Functions() {
+		calls[fn.Name] = fn.Calls
+		if fn.Exclusive > fn.Inclusive {
+			t.Errorf("%s: exclusive time %s exceeds inclusive time %s", fn.Name, fn.Exclusive, fn.Inclusive)
+		}
+	}
+
+	expected := map[string]int64{"main": 1, "fibonacci": 177, "size": 1, "len": 1}
+	for name, want := range expected {
+		if calls[name] != want {
+			t.Errorf("wrong number of calls to %s. want=%d, got=%d", name, want, calls[name])
+		}
+	}
+	if len(calls) != len(expected) {
+		t.Errorf("wrong functions: %v", calls)
+	}
+
+	counts := make(map[code.Opcode]int64)
+	for _, c := range p.Opcodes() {
+		counts[c.Opcode] = c.Count
+	}
+	// Every call but the one to len runs OpCall, and every closure call
+	// returns through OpReturnValue.
+	if counts[code.OpCall] != 179 {
+		t.Errorf("wrong OpCall count. want=179, got=%d", counts[code.OpCall])
+	}
+	if counts[code.OpReturnValue] != 178 {
+		t.Errorf("wrong OpReturnValue count. want=178, got=%d", counts[code.OpReturnValue])
+	}
+
+	var report bytes.Buffer
+	if err := p.WriteReport(&report); err != nil {
+		t.Fatalf("WriteReport returned error: %s", err)
+	}
+	for _, want := range []string{"Function", "fibonacci", "177", "OpCall", "179"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, report.String())
+		}
+	}
+}
+
+func TestProfilerSamplesCallbacks(t *testing.T) {
+	input := `let work = fn(x) { x * 2 + 1 };
+let outer = fn() {
+  map(range(3000), work)
+};
+outer();`
+
+	p, err := profile(t, input, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// The builtin map has no VM frame, so the frames of the closures it
+	// calls must still be matched with their own activations.
+	expected := "work:1 map:0 outer:3 main:5"
+	found := false
+	for _, key := range p.order {
+		stack := []string{}
+		for _, loc := range p.samples[key].locations {
+			stack = append(stack, fmt.Sprintf("%s:%d", loc.fn.Name, loc.line))
+		}
+		found = found || strings.Join(stack, " ") == expected
+	}
+	if !found {
+		t.Errorf("no sample of %q", expected)
+	}
+}
+
+func TestProfilerUnwindsOnError(t *testing.T) {
+	input := `let f = fn() { 1 + true };
+let g = fn() { f() };
+g();`
+
+	p, err := profile(t, input, 0)
+	if err == nil {
+		t.Fatalf("expected vm error")
+	}
+	if len(p.stack) != 0 {
+		t.Fatalf("calls left open: %d", len(p.stack))
+	}
+	for _, fn := range p.Functions() {
+		if fn.Inclusive == 0 && fn.Calls > 0 {
+			t.Errorf("%s has calls but no inclusive time", fn.Name)
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p, err := profile(t, profilerInput, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatalf("WritePprof returned error: %s", err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("profile is not gzipped: %s", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("reading profile: %s", err)
+	}
+
+	fields := decodeProto(t, data)
+	if len(fields[2]) == 0 {
+		t.Errorf("profile has no samples")
+	}
+	if len(fields[4]) == 0 || len(fields[5]) == 0 {
+		t.Errorf("profile has no locations or functions")
+	}
+
+	stringTable := []string{}
+	for _, s := range fields[6] {
+		stringTable = append(stringTable, string(s))
+	}
+	if stringTable[0] != "" {
+		t.Errorf("first string must be empty, got %q", stringTable[0])
+	}
+	for _, want := range []string{"samples", "count", "cpu", "nanoseconds", "main", "fibonacci", "test.monkey"} {
+		found := false
+		for _, s := range stringTable {
+			found = found || s == want
+		}
+		if !found {
+			t.Errorf("string table does not contain %q: %q", want, stringTable)
+		}
+	}
+}
+
+// decodeProto splits a protocol buffer message into its length-delimited
+// fields; varint fields are skipped.
+func decodeProto(t *testing.T, data []byte) map[int][][]byte {
+	varint := func() uint64 {
+		var x uint64
+		for shift := 0; ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatalf("truncated varint")
+			}
+			b := data[0]
+			data = data[1:]
+			x |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return x
+			}
+		}
+	}
+
+	fields := make(map[int][][]byte)
+	for len(data) > 0 {
+		key := varint()
+		switch key & 7 {
+		case wireVarint:
+			varint()
+		case wireBytes:
+			n := varint()
+			fields[int(key>>3)] = append(fields[int(key>>3)], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"interpreter/code"
+	"interpreter/object"
+)
+
+// Tracer observes a running VM. Its methods are called synchronously from
+// Run, so they see the VM between instructions and must not retain args,
+// which alias the VM's stack.
+type Tracer interface {
+	// Instruction is called before the instruction at ip in the current
+	// frame is executed.
+	Instruction(vm *VM, ip int, op code.Opcode)
+	// Enter is called when a closure has been called, after its frame has
+	// been pushed.
+	Enter(vm *VM, cl *object.Closure, args []object.Object)
+	// Exit is called when a closure returns, after its frame has been
+	// popped.
+	Exit(vm *VM, cl *object.Closure, result object.Object)
+	// Builtin is called after a builtin function returned. result is nil
+	// when the builtin returned nothing.
+	Builtin(vm *VM, builtin *object.Builtin, args []object.Object, result object.Object)
+	// Error is called with the error that stopped Run.
+	Error(vm *VM, err error)
+}
+
+// SetTracer attaches t to the VM. It must be called before Run; a nil t
+// turns tracing off.
+func (vm *VM) SetTracer(t Tracer) {
+	vm.tracer = t
+}
@@ -0,0 +1,163 @@
+package vm
+
+import (
+	"fmt"
+	"interpreter/code"
+	"interpreter/compiler"
+	"interpreter/object"
+	"strings"
+	"testing"
+)
+
+type recordingTracer struct {
+	events       []string
+	instructions int
+}
+
+func (r *recordingTracer) Instruction(vm *VM, ip int, op code.Opcode) {
+	r.instructions++
+}
+
+func (r *recordingTracer) Enter(vm *VM, cl *object.Closure, args []object.Object) {
+	r.events = append(r.events, fmt.Sprintf("enter %s(%s)", vm.functionName(cl.Fn), inspectAll(args)))
+}
+
+func (r *recordingTracer) Exit(vm *VM, cl *object.Closure, result object.Object) {
+	r.events = append(r.events, fmt.Sprintf("exit %s = %s", vm.functionName(cl.Fn), result.Inspect()))
+}
+
+func (r *recordingTracer) Builtin(vm *VM, builtin *object.Builtin, args []object.Object, result object.Object) {
+	r.events = append(r.events, fmt.Sprintf("builtin(%s) = %s", inspectAll(args), result.Inspect()))
+}
+
+func (r *recordingTracer) Error(vm *VM, err error) {
+	r.events = append(r.events, "error "+err.Error())
+}
+
+func inspectAll(objs []object.Object) string {
+	var out []string
+	for _, o := range objs {
+		out = append(out, o.Inspect())
+	}
+	return strings.Join(out, ", ")
+}
+
+func trace(t *testing.T, input string) (*recordingTracer, error) {
+	t.Helper()
+	comp := compiler.New()
+	comp.SetOptimizations(false)
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	tracer := &recordingTracer{}
+	vm := New(comp.Bytecode())
+	vm.SetTracer(tracer)
+	return tracer, vm.Run()
+}
+
+func TestTracer(t *testing.T) {
+	tests := []struct {
+		input  string
+		events []string
+	}{
+		{
+			`let add = fn(a, b) { a + b };
+add(1, add(2, 3));`,
+			[]string{
+				"enter add(2, 3)",
+				"exit add = 5",
+				"enter add(1, 5)",
+				"exit add = 6",
+			},
+		},
+		{
+			`let f = fn(x) {
+  len(x);
+};
+f("abc");
+fn() { }();`,
+			[]string{
+				"enter f(abc)",
+				"builtin(abc) = 3",
+				"exit f = 3",
+				"enter fn@5()",
+				"exit fn@5 = null",
+			},
+		},
+		{
+			`let f = fn(x) {
+  x + true;
+};
+f(1);`,
+			[]string{
+				"enter f(1)",
+				"error unsupported types for binary operation: INTEGER BOOLEAN",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tracer, _ := trace(t, tt.input)
+		if got := strings.Join(tracer.events, "\n"); got != strings.Join(tt.events, "\n") {
+			t.Errorf("wrong events for %q.\nwant=\n%s\ngot=\n%s", tt.input, strings.Join(tt.events, "\n"), got)
+		}
+		if tracer.instructions == 0 {
+			t.Errorf("no instructions traced for %q", tt.input)
+		}
+	}
+}
+
+func TestTracerInstructions(t *testing.T) {
+	tracer, err := trace(t, `1 + 2;`)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// OpConstant, OpConstant, OpAdd, OpPop
+	if tracer.instructions != 4 {
+		t.Errorf("wrong number of instructions. want=%d, got=%d", 4, tracer.instructions)
+	}
+}
+
+const benchmarkInput = `
+let fibonacci = fn(x) {
+  if (x < 2) { return x; }
+  fibonacci(x - 1) + fibonacci(x - 2);
+};
+fibonacci(20);
+`
+
+type nopTracer struct{}
+
+func (nopTracer) Instruction(vm *VM, ip int, op code.Opcode)                   {}
+func (nopTracer) Enter(vm *VM, cl *object.Closure, args []object.Object)       {}
+func (nopTracer) Exit(vm *VM, cl *object.Closure, result object.Object)        {}
+func (nopTracer) Builtin(*VM, *object.Builtin, []object.Object, object.Object) {}
+func (nopTracer) Error(vm *VM, err error)                                      {}
+
+func benchmarkRun(b *testing.B, tracer Tracer) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(benchmarkInput)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := New(bytecode)
+		if tracer != nil {
+			vm.SetTracer(tracer)
+		}
+		if err := vm.Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	benchmarkRun(b, nil)
+}
+
+func BenchmarkRunTraced(b *testing.B) {
+	benchmarkRun(b, nopTracer{})
+}
@@ -1,18 +1,20 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
 	"interpreter/code"
 	"interpreter/compiler"
 	"interpreter/object"
+	"strings"
 )
 
 const StackSize = 2048
 const GlobalsSize = 65536
 const MaxFrames = 1024
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
+var True = object.True
+var False = object.False
 var Null = &object.Null{}
 
 type VM struct {
@@ -25,10 +27,22 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	// callErr is the error a call made by a builtin failed with. It ends
+	// the run once the builtin returns, as the failed call is left on the
+	// stack.
+	callErr error
+
+	globalNames []string
+	host        *object.Host
+	debugger    *Debugger
+	profiler    *Profiler
+	tracer      Tracer
+	limiter     *limiter
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Lines: bytecode.Lines}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 	frames := make([]*Frame, MaxFrames)
@@ -41,6 +55,7 @@ func New(bytecode *compiler.Bytecode) *VM {
 		globals:     make([]object.Object, GlobalsSize),
 		frames:      frames,
 		framesIndex: 1,
+		globalNames: bytecode.GlobalNames,
 	}
 }
 
@@ -64,6 +79,23 @@ func (vm *VM) popFrame() *Frame {
 	return vm.frames[vm.framesIndex]
 }
 
+// functionName names fn in backtraces and profiles. Functions bound by let
+// go by their name, anonymous ones are named after the line they are
+// declared on, as in fn@3.
+func (vm *VM) functionName(fn *object.CompiledFunction) string {
+	switch {
+	case fn == vm.frames[0].cl.Fn:
+		return "main"
+	case fn.Name != "":
+		return fn.Name
+	case fn.Pos.IsValid():
+		return fmt.Sprintf("fn@%d", fn.Pos.Line)
+	case len(fn.Lines) > 0:
+		return fmt.Sprintf("fn@%d", fn.Lines[0].Line)
+	}
+	return "fn"
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -93,18 +125,89 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
-func (vm *VM) Run() error {
+func (vm *VM) Run() (err error) {
+	if vm.tracer != nil {
+		defer func() {
+			if err != nil {
+				vm.tracer.Error(vm, err)
+			}
+		}()
+	}
+
+	if vm.profiler != nil {
+		vm.profiler.start(vm)
+		defer vm.profiler.stop()
+	}
+	if vm.limiter != nil {
+		vm.limiter.start()
+	}
+
+	err = vm.run(0)
+	if err != nil && err != ErrTerminated {
+		err = &RuntimeError{Err: err, Trace: vm.trace()}
+	}
+	return err
+}
+
+// RuntimeError is an error that stopped a program, with the functions that
+// were running when it did.
+type RuntimeError struct {
+	Err error
+	// Trace lists the running functions, innermost first.
+	Trace []object.Frame
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// trace names the active frames and the lines they have reached,
+// innermost first.
+func (vm *VM) trace() []object.Frame {
+	frames := []object.Frame{}
+	for _, f := range vm.Backtrace() {
+		frames = append(frames, object.Frame{Function: f.Function, Line: f.Line})
+	}
+	return frames
+}
+
+// run executes instructions until the frame below depth returns, or until
+// the main function ends when depth is 0.
+func (vm *VM) run(depth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().instructionPointer < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > depth &&
+		vm.currentFrame().instructionPointer < len(vm.currentFrame().Instructions())-1 {
 		vm.currentFrame().instructionPointer++
 
 		ip = vm.currentFrame().instructionPointer
 		ins = vm.currentFrame().Instructions()
 
+		if vm.debugger != nil {
+			if err := vm.debugger.instruction(vm); err != nil {
+				return err
+			}
+		}
+		if vm.limiter != nil {
+			if err := vm.limiter.instruction(); err != nil {
+				return err
+			}
+		}
+
 		op = code.Opcode(ins[ip])
+		if vm.profiler != nil {
+			vm.profiler.instruction(vm, op)
+		}
+		if vm.tracer != nil {
+			vm.tracer.Instruction(vm, ip, op)
+		}
+
 		switch op {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[ip+1:])
@@ -113,6 +216,13 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpConstantWide:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			vm.currentFrame().instructionPointer += 4
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
 			err := vm.excuteBinaryOperation(op)
 			if err != nil {
@@ -155,6 +265,13 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().instructionPointer = pos - 1
 			}
+		case code.OpJumpIfArgument:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			param := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().instructionPointer += 4
+			if param < vm.currentFrame().numArgs {
+				vm.currentFrame().instructionPointer = pos - 1
+			}
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -192,6 +309,18 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpConcat:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().instructionPointer += 2
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(object.ToString(part))
+			}
+			vm.sp = vm.sp - numParts
+			err := vm.push(&object.String{Value: out.String()})
+			if err != nil {
+				return err
+			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
@@ -199,6 +328,15 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSlice:
+			step := vm.pop()
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+			err := vm.executeSliceExpression(left, start, end, step)
+			if err != nil {
+				return err
+			}
 		case code.OpCall:
 			numArgs := int(code.ReadUint8(ins[ip+1:]))
 			vm.currentFrame().instructionPointer += 1
@@ -206,9 +344,95 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpExtend:
+			spread := vm.pop()
+			array, ok := spread.(*object.Array)
+			if !ok {
+				return fmt.Errorf("cannot spread %s, want=ARRAY", spread.Type())
+			}
+			args := vm.stack[vm.sp-1].(*object.Array)
+			args.Elements = append(args.Elements, array.Elements...)
+		case code.OpDestructureArray:
+			if value := vm.stack[vm.sp-1]; value.Type() != object.ARRAY_OBJ {
+				return fmt.Errorf("cannot destructure %s, want=ARRAY", value.Type())
+			}
+		case code.OpDestructureHash:
+			if value := vm.stack[vm.sp-1]; value.Type() != object.HASH_OBJ {
+				return fmt.Errorf("cannot destructure %s, want=HASH", value.Type())
+			}
+		case code.OpArrayRest:
+			from := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().instructionPointer += 2
+			array := vm.pop().(*object.Array)
+			rest := []object.Object{}
+			if from < len(array.Elements) {
+				rest = append(rest, array.Elements[from:]...)
+			}
+			err := vm.push(&object.Array{Elements: rest})
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			atLeast := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().instructionPointer += 3
+			array, ok := vm.pop().(*object.Array)
+			matched := ok && (len(array.Elements) == length ||
+				atLeast && len(array.Elements) > length)
+			err := vm.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().instructionPointer += 2
+			matched, err := vm.matchHash(vm.stack[vm.sp-numKeys-1], vm.stack[vm.sp-numKeys:vm.sp])
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numKeys - 1
+			err = vm.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchValue:
+			right := vm.pop()
+			left := vm.pop()
+			err := vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
+			if err != nil {
+				return err
+			}
+		case code.OpNoMatch:
+			value := vm.pop()
+			return fmt.Errorf("no match for %s %s", value.Type(), value.Inspect())
+		case code.OpCallSpread:
+			args := vm.pop().(*object.Array)
+			for _, arg := range args.Elements {
+				err := vm.push(arg)
+				if err != nil {
+					return err
+				}
+			}
+			err := vm.executeCall(len(args.Elements))
+			if err != nil {
+				return err
+			}
+		case code.OpCallWide:
+			numArgs := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().instructionPointer += 2
+			err := vm.executeCall(numArgs)
+			if err != nil {
+				return err
+			}
 		case code.OpReturnValue:
 			returnValue := vm.pop()
 			frame := vm.popFrame()
+			if vm.profiler != nil {
+				vm.profiler.exit()
+			}
+			if vm.tracer != nil {
+				vm.tracer.Exit(vm, frame.cl, returnValue)
+			}
 			vm.sp = frame.basePointer - 1
 			err := vm.push(returnValue)
 			if err != nil {
@@ -216,6 +440,12 @@ func (vm *VM) Run() error {
 			}
 		case code.OpReturn:
 			frame := vm.popFrame()
+			if vm.profiler != nil {
+				vm.profiler.exit()
+			}
+			if vm.tracer != nil {
+				vm.tracer.Exit(vm, frame.cl, Null)
+			}
 			vm.sp = frame.basePointer - 1
 			err := vm.push(Null)
 			if err != nil {
@@ -226,6 +456,11 @@ func (vm *VM) Run() error {
 			vm.currentFrame().instructionPointer += 1
 			frame := vm.currentFrame()
 			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case code.OpSetLocalWide:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().instructionPointer += 2
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().instructionPointer += 1
@@ -234,6 +469,14 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetLocalWide:
+			localIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().instructionPointer += 2
+			frame := vm.currentFrame()
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().instructionPointer += 1
@@ -242,6 +485,14 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetBuiltinWide:
+			builtinIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().instructionPointer += 2
+			definition := object.Builtins[builtinIndex]
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
 		case code.OpClosure:
 			constIndex := code.ReadUint16(ins[ip+1:])
 			numFree := code.ReadUint8(ins[ip+3:])
@@ -250,6 +501,14 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpClosureWide:
+			constIndex := code.ReadUint32(ins[ip+1:])
+			numFree := code.ReadUint16(ins[ip+5:])
+			vm.currentFrame().instructionPointer += 6
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
 		case code.OpGetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().instructionPointer += 1
@@ -258,6 +517,14 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpGetFreeWide:
+			freeIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().instructionPointer += 2
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure)
@@ -272,7 +539,23 @@ func (vm *VM) Run() error {
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	if vm.profiler != nil {
+		vm.profiler.enterBuiltin(builtin)
+	}
+	result := builtin.Fn(vm, args...)
+	if vm.profiler != nil {
+		vm.profiler.exit()
+	}
+	if err := vm.callErr; err != nil {
+		vm.callErr = nil
+		return err
+	}
+	if vm.tracer != nil {
+		vm.tracer.Builtin(vm, builtin, args, result)
+	}
+	if err, ok := result.(*object.Error); ok && err.Fatal {
+		return errors.New(err.Message)
+	}
 	vm.sp = vm.sp - numArgs - 1
 	if result != nil {
 		vm.push(result)
@@ -282,14 +565,84 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// Call calls fn with args from a builtin, running it on the same stack as
+// the builtin until it returns. The VM is the object.Context of the
+// builtins it calls.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		depth := vm.framesIndex
+		err = vm.executeCall(len(args))
+		if err == nil && vm.framesIndex > depth {
+			err = vm.run(depth)
+		}
+	}
+	if err != nil {
+		vm.callErr = err
+		return &object.Error{Message: err.Error(), Fatal: true}
+	}
+	return vm.pop()
+}
+
+// Errorf stops the VM with an error once the builtin calling it returns.
+func (vm *VM) Errorf(format string, a ...interface{}) *object.Error {
+	err := fmt.Errorf(format, a...)
+	vm.callErr = err
+	return &object.Error{Message: err.Error(), Fatal: true}
+}
+
+// SetHost gives builtins the services of host, such as where puts writes.
+func (vm *VM) SetHost(host *object.Host) {
+	vm.host = host
+}
+
+func (vm *VM) Host() *object.Host {
+	return vm.host
+}
+
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	fn := cl.Fn
+	if arity := fn.Arity(); !arity.Accepts(numArgs) {
+		return errors.New(object.ArityError(fn.Signature(), arity, numArgs))
+	}
+	if vm.framesIndex >= MaxFrames || vm.sp-numArgs+fn.NumLocals > StackSize {
+		return fmt.Errorf("stack overflow")
 	}
 	frame := NewFrame(cl, vm.sp-numArgs)
+	frame.numArgs = numArgs
 	vm.pushFrame(frame)
+	if vm.profiler != nil {
+		vm.profiler.enterClosure(vm, cl.Fn)
+	}
+	if vm.tracer != nil {
+		vm.tracer.Enter(vm, cl, vm.stack[frame.basePointer:frame.basePointer+numArgs])
+	}
+
+	// The rest parameter takes the arguments past the others.
+	passed := numArgs
+	var rest *object.Array
+	if fn.Variadic {
+		passed = fn.NumParameters - 1
+		rest = &object.Array{Elements: []object.Object{}}
+		if numArgs > passed {
+			rest.Elements = append(rest.Elements, vm.stack[frame.basePointer+passed:vm.sp]...)
+		} else {
+			passed = numArgs
+		}
+	}
 
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	vm.sp = frame.basePointer + fn.NumLocals
+	for i := frame.basePointer + passed; i < vm.sp; i++ {
+		vm.stack[i] = nil
+	}
+	if rest != nil {
+		vm.stack[frame.basePointer+fn.NumParameters-1] = rest
+	}
 	return nil
 }
 
@@ -342,6 +695,24 @@ func (vm *VM) excuteBinaryIntegerOperation(op code.Opcode, left, right object.Ob
 	return vm.push(&object.Integer{Value: result})
 }
 
+// matchHash reports whether value is a hash holding all of keys.
+func (vm *VM) matchHash(value object.Object, keys []object.Object) (bool, error) {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return false, nil
+	}
+	for _, key := range keys {
+		hashKey, ok := key.(object.HashTable)
+		if !ok {
+			return false, fmt.Errorf("unusable as hash key: %T", key)
+		}
+		if _, ok := hash.Pairs[hashKey.Hashkey()]; !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 func (vm *VM) excuteComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -349,6 +720,9 @@ func (vm *VM) excuteComparison(op code.Opcode) error {
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
 
 	switch op {
 	case code.OpEqual:
@@ -376,6 +750,22 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 	}
 }
 
+// executeStringComparison compares strings by value, as the same string
+// may be held by different objects.
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightVal == leftVal))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightVal != leftVal))
+	default:
+		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -450,6 +840,8 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -462,6 +854,9 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	idx := index.(*object.Integer).Value
 	max := int64(len(arrayObject.Elements) - 1)
 
+	if idx < 0 {
+		idx += max + 1
+	}
 	if idx < 0 || idx > max {
 		return vm.push(Null)
 	}
@@ -469,6 +864,28 @@ func (vm *VM) executeArrayIndex(array, index object.Object) error {
 	return vm.push(arrayObject.Elements[idx])
 }
 
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	value := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 {
+		idx += int64(len(value))
+	}
+	if idx < 0 || idx >= int64(len(value)) {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(value[idx])})
+}
+
+func (vm *VM) executeSliceExpression(left, start, end, step object.Object) error {
+	result := object.Slice(left, start, end, step)
+	if err, ok := result.(*object.Error); ok {
+		return errors.New(err.Message)
+	}
+	return vm.push(result)
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
 	hashKey, ok := index.(object.HashTable)
@@ -1,12 +1,15 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
 	"interpreter/ast"
 	"interpreter/compiler"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -99,6 +102,24 @@ func TestStringExpressions(t *testing.T) {
 		{`"foo"`, "foo"},
 		{`"foo" + "bar"`, "foobar"},
 		{`"foo" + "bar" + "bazz"`, "foobarbazz"},
+		// Strings are equal by value, whether or not their constants are
+		// shared.
+		{`let a = "x"; let b = "x"; a == b`, true},
+		{`let a = "x"; a == str("x")`, true},
+		{`let a = "x"; a != upper("x")`, true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{`let name = "Al"; let age = 30; "Hello ${name}, you are ${age + 1}"`, "Hello Al, you are 31"},
+		{`"${1}${2}"`, "12"},
+		{`"${"a"} ${true} ${[1, "b"]} ${{"k": 2}} ${if (false) { 1 }}"`, "a true [1, b] {k: 2} null"},
+		{`let f = fn(x) { "<${x}>" }; "${f(f(1))}!"`, "<<1>>!"},
+		{`let x = 1; "a ${"b ${x + 1}"} c"`, "a b 2 c"},
+		{`let f = fn(n) { fn() { "${n}" } }; f(7)()`, "7"},
+		{`let x = ""; "${x}"`, ""},
 	}
 	runVmTests(t, tests)
 }
@@ -134,13 +155,79 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1, 1, 1]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1, 2, 3][99]", Null},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", Null},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`"abc"[3]`, Null},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-4]`, Null},
 	}
 	runVmTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[0:5]`, "hello"},
+		{`"hello"[3:99]`, "lo"},
+		{`"hello"[4:2]`, ""},
+		{`let s = "hello"; s[1:len(s) - 1]`, "ell"},
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3][-5:1]", []int{1}},
+		{"[1, 2, 3][2:2]", []int{}},
+		{"let a = [1, 2, 3]; let b = a[0:2]; push(b, 4); a", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][1:]", []int{2, 3, 4}},
+		{"[1, 2, 3, 4][:-1]", []int{1, 2, 3}},
+		{"[1, 2, 3, 4][:]", []int{1, 2, 3, 4}},
+		{"[1, 2, 3, 4, 5][::2]", []int{1, 3, 5}},
+		{"[1, 2, 3, 4, 5][1:4:2]", []int{2, 4}},
+		{"[1, 2, 3, 4][::-1]", []int{4, 3, 2, 1}},
+		{"[1, 2, 3, 4, 5][-2::-2]", []int{4, 2}},
+		{"[1, 2, 3, 4][3:0:-1]", []int{4, 3, 2}},
+		{"[1, 2, 3][-99:99]", []int{1, 2, 3}},
+		{"[1, 2, 3][0::9223372036854775807]", []int{1}},
+		{"[1, 2, 3][::-9223372036854775807 - 1]", []int{3}},
+		{"[1, 2, 3][2:0:-9223372036854775807 - 1]", []int{3}},
+		{`"abc"[1::9223372036854775807]`, "b"},
+		{`"hello"[-3:]`, "llo"},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[::-1]`, "olléh"},
+		{`"hello"[::-1]`, "olleh"},
+		{`slice([1, 2, 3, 4], -2)`, []int{3, 4}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestSliceErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"1[0:1]", "slice operator not supported: INTEGER"},
+		{`"abc"[0:"b"]`, "slice bounds must be INTEGER, got STRING"},
+		{`"abc"[::0]`, "slice step must not be 0"},
+		{`[1, 2][::true]`, "slice bounds must be INTEGER, got BOOLEAN"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error for %q, but got nil", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -349,19 +436,182 @@ func TestCallingFunctionsWithArguments(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{"let add = fn(a, b = 2) { a + b }; add(1)", 3},
+		{"let add = fn(a, b = 2) { a + b }; add(1, 10)", 11},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1)", 3},
+		{"let f = fn(a, b = a * 2, c = a + b) { c }; f(1, 5)", 6},
+		{"let a = 10; let f = fn(a = a) { a }; f()", 10},
+		{"let f = fn(...rest) { len(rest) }; f()", 0},
+		{"let f = fn(a, ...rest) { a + len(rest) }; f(1, 2, 3)", 3},
+		{"let f = fn(a, b = 5, ...rest) { b + len(rest) }; f(1)", 5},
+		{"let f = fn(a, ...rest) { rest[1] }; f(1, 2, 3)", 3},
+		{"let f = fn(a, ...rest) { let b = 4; a + b + len(rest) }; f(1, 2, 3, 4)", 8},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(1, ...[2], 3)", 6},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[], 1, ...[2, 3])", 6},
+		{"let f = fn(...rest) { len(rest) }; f(...[1, 2], ...[3])", 3},
+		{"len(...[[1, 2]])", 2},
+		{"let xs = [1]; let f = fn(...rest) { rest }; f(...xs, 2); xs", []int{1}},
+		{"let outer = fn(x) { fn(y = x) { y } }; outer(7)()", 7},
+		{"let f = fn(b, a = match (1) { 1 => 10, _ => 0 }) { [b, a] }; f(7, 3)", []int{7, 3}},
+		{"let f = fn(b, a = match (1) { 1 => 10, _ => 0 }) { [b, a] }; f(7)", []int{7, 10}},
+		{"let f = fn(b, a = match ([1, 2]) { [x, y] if x < y => x + y }, c = b) { [b, a, c] }; f(7)", []int{7, 3, 7}},
+		{"let f = fn(b, [x, y] = match (b) { n => [n, n] }, c = 5) { [b, x, y, c] }; f(7)", []int{7, 7, 7, 5}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a, b] = [1, 2]; a + b", 3},
+		{"let [a, b] = [1]; b", Null},
+		{"let [a, ...b] = [1, 2, 3]; b", []int{2, 3}},
+		{"let [a, b, ...c] = [1]; c", []int{}},
+		{"let [a, [b, c]] = [1, [2, 3]]; a + b + c", 6},
+		{"let a = 1; let b = 2; let [a, b] = [b, a]; a - b", 1},
+		{`let {name, "age": years} = {"name": "Al", "age": 30}; name`, "Al"},
+		{`let {name, "age": years} = {"name": "Al", "age": 30}; years`, 30},
+		{`let {missing} = {}; missing`, Null},
+		{`let {1: one, true: yes} = {1: 10, true: 20}; one + yes`, 30},
+		{`let {point: [x, y]} = {"point": [3, 4]}; x * y`, 12},
+		{"let f = fn([a, b], c) { a + b + c }; f([1, 2], 3)", 6},
+		{`let f = fn({x}, [y] = [2]) { x * y }; f({"x": 3})`, 6},
+		{"let f = fn() { let [a, b] = [1, 2]; a + b }; f()", 3},
+		{"let f = fn(x) { fn([y]) { x + y } }; f(1)([2])", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"let [a] = 1;", "cannot destructure INTEGER, want=ARRAY"},
+		{"let {a} = [1];", "cannot destructure ARRAY, want=HASH"},
+		{"let [{a}] = [[1]];", "cannot destructure ARRAY, want=HASH"},
+		{"let f = fn([a]) { a }; f(1);", "cannot destructure INTEGER, want=ARRAY"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error for %q, but got nil", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	describe := `let describe = fn(x) {
+		match (x) {
+			0 => "zero",
+			-1 => "minus one",
+			"hi" => "greeting",
+			true => "yes",
+			[] => "empty",
+			[first, ...others] => first,
+			{"type": "user", name} => name,
+			{"type": "point", "at": [x, y]} => x + y,
+			n if n == 11 => "eleven",
+			_ => "other"
+		}
+	};`
+	tests := []vmTestCase{
+		{describe + "describe(0)", "zero"},
+		{describe + "describe(-1)", "minus one"},
+		{describe + `describe("hi")`, "greeting"},
+		{describe + "describe(true)", "yes"},
+		{describe + "describe(false)", "other"},
+		{describe + "describe([])", "empty"},
+		{describe + `describe(["a", "b"])`, "a"},
+		{describe + `describe({"type": "user", "name": "Al"})`, "Al"},
+		{describe + `describe({"type": "point", "at": [1, 2]})`, 3},
+		{describe + `describe({"type": "point", "at": [1]})`, "other"},
+		{describe + `describe({"type": "admin", "name": "Al"})`, "other"},
+		{describe + "describe(11)", "eleven"},
+		{describe + "describe(5)", "other"},
+		{"match ([1, 2, 3]) { [a, ...b] => b }", []int{2, 3}},
+		{"match ([1, 2, 3]) { [a, ..._] => a }", 1},
+		{"match ([1, 2, 3]) { [a, b] => 1, [a, b, c] => a + b + c }", 6},
+		{"match ([1, [2, 3]]) { [1, [a, 4]] => a, [1, [a, 3]] => a * 10 }", 20},
+		{"let a = 1; match ([5, 2]) { [a, 1] => a, _ => a }", 1},
+		{"let n = 0; match (5) { n if n > 10 => 1, _ => n }", 0},
+		{"let n = 0; match ([5, 6]) { [n, m] if n > m => 1, [_, m] => n + m }", 6},
+		{"let n = 0; match (5) { n if n > 1 => n, _ => 0 } + n", 10},
+		{"let f = fn(n) { match (5) { n if n > 10 => 1, _ => n } }; f(0)", 0},
+		{"let f = fn(n) { match (5) { n if fn() { n > 10 }() => 1, _ => n } }; f(0)", 0},
+		{"let f = fn(x) { match (x) { 0 => 1, n => n * f(n - 1) } }; f(5)", 120},
+		{"let f = fn(x) { fn() { match (x) { [a] => a } } }; f([7])()", 7},
+		{"let f = fn(x) { match (x) { n if n > 0 => n, _ => -x } }; f(-3) + f(4)", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatchErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"match (5) { 0 => 1, [a] => a }", "no match for INTEGER 5"},
+		{"match ([1, 2]) { [a] => a }", "no match for ARRAY [1, 2]"},
+		{"match ({}) { {[1]: a} => a }", "unusable as hash key: *object.Array"},
+		{`match ("a") { n if n > 1 => n }`, "unknown operator: 10 (STRING INTEGER)"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error for %q, but got nil", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
 func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
 			input:    "fn() { 1; }(1);",
-			expected: "wrong number of arguments: want=0, got=1",
+			expected: "wrong number of arguments to fn(): want=0, got=1",
 		},
 		{
 			input:    "fn(a) { a; }();",
-			expected: "wrong number of arguments: want=1, got=0",
+			expected: "wrong number of arguments to fn(a): want=1, got=0",
 		},
 		{
 			input:    "fn(a, b) { a + b; }(1);",
-			expected: "wrong number of arguments: want=2, got=1",
+			expected: "wrong number of arguments to fn(a, b): want=2, got=1",
+		},
+		{
+			input:    "let add = fn(a, b = 1) { a + b; }; add(1, 2, 3);",
+			expected: "wrong number of arguments to fn add(a, b): want=1 to 2, got=3",
+		},
+		{
+			input:    "let log = fn(level, ...messages) { messages; }; log();",
+			expected: "wrong number of arguments to fn log(level, ...messages): want=1 or more, got=0",
+		},
+		{
+			input:    "fn(a) { a; }(...[1, 2]);",
+			expected: "wrong number of arguments to fn(a): want=1, got=2",
+		},
+		{
+			input:    "fn(a) { a; }(...1);",
+			expected: "cannot spread INTEGER, want=ARRAY",
 		},
 	}
 	for _, tt := range tests {
@@ -394,6 +644,7 @@ func TestBuiltinFunctions(t *testing.T) {
 			&object.Error{Message: "wrong number of arguments, got 2 wanted 1"}},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
+		{`len({1: 2, "a": 3})`, 2},
 		{`puts("hello", "world")`, Null},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, Null},
@@ -404,14 +655,351 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`last(1)`,
 			&object.Error{Message: "argument to `last` must be ARRAY, got INTEGER"}},
 		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, Null},
+		{`rest([])`, []int{}},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`,
 			&object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"}},
+		{`assert(1 < 2)`, Null},
+		{`assertEqual({"a": [1, "b"]}, {"a": [1, "b"]})`, Null},
+		{`assertError(len(1), "not supported")`, Null},
+	}
+	runVmTests(t, tests)
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`join(split("a,b,,c", ","), "|")`, "a|b||c"},
+		{`len(split("abc", ""))`, 3},
+		{`join([1, "b", true], "-")`, "1-b-true"},
+		{`join([], ",")`, ""},
+		{`trim("  hi there  ")`, "hi there"},
+		{`upper("Hello")`, "HELLO"},
+		{`lower("Hello")`, "hello"},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`contains("hello", "ell")`, true},
+		{`contains("hello", "xyz")`, false},
+		{`if (contains("hello", "h")) { 1 } else { 2 }`, 1},
+		{`startsWith("hello", "he") == true`, true},
+		{`endsWith("hello", "he")`, false},
+		{`indexOf("hello", "l")`, 2},
+		{`indexOf("hello", "z")`, -1},
+		{`substr("hello", 1, 3)`, "ell"},
+		{`substr("hello", 3)`, "lo"},
+		{`substr("hello", 4, 10)`, "o"},
+		{`substr("hello", 10, 1)`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`format("%s is %d years old, 100%%", "Anna", 28)`, "Anna is 28 years old, 100%"},
+		{`format("%v and %q", [1, "a"], "b")`, `[1, a] and "b"`},
+		{`join(chars("héllo"), " ")`, "h é l l o"},
+		{`len("héllo")`, 5},
+		{`indexOf("héllo", "l")`, 2},
+		{`substr("héllo", 1, 2)`, "él"},
+		{`substr("héllo", 2, 9223372036854775807)`, "llo"},
+		{`len(chars(""))`, 0},
+		{`str(12) + str("a") + str([1, true]) + str(fn(x) { x })`, "12a[1, true]fn(x)"},
+		{`int("42") + int(" -7 ")`, 35},
+		{`int(true) + int(5)`, 6},
+		{`split(1, ",")`,
+			&object.Error{Message: "argument to `split` must be STRING, got INTEGER"}},
+		{`join(["a"])`,
+			&object.Error{Message: "wrong number of arguments, got 1 wanted 2"}},
+		{`substr("a", -1)`,
+			&object.Error{Message: "negative argument to `substr`"}},
+		{`substr("a")`,
+			&object.Error{Message: "wrong number of arguments, got 1 wanted 2 or 3"}},
+		{`repeat("a", -1)`,
+			&object.Error{Message: "negative count to `repeat`: -1"}},
+		{`repeat("ab", 4611686018427387904)`,
+			&object.Error{Message: "result of `repeat` too long: 4611686018427387904 times 2 bytes"}},
+		{`format("%d", "a")`,
+			&object.Error{Message: "%d in `format` must be INTEGER, got STRING"}},
+		{`format("%s %s", "a")`,
+			&object.Error{Message: "missing argument for %s in `format`"}},
+		{`format("%s", "a", "b")`,
+			&object.Error{Message: "too many arguments to `format`: want=1, got=2"}},
+		{`format("%x", 1)`,
+			&object.Error{Message: "unknown verb %x in `format`"}},
+		{`format("100%")`,
+			&object.Error{Message: `format ends with %: "100%"`}},
+		{`int("4x")`,
+			&object.Error{Message: `could not convert "4x" to INTEGER`}},
+		{`int([])`,
+			&object.Error{Message: "argument to `int` not supported, got ARRAY"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let n = 10; map([1, 2], fn(x) { x + n })`, []int{11, 12}},
+		{`map(["a", "bc"], len)`, []int{1, 2}},
+		{`map([[1], [2, 3]], fn(xs) { reduce(map(xs, fn(x) { x * x }), fn(a, b) { a + b }) })`, []int{1, 13}},
+		{`let f = fn(x) { if (x < 2) { x } else { f(x - 1) + f(x - 2) } }; map(range(7), f)`, []int{0, 1, 1, 2, 3, 5, 8}},
+		{`1 + reduce(map([1, 2], fn(x) { x + 1 }), fn(a, b) { a * b }) + 1`, 8},
+		{`filter(range(10), fn(x) { x / 3 * 3 == x })`, []int{0, 3, 6, 9}},
+		{`filter([1, 2, 3], fn(x) { if (x == 2) { 1 } })`, []int{2}},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x })`, 10},
+		{`reduce([], fn(acc, x) { acc + x }, 5)`, 5},
+		{`reduce(["a", "b"], fn(acc, x) { acc + x }, "")`, "ab"},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`join(sort(["b", "c", "a"]), "")`, "abc"},
+		{`sort([3, 1, 2], fn(a, b) { a > b })`, []int{3, 2, 1}},
+		{`sort([3, 1, 2], fn(a, b) { a - b })`, []int{1, 2, 3}},
+		{`let people = [{"n": "b", "age": 2}, {"n": "a", "age": 1}, {"n": "c", "age": 2}]; join(map(sort(people, fn(a, b) { a["age"] < b["age"] }), fn(p) { p["n"] }), "")`, "abc"},
+		{`let a = [2, 1]; sort(a); a`, []int{2, 1}},
+		{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+		{`slice([1, 2, 3, 4], 1, 3)`, []int{2, 3}},
+		{`slice([1, 2, 3, 4], 2)`, []int{3, 4}},
+		{`slice("hello", 1, 99)`, "ello"},
+		{`concat([1], [], [2, 3])`, []int{1, 2, 3}},
+		{`concat()`, []int{}},
+		{`contains([1, [2], "a"], [2])`, true},
+		{`contains([1, 2], 3)`, false},
+		{`range(3)`, []int{0, 1, 2}},
+		{`range(2, 5)`, []int{2, 3, 4}},
+		{`range(5, 0, -2)`, []int{5, 3, 1}},
+		{`range(0)`, []int{}},
+		{`range(9223372036854775805, 9223372036854775807, 5)`, []int{9223372036854775805}},
+		{`len(range(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807))`, 3},
+		{`range(3, -9223372036854775807 - 1, -9223372036854775807 - 1)`, []int{3, -9223372036854775805}},
+		{`str(zip([1, 2, 3], ["a", "b"]))`, "[[1, a], [2, b]]"},
+		{`str(keys({"b": 1, 2: 2, "a": 3, 1: 4, true: 5}))`, "[true, 1, 2, a, b]"},
+		{`values({"b": 1, 2: 2, "a": 3})`, []int{2, 3, 1}},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`let h = {"a": 1, "b": 2}; str([keys(delete(h, "a")), len(h)])`, "[[b], 2]"},
+		{`values(merge({"a": 1, "b": 2}, {"b": 3}, {"c": 4}))`, []int{1, 3, 4}},
+		{`map(1, len)`,
+			&object.Error{Message: "argument to `map` must be ARRAY, got INTEGER"}},
+		{`map([1], 1)`,
+			&object.Error{Message: "argument to `map` must be FUNCTION, got INTEGER"}},
+		{`map([1], len)`,
+			&object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+		{`reduce([], fn(a, b) { a })`,
+			&object.Error{Message: "reduce of an empty array without an initial value"}},
+		{`sort([1, "a"])`,
+			&object.Error{Message: "cannot compare STRING and INTEGER in `sort` without a comparator"}},
+		{`sort([1, 2], fn(a, b) { "a" })`,
+			&object.Error{Message: "comparator of `sort` must return BOOLEAN or INTEGER, got STRING"}},
+		{`range(1, 2, 0)`,
+			&object.Error{Message: "step of `range` must not be 0"}},
+		{`sort([1, 2], fn(a, b) { })`,
+			&object.Error{Message: "comparator of `sort` must return BOOLEAN or INTEGER, got NULL"}},
+		{`range(0, 9223372036854775807, 2)`,
+			&object.Error{Message: "result of `range` too long: 4611686018427387904 elements"}},
+		{`range(-9223372036854775807 - 1, 9223372036854775807)`,
+			&object.Error{Message: "result of `range` too long: 18446744073709551615 elements"}},
+		{`has({}, [])`,
+			&object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`merge({}, [])`,
+			&object.Error{Message: "argument to `merge` must be HASH, got ARRAY"}},
+	}
+	runVmTests(t, tests)
+}
+
+func TestCollectionBuiltinErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1], fn(x) { x + "a" })`, "unsupported types for binary operation: INTEGER STRING"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments to fn(a, b): want=2, got=1"},
+		{`let f = fn(x) { map([x], f) }; f(1)`, "stack overflow"},
+		{`filter([1], fn(x) { assert(false, "in filter") })`, "assertion failed: in filter"},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error for %q, but got nil", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message for %q. want=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+// greet calls its argument with the greeting the host provides.
+var greet = &object.Builtin{Fn: func(ctx object.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return ctx.Errorf("greet wants 1 argument, got %d", len(args))
+	}
+	greeting, _ := ctx.Host().Service("greeting").(string)
+	return ctx.Call(args[0], &object.String{Value: greeting})
+}}
+
+// ignore calls its argument and drops the result.
+var ignore = &object.Builtin{Fn: func(ctx object.Context, args ...object.Object) object.Object {
+	ctx.Call(args[0])
+	return &object.Integer{Value: 1}
+}}
+
+func TestBuiltinContext(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+		output   string
+		err      string
+	}{
+		{`greet(fn(g) { puts(g); len(g) }) + 1`, 6, "hello\n", ""},
+		{`greet(fn(g) { greet(fn(h) { g + " " + h }) })`, "hello hello", "", ""},
+		{`greet(upper)`, "HELLO", "", ""},
+		{`assertError(greet())`, nil, "", "greet wants 1 argument, got 0"},
+		{`greet(fn() { 1 })`, nil, "", "wrong number of arguments to fn(): want=0, got=1"},
+		{`str([greet(fn(g) { }), greet(fn(g) { if (true) { return len(g); } })])`, "[null, 5]", "", ""},
+		{`ignore(fn() { 1 }) + ignore(fn() { int("x") })`, 2, "", ""},
+		{`ignore(fn() { 1 + true })`, nil, "", "unsupported types for binary operation: INTEGER BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		symbolTable := compiler.NewSymbolTable()
+		for i, v := range object.Builtins {
+			symbolTable.DefineBuiltin(i, v.Name)
+		}
+		symbolTable.Define("greet")
+		symbolTable.Define("ignore")
+		comp := compiler.NewWithState(symbolTable, []object.Object{})
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		globals := make([]object.Object, GlobalsSize)
+		globals[0] = greet
+		globals[1] = ignore
+		vm := NewWithGlobalsStore(comp.Bytecode(), globals)
+		var out bytes.Buffer
+		vm.SetHost(&object.Host{Stdout: &out, Services: map[string]interface{}{"greeting": "hello"}})
+
+		err := vm.Run()
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %q. want=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+}
+
+func TestFunctionMetadata(t *testing.T) {
+	tests := []vmTestCase{
+		{`let fibonacci = fn(x) { x }; name(fibonacci)`, "fibonacci"},
+		{`name(fn(x) { x })`, Null},
+		{`let f = fn() { 1 }; let g = f; name(g)`, "f"},
+		{`name(len)`, "len"},
+		{`name(1)`,
+			&object.Error{Message: "argument to `name` must be FUNCTION, got INTEGER"}},
+		{`arity(fn() { 1 })`, 0},
+		{`arity(fn(a, b) { a })`, 2},
+		{`arity(fn(a, b = 1, ...rest) { a })`, 1},
+		{`arity(len)`, 1},
+		{`arity(substr)`, 2},
+		{`arity(puts)`, 0},
+		{`arity("f")`,
+			&object.Error{Message: "argument to `arity` must be FUNCTION, got STRING"}},
 	}
 	runVmTests(t, tests)
 }
 
+func TestFunctionInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let fibonacci = fn(x) { x }; fibonacci", "fn fibonacci(x)"},
+		{"fn(a, b = 2, ...rest) { a }", "fn(a, b, ...rest)"},
+		{"let outer = fn() { let inner = fn(y) { y }; inner }; outer()", "fn inner(y)"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong inspection of %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestAssertionFailures(t *testing.T) {
+	tests := []vmTestCase{
+		{`assert(1 > 2); 1`, "assertion failed"},
+		{`assert(false, "no " + "way")`, "assertion failed: no way"},
+		{`assert()`, "wrong number of arguments to `assert`, got 0 wanted 1 or 2"},
+		{`assertEqual([1, 2], [1, 3])`, "assertEqual failed: want=[1, 3], got=[1, 2]"},
+		{`assertEqual(1, "1")`, "assertEqual failed: want=1, got=1"},
+		{`assertError(1)`, "assertError failed: want an error, got=1"},
+		{`assertError(first(1), "ARRAY!")`,
+			"assertError failed: want an error containing \"ARRAY!\", got=\"argument to `first` must be ARRAY, got INTEGER\""},
+	}
+	for _, tt := range tests {
+		program := parse(tt.input)
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected vm error for %q, but got nil", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error message. want=%q, got=%q", tt.expected, err.Error())
+		}
+	}
+}
+
+func TestRuntimeErrorTrace(t *testing.T) {
+	input := `let f = fn(x) {
+  x + true
+};
+let g = fn(x) {
+  f(x)
+};
+fn(x) {
+  g(x)
+}(1);`
+	program := parse(input)
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("err is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	expected := []object.Frame{
+		{Function: "f", Line: 2},
+		{Function: "g", Line: 5},
+		{Function: "fn@7", Line: 8},
+		{Function: "main", Line: 7},
+	}
+	if !reflect.DeepEqual(runtimeErr.Trace, expected) {
+		t.Errorf("wrong trace. want=%v, got=%v", expected, runtimeErr.Trace)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -691,3 +1279,54 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		testExpectedObject(t, tt.expected, elm)
 	}
 }
+
+func TestWideConstants(t *testing.T) {
+	constants := make([]object.Object, 70000)
+	for i := range constants {
+		constants[i] = &object.Integer{Value: int64(i)}
+	}
+
+	comp := compiler.NewWithState(compiler.NewSymbolTable(), constants)
+	err := comp.Compile(parse(`let f = fn(x) { x + 70000 + 69999 }; [f(1), "wide"]`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	result, ok := vm.LastPoppedStackElem().(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T", vm.LastPoppedStackElem())
+	}
+	if err := testIntegerObject(140000, result.Elements[0]); err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+	if err := testStringObject("wide", result.Elements[1]); err != nil {
+		t.Errorf("testStringObject failed: %s", err)
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	// Identifiers cannot hold digits, so the locals are spelled in base 26.
+	names := make([]string, 300)
+	for i := range names {
+		names[i] = fmt.Sprintf("v%c%c", 'a'+i/26, 'a'+i%26)
+	}
+	lets := ""
+	for i, name := range names {
+		lets += fmt.Sprintf("let %s = %d; ", name, i)
+	}
+	params := strings.Join(names, ", ")
+	args := strings.TrimSuffix(strings.Repeat("2, ", 300), ", ")
+
+	tests := []vmTestCase{
+		{fmt.Sprintf("let f = fn() { %s %s + %s }; f()", lets, names[0], names[299]), 299},
+		{fmt.Sprintf("let f = fn(%s) { %s }; f(%s)", params, strings.Join(names, " + "), args), 600},
+		{fmt.Sprintf("let f = fn(%s) { fn() { %s } }; f(%s)()", params, strings.Join(names, " + "), args), 600},
+	}
+
+	runVmTests(t, tests)
+}